@@ -0,0 +1,60 @@
+package climate
+
+import (
+	"github.com/avamsi/ergo/assert"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// ExactArgs returns bounds that accept exactly n positional args.
+func ExactArgs(n int) internal.ArgsBounds {
+	return RangeArgs(n, n)
+}
+
+// NoArgs returns bounds that accept no positional args at all (which is already
+// the default for funcs that don't collect their args as a []string).
+func NoArgs() internal.ArgsBounds {
+	return ExactArgs(0)
+}
+
+// MinimumArgs returns bounds that accept at least n positional args.
+func MinimumArgs(n int) internal.ArgsBounds {
+	assert.Truef(n >= 0, "negative args bound: %v", n)
+	return internal.ArgsBounds{Min: n, Max: -1}
+}
+
+// MaximumArgs returns bounds that accept at most n positional args.
+func MaximumArgs(n int) internal.ArgsBounds {
+	return RangeArgs(0, n)
+}
+
+// RangeArgs returns bounds that accept between min and max (both inclusive)
+// positional args.
+func RangeArgs(min, max int) internal.ArgsBounds {
+	assert.Truef(0 <= min && min <= max, "invalid args bounds: [%v, %v]", min, max)
+	return internal.ArgsBounds{Min: min, Max: max}
+}
+
+// WithArgs returns a modifier that validates the number of positional args
+// against the given bounds (before the func is even called). The func must
+// collect its args as a []string.
+func WithArgs(bounds internal.ArgsBounds) func(*internal.CommandOptions) {
+	return func(opts *internal.CommandOptions) {
+		opts.Args = &bounds
+	}
+}
+
+// WithArgNames returns a modifier that names the positional args (by position)
+// for the usage line and errors, so that
+//
+//	climate.Func(cp, climate.WithArgs(climate.ExactArgs(2)), climate.WithArgNames("source", "dest"))
+//
+// shows up as "cp <source> <dest>" and errors with "cp: missing argument: dest"
+// when invoked with just the one arg. The names are purely cosmetic (use typed
+// positionals, see Func, to also parse the args). The func must collect its
+// args as a []string.
+func WithArgNames(names ...string) func(*internal.CommandOptions) {
+	return func(opts *internal.CommandOptions) {
+		opts.ArgNames = names
+	}
+}
@@ -0,0 +1,127 @@
+package climate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithArgsFileExpansion returns a modifier that makes Run replace the "@path"
+// args with the args read from the file at path (before parsing and before any
+// WithArgsTransform, like gcc or javac do), for very long invocations (CI jobs
+// with dozens of flags, say):
+//
+//	# release.args
+//	--env=prod --region us-east
+//	--message "ship it" # comments go until the end of the line
+//
+// The args in the file are separated by whitespace (including newlines), may be
+// quoted like in a shell ('...' as is, "..." with backslash escapes) and may
+// refer to other args files in turn (up to 10 levels deep, to catch loops).
+// Args after "--" are not expanded. Errors reading (or parsing) the files are
+// usage errors.
+func WithArgsFileExpansion() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.ArgsFileExpansion = true
+	}
+}
+
+const maxArgsFileDepth = 10
+
+// expandArgsFiles returns the given args with the "@path" args expanded (see
+// WithArgsFileExpansion), along with whether they had a "--" (after which the
+// rest of the args are left as is, including when the "--" is in a file).
+func expandArgsFiles(args []string, depth int) (expanded []string, dash bool, err error) {
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...), true, nil
+		}
+		path, ok := strings.CutPrefix(arg, "@")
+		if !ok || path == "" {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if depth == maxArgsFileDepth {
+			return nil, false, fmt.Errorf("%v: args files nested too deeply (more than %v levels)", arg, maxArgsFileDepth)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("reading args file: %w", err)
+		}
+		fargs, err := splitArgsFile(string(b))
+		if err != nil {
+			return nil, false, fmt.Errorf("%v: %w", arg, err)
+		}
+		fargs, dash, err = expandArgsFiles(fargs, depth+1)
+		if err != nil {
+			return nil, false, err
+		}
+		expanded = append(expanded, fargs...)
+		if dash {
+			return append(expanded, args[i+1:]...), true, nil
+		}
+	}
+	return expanded, false, nil
+}
+
+// splitArgsFile splits the given contents of an args file into the args (see
+// WithArgsFileExpansion).
+func splitArgsFile(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote rune
+		rs    = []rune(s)
+	)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			if i++; i == len(rs) {
+				return nil, errors.New("trailing backslash")
+			}
+			arg.WriteRune(rs[i])
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case r == '#' && !inArg:
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,90 @@
+package climate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/pflag"
+)
+
+// ByteSize is a size in bytes and may be used as a flag type, in which case its
+// value is parsed from human-friendly sizes like 512, 10KB, 1.5MiB or 4GiB
+// (where KB etc. are powers of 1000, KiB etc. are powers of 1024 and the B is
+// optional -- so, 4G is 4GB and 4Gi is 4GiB).
+type ByteSize int64
+
+var byteSizeUnits = map[string]float64{
+	"":   1,
+	"k":  1e3,
+	"m":  1e6,
+	"g":  1e9,
+	"t":  1e12,
+	"p":  1e15,
+	"ki": 1 << 10,
+	"mi": 1 << 20,
+	"gi": 1 << 30,
+	"ti": 1 << 40,
+	"pi": 1 << 50,
+}
+
+// ParseByteSize parses the given human-friendly size (see ByteSize).
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	unit := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s[i:])), "b")
+	m, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size %q: unknown unit %q", s, s[i:])
+	}
+	return ByteSize(n * m), nil
+}
+
+func (bs ByteSize) String() string {
+	for _, u := range []string{"Pi", "Ti", "Gi", "Mi", "Ki"} {
+		if m := int64(byteSizeUnits[strings.ToLower(u)]); bs != 0 && int64(bs)%m == 0 {
+			return fmt.Sprintf("%v%vB", int64(bs)/m, u)
+		}
+	}
+	return fmt.Sprintf("%vB", int64(bs))
+}
+
+type byteSizeValue struct {
+	p *ByteSize
+}
+
+var _ pflag.Value = byteSizeValue{}
+
+func (bsv byteSizeValue) String() string {
+	return bsv.p.String()
+}
+
+func (bsv byteSizeValue) Set(s string) error {
+	bs, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*bsv.p = bs
+	return nil
+}
+
+func (bsv byteSizeValue) Type() string {
+	return "bytes"
+}
+
+func byteSizeVarP(fset *pflag.FlagSet) flagTypeVarP[ByteSize] {
+	return func(p *ByteSize, name, shorthand string, value ByteSize, usage string) {
+		*p = value
+		fset.VarP(byteSizeValue{p}, name, shorthand, usage)
+	}
+}
@@ -0,0 +1,37 @@
+package climate
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+	}{
+		{"512", 512},
+		{"512B", 512},
+		{"10KB", 10_000},
+		{"10k", 10_000},
+		{"1.5MiB", 3 << 19},
+		{"4GiB", 4 << 30},
+		{"4 gi", 4 << 30},
+	}
+	for _, test := range tests {
+		got, err := ParseByteSize(test.in)
+		if err != nil || got != test.want {
+			t.Errorf("ParseByteSize(%q) = %v, %v, want %v, nil", test.in, got, err, test.want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1", "10XB", "1.2.3"} {
+		if got, err := ParseByteSize(in); err == nil {
+			t.Errorf("ParseByteSize(%q) = %v, nil, want error", in, got)
+		}
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	for bs, want := range map[ByteSize]string{0: "0B", 512: "512B", 1000: "1000B", 3 << 19: "1536KiB", 4 << 30: "4GiB"} {
+		if got := bs.String(); got != want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(bs), got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package climate
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// carapaceCommand is a command as per the carapace-spec format, see
+// https://carapace-sh.github.io/carapace-spec/.
+type carapaceCommand struct {
+	Name            string              `yaml:"name"`
+	Aliases         []string            `yaml:"aliases,omitempty"`
+	Description     string              `yaml:"description,omitempty"`
+	Flags           map[string]string   `yaml:"flags,omitempty"`
+	PersistentFlags map[string]string   `yaml:"persistentflags,omitempty"`
+	Completion      *carapaceCompletion `yaml:"completion,omitempty"`
+	Commands        []*carapaceCommand  `yaml:"commands,omitempty"`
+}
+
+type carapaceCompletion struct {
+	Flag map[string][]string `yaml:"flag,omitempty"`
+}
+
+// carapaceFlag returns the carapace-spec (-s, --long plus modifiers) key for
+// the given flag, i.e., with "*" for repeatable flags, "!" for required ones and
+// "=" for the ones that take a value ("?" if the value is optional).
+func carapaceFlag(fd *flagDescription) string {
+	key := "--" + fd.Name
+	if fd.Shorthand != "" {
+		key = "-" + fd.Shorthand + ", " + key
+	}
+	if _, ok := fd.flag.Annotations[repeatable]; ok {
+		key += "*"
+	}
+	if fd.Required {
+		key += "!"
+	}
+	switch {
+	case fd.flag.NoOptDefVal == "":
+		key += "="
+	case fd.Type != "bool" && fd.Type != "count":
+		key += "?"
+	}
+	return key
+}
+
+func carapaceValues(fd *flagDescription) []string {
+	if fd.Values != nil {
+		return fd.Values
+	}
+	if exts, ok := fd.flag.Annotations[cobra.BashCompFilenameExt]; ok {
+		if len(exts) == 0 {
+			return []string{"$files"}
+		}
+		return []string{"$files([." + strings.Join(exts, ", .") + "])"}
+	}
+	if _, ok := fd.flag.Annotations[cobra.BashCompSubdirsInDir]; ok {
+		return []string{"$directories"}
+	}
+	return nil
+}
+
+func carapaceSpec(cd *commandDescription) *carapaceCommand {
+	cc := &carapaceCommand{
+		Name:        cd.Name,
+		Aliases:     cd.Aliases,
+		Description: cd.Short,
+	}
+	for _, fd := range cd.Flags {
+		if fd.Hidden || fd.Deprecated != "" {
+			continue
+		}
+		flags := &cc.Flags
+		if fd.Persistent {
+			flags = &cc.PersistentFlags
+		}
+		if *flags == nil {
+			*flags = map[string]string{}
+		}
+		(*flags)[carapaceFlag(fd)] = fd.Usage
+		if values := carapaceValues(fd); values != nil {
+			if cc.Completion == nil {
+				cc.Completion = &carapaceCompletion{Flag: map[string][]string{}}
+			}
+			cc.Completion.Flag[fd.Name] = values
+		}
+	}
+	for _, sub := range cd.Commands {
+		if !sub.Hidden && sub.Deprecated == "" {
+			cc.Commands = append(cc.Commands, carapaceSpec(sub))
+		}
+	}
+	return cc
+}
+
+// GenCarapaceSpec returns a carapace-spec (YAML) for the given plan and all of
+// its subcommands (recursively), with their flags and descriptions (and the
+// enum / file completions of the flags, if any), for completion frameworks that
+// consume it (carapace, for example, which bridges to a whole lot of shells).
+// The modifiers are the same as the ones accepted by Run.
+func GenCarapaceSpec(p internal.Plan, mods ...func(*internal.RunOptions)) ([]byte, error) {
+	opts := runOptions(mods)
+	cmd, err := build(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(carapaceSpec(describeCommand(cmd.delegate, opts.Args))); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -8,12 +8,20 @@ package climate
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
 	"os"
 	"os/exec"
 	"reflect"
+	"slices"
+	"strings"
+	"syscall"
 
-	"github.com/avamsi/ergo"
 	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/avamsi/climate/internal"
 )
@@ -21,15 +29,49 @@ import (
 // Func returns an executable plan for the given function, which must conform to
 // the following signatures (excuse the partial [optional] notation):
 //
-//	func([ctx context.Context], [opts *T], [args []string]) [(err error)]
+//	func([ctx context.Context], [opts *T], [w io.Writer], [args []string]) ([out O], [err error])
 //
-// All of ctx, opts, args and error are optional. If opts is present, T must be
-// a struct (whose fields are used as flags).
-func Func(f any) *funcPlan {
+// All of ctx, opts, w, args, out and error are optional (args may also be
+// variadic, as in args ...string, but must still be last). If opts is present,
+// T must be a struct (whose fields are used as flags), which may also be passed
+// by value (opts T), in which case the func just gets a copy (which is never
+// nil). Fields tagged with `cli:"arg"` are used as (typed) positional args
+// instead, in order -- the last such field may also be a slice, to collect all
+// the remaining args (in which case the args param must be omitted). Nested
+// struct fields are flattened (recursively), with the flags prefixed by the
+// field name (or by `cli:"prefix=..."`, if given) -- embedded struct fields are
+// not prefixed by default. Fields tagged with `cli:"-"` (including nested struct
+// fields) are skipped altogether, so they may hold internal state (like what a
+// pre-run hook computes) without becoming flags.
+//
+// If w is present, it's the writer Run writes the output to (os.Stdout, unless
+// set via WithOutput), so the func may print to it instead of directly to
+// os.Stdout (and be tested with a buffer, by calling it directly).
+//
+// Fields tagged with `cli:"section=..."` (nested struct fields apply it to all
+// their flags) are grouped under that section in --help and GenMarkdownTree,
+// after the ungrouped ones (man pages are not grouped). Bool fields may be
+// passed as bare --X (i.e., --X=true) or with an explicit --X=true or --X=false,
+// unless tagged with `cli:"explicit"`, in which case the value is required (as
+// in --X=false or --X false, for scripts that template the values). Pointer
+// fields (*int, *string etc.) are left nil unless the flag is set (via the
+// command line, env or config), for tri-state flags where "not provided" and
+// zero differ.
+//
+// If out is present (and O is not an error), it's printed after the func
+// returns (unless it returns an error too), as per an --output flag (text, json
+// or yaml -- text just uses fmt.Println).
+//
+// The given modifiers customize the resulting command (see WithArgs).
+func Func(f any, mods ...func(*internal.CommandOptions)) *funcPlan {
 	t := reflect.TypeOf(f)
 	assert.Truef(t.Kind() == reflect.Func, "not a func: %v", t)
 	v := reflect.ValueOf(f)
-	return &funcPlan{reflection{ot: t, ov: &v}}
+	fp := &funcPlan{reflection: reflection{ot: t, ov: &v}}
+	for _, mod := range mods {
+		mod(&fp.opts)
+	}
+	return fp
 }
 
 var _ internal.Plan = (*funcPlan)(nil)
@@ -37,30 +79,95 @@ var _ internal.Plan = (*funcPlan)(nil)
 // Struct returns an executable plan for the struct given as the type parameter,
 // with its methods* (and "child" structs) as subcommands.
 //
-// * Only methods with pointer receiver are considered (and they must otherwise
-// conform to the same signatures described in Func).
+// Fields of the struct are declared as persistent flags (i.e., flags that are
+// inherited by all the subcommands), unless tagged with `cli:"local"`. Methods
+// can access the parsed values via the receiver (and child structs via a field
+// of the parent struct pointer type). If a subcommand declares a flag with the
+// same name, it shadows the inherited flag (for that subcommand).
+//
+// A method (or child struct) with a //cli:default directive is used as the
+// default subcommand, i.e., it's run (with the given flags and args) when the
+// parent is invoked without a subcommand (but not for --help or typos).
+// Otherwise, invoking the parent without a subcommand prints its help (and
+// exits with 0, see WithGroupExitCode), while unknown subcommands are usage
+// errors (with suggestions, if any). The commands of the methods may be
+// customized just like Funcs via Method.
+//
+// * Methods with both pointer and value receivers are considered (and they must
+// otherwise conform to the same signatures described in Func). Value receivers
+// are fine for methods that only read the flags, but note that they get a copy
+// of the struct (so any changes they make to it are not seen by anyone else).
 func Struct[T any](subcommands ...*structPlan) *structPlan {
 	var (
 		ptr = reflect.TypeOf((*T)(nil))
 		t   = ptr.Elem()
 	)
 	assert.Truef(t.Kind() == reflect.Struct, "not a struct: %v", t)
-	if n := t.NumMethod(); n > 0 {
-		ms := make([]string, n)
-		for i := 0; i < n; i++ {
-			ms[i] = t.Method(i).Name
-		}
-		ergo.Panicf("nonzero methods %v on: %v", ms, t)
-	}
 	assert.Truef(ptr.NumMethod() > 0, "no methods on: %v", ptr)
-	return &structPlan{
-		reflection{ptr: &reflection{ot: ptr}, ot: t},
-		subcommands,
+	sp := &structPlan{reflection: reflection{ptr: &reflection{ot: ptr}, ot: t}}
+	for _, sub := range subcommands {
+		sp.addSubcommand(sub)
+	}
+	return sp
+}
+
+// Method applies the given modifiers (see WithArgs) to the command for the method
+// with the given name of the struct of p (which may be called more than once for
+// the same method, with the modifiers applied in order) and returns p, so that
+// the subcommands of a Struct can be customized just like a Func:
+//
+//	climate.Method(climate.Struct[editor](), "Open",
+//		climate.WithArgs(climate.MinimumArgs(1)),
+//		climate.WithArgCompletion(completeFiles))
+func Method(p *structPlan, name string, mods ...func(*internal.CommandOptions)) *structPlan {
+	_, ok := p.ptr.t().MethodByName(name)
+	assert.Truef(ok, "no method %v on: %v", name, p.ptr.t())
+	if p.methods == nil {
+		p.methods = map[string]*internal.CommandOptions{}
+	}
+	opts, ok := p.methods[name]
+	if !ok {
+		opts = &internal.CommandOptions{}
+		p.methods[name] = opts
+	}
+	for _, mod := range mods {
+		mod(opts)
 	}
+	return p
 }
 
 var _ internal.Plan = (*structPlan)(nil)
 
+// Tree adds the given plans as subcommands of root (after the ones it already
+// has) and returns root, so that deep trees may be wired up level by level
+// instead of as one deeply nested Struct call:
+//
+//	var (
+//		root   = climate.Struct[git]()
+//		remote = climate.Struct[remote]()
+//	)
+//	climate.Tree(remote, climate.Struct[remoteAdd](), climate.Struct[remoteRemove]())
+//	climate.RunAndExit(climate.Tree(root, remote, climate.Struct[config]()))
+//
+// The plans are only built on Run, so the order of the Tree calls doesn't
+// matter. Each plan may only be added once (to a single parent) though, and Run
+// panics on cycles (like a plan being added to one of its own subcommands).
+func Tree(root *structPlan, subcommands ...*structPlan) *structPlan {
+	for _, sub := range subcommands {
+		root.addSubcommand(sub)
+	}
+	return root
+}
+
+// exitCoder may be implemented by errors to (also) carry their own exit code.
+type exitCoder interface {
+	ExitCode() int
+}
+
+// usageExitCode is the exit code for usage errors (unknown flags, missing args
+// etc.), so that scripts can tell "invoked it wrong" apart from "it failed".
+const usageExitCode = 2
+
 func exitCode(err error) int {
 	if err == nil { // if _no_ error
 		return 0
@@ -68,33 +175,373 @@ func exitCode(err error) int {
 	if eerr := new(exitError); errors.As(err, &eerr) {
 		return eerr.code
 	} else if eerr := new(exec.ExitError); errors.As(err, &eerr) {
+		// ExitCode is -1 for processes killed by signals, so use the same exit
+		// code as shells do instead (see signalExitCode).
+		if ws, ok := eerr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return signalExitCode(ws.Signal())
+		}
 		return eerr.ExitCode()
+	} else if cerr := exitCoder(nil); errors.As(err, &cerr) {
+		return cerr.ExitCode()
+	} else if uerr := new(UsageError); errors.As(err, &uerr) {
+		return usageExitCode
 	}
 	return 1
 }
 
 // WithMetadata returns a modifier that sets the metadata to be used by Run for
 // augmenting the CLI with additional information (for --help etc.).
-func WithMetadata(b []byte) func(*internal.RunOptions) {
+//
+// Metadata from multiple sources (generated for different packages, say) may be
+// given at once or via repeated modifiers, in which case they're merged by the
+// fully qualified names, with later ones overriding earlier ones on conflicts
+// (docs, comments and params are replaced while directives are replaced one by
+// one, by name).
+func WithMetadata(bs ...[]byte) func(*internal.RunOptions) {
 	return func(opts *internal.RunOptions) {
-		opts.Metadata = &b
+		opts.Metadata = append(opts.Metadata, bs...)
 	}
 }
 
-// Run executes the given plan and returns the exit code.
-func Run(ctx context.Context, p internal.Plan, mods ...func(*internal.RunOptions)) int {
+// DefaultMetadataPath is the path WithMetadataFS looks for metadata at, if no
+// path is given (matching the conventional cligen --out=md.cli invocation).
+const DefaultMetadataPath = "md.cli"
+
+// WithMetadataFS is similar to WithMetadata, except that it reads the metadata
+// from the given path (DefaultMetadataPath, if empty) in the given FS (usually
+// an embed.FS). Errors reading or decoding the metadata are reported by Run.
+// The metadata is merged after (i.e., overrides) the ones given via WithMetadata.
+//
+//	//go:generate go run github.com/avamsi/climate/cmd/cligen --out=md.cli
+//	//go:embed md.cli
+//	var mdFS embed.FS
+//
+//	climate.RunAndExit(climate.Func(greet), climate.WithMetadataFS(mdFS, ""))
+func WithMetadataFS(fsys fs.FS, path string) func(*internal.RunOptions) {
+	if path == "" {
+		path = DefaultMetadataPath
+	}
+	return func(opts *internal.RunOptions) {
+		opts.MetadataFS, opts.MetadataPath = fsys, path
+	}
+}
+
+// WithMetadataOverride returns a modifier that makes Run override the docs of
+// the given (fully qualified) symbols in the metadata, to present the same CLI
+// differently at runtime (for white-labeling, say) without regenerating it:
+//
+//	climate.WithMetadataOverride(map[string]string{
+//		"main.root":        "acme manages your Acme Cloud resources.",
+//		"main.root.Deploy": "Deploy deploys to Acme Cloud.",
+//	})
+//
+// The overrides take precedence over all of the metadata (regardless of the
+// order of the modifiers), replacing both the long and short descriptions (or
+// the usage, for fields). Repeated modifiers are merged, with later ones
+// overriding earlier ones on conflicts.
+func WithMetadataOverride(overrides map[string]string) func(*internal.RunOptions) {
+	for symbol := range overrides {
+		_, _, ok := internal.SplitSymbol(symbol)
+		assert.Truef(ok, "not a fully qualified symbol: %v", symbol)
+	}
+	return func(opts *internal.RunOptions) {
+		if opts.MetadataOverrides == nil {
+			opts.MetadataOverrides = map[string]string{}
+		}
+		maps.Copy(opts.MetadataOverrides, overrides)
+	}
+}
+
+// WithStrictMetadata returns a modifier that makes Run verify the metadata
+// against the plan (and error out on mismatches), to catch stale metadata (in
+// tests or CI, say). Every command and flag must have metadata and all of the
+// fields and methods of the command / options structs in the metadata must
+// still exist.
+func WithStrictMetadata() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.StrictMetadata = true
+	}
+}
+
+// WithTagPreference returns a modifier that makes Run derive the flag names from
+// the given struct tags (in order of preference), for fields without an explicit
+// `cli:"name=..."`, so that the flags line up with the keys of the config files
+// the same structs are (un)marshalled from:
+//
+//	type serveOptions struct {
+//		LogLevel string `yaml:"log_level"` // --log-level
+//		Addr     string `yaml:"listen"`    // --listen
+//	}
+//
+// The names are normalized to kebab-case just like the ones derived from the
+// field names (which is still the fallback) and are used as the prefixes of
+// nested struct fields too.
+func WithTagPreference(keys ...string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.TagPreference = keys
+	}
+}
+
+// WithName returns a modifier that makes Run use the given name for the root
+// command (instead of the one derived from the func / struct), which shows up in
+// the usage lines, help, completion scripts, docs etc. (of the subcommands too).
+// This is useful when the binary is named differently from the func / struct
+// (myapp vs rootCmd, for example) -- the subcommands are still named after their
+// methods (and child structs).
+func WithName(name string) func(*internal.RunOptions) {
+	assert.Truef(name != "" && !strings.ContainsAny(name, " \t\n"),
+		"not a command name: %q", name)
+	return func(opts *internal.RunOptions) {
+		opts.Name = name
+	}
+}
+
+// WithEnvPrefix returns a modifier that makes Run bind all flags (that aren't
+// already bound via the env tag) to environment variables derived from the
+// given prefix and the flag names (MYAPP_DRY_RUN for --dry-run, for example).
+func WithEnvPrefix(prefix string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.EnvPrefix = prefix
+	}
+}
+
+func runOptions(mods []func(*internal.RunOptions)) *internal.RunOptions {
 	var opts internal.RunOptions
 	for _, mod := range mods {
 		mod(&opts)
 	}
+	return &opts
+}
+
+func build(p internal.Plan, opts *internal.RunOptions) (*command, error) {
+	if opts.MetadataFS != nil {
+		b, err := fs.ReadFile(opts.MetadataFS, opts.MetadataPath)
+		if err != nil {
+			return nil, fmt.Errorf("climate: %w", err)
+		}
+		opts.Metadata = append(opts.Metadata, b)
+	}
 	var md *internal.Metadata
-	if opts.Metadata != nil {
-		md = internal.DecodeAsMetadata(*opts.Metadata)
+	if len(opts.Metadata) > 0 || len(opts.MetadataOverrides) > 0 {
+		var err error
+		if md, err = internal.DecodeAsMetadata(opts.Metadata...); err != nil {
+			return nil, fmt.Errorf("climate: %w", err)
+		}
+		for symbol, doc := range opts.MetadataOverrides {
+			md.Override(symbol, doc)
+		}
+	}
+	opts.Debug = debugEnabled(opts)
+	opts.Fields = map[*pflag.Flag]reflect.Value{}
+	opts.Args = map[*cobra.Command]*internal.ArgsBounds{}
+	cmd := &command{delegate: p.Build(md, opts)}
+	newTracer(opts).traceMetadata(md)
+	if opts.Name != "" {
+		// Note: only the first word of Use is the name, the rest is the usage of
+		// the args (if any), which is retained as is.
+		_, rest, _ := strings.Cut(cmd.delegate.Use, " ")
+		cmd.delegate.Use = strings.TrimSpace(opts.Name + " " + rest)
+	}
+	if opts.StrictMetadata {
+		if err := md.Verify(); err != nil {
+			return nil, fmt.Errorf("climate: %w", err)
+		}
+	}
+	// Note: this needs to happen before prepare, which checks whether the
+	// output is a terminal (for colors, see WithColor).
+	if opts.Input != nil {
+		cmd.delegate.SetIn(opts.Input)
+	}
+	if opts.Output != nil {
+		cmd.delegate.SetOut(opts.Output)
+	}
+	if opts.Error != nil {
+		cmd.delegate.SetErr(opts.Error)
+	}
+	cmd.prepare(opts)
+	for _, hook := range opts.CobraHooks {
+		hook(cmd.delegate)
+	}
+	return cmd, nil
+}
+
+// WithArgsTransform returns a modifier that makes Run pass the args through the
+// given func (before Cobra even gets to parse them), for backward compatibility
+// shims that need to rewrite them structurally (translating a deprecated -old
+// to --new or inserting a subcommand, say). The func sees the raw args (without
+// the program name, i.e., os.Args[1:] for Run) and returns the transformed ones.
+// Repeated modifiers transform the args in order.
+func WithArgsTransform(transform func([]string) []string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.ArgsTransforms = append(opts.ArgsTransforms, transform)
+	}
+}
+
+// WithCobraHook returns a modifier that calls the given hook with the root Cobra
+// command, as an escape hatch for anything Cobra supports but climate doesn't
+// (custom ValidArgsFunction, SuggestFor, annotations etc.). Subcommands can be
+// reached via Find (root.Find([]string{"git", "export"}), for example).
+//
+// Note: the hook is called only after climate is done building (and preparing)
+// the whole command tree, so any mutations override climate's own setup.
+func WithCobraHook(hook func(*cobra.Command)) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.CobraHooks = append(opts.CobraHooks, hook)
+	}
+}
+
+// WithInput returns a modifier that makes Run read the input (for the prompts
+// of WithInteractive, for example) from the given reader instead of os.Stdin.
+func WithInput(r io.Reader) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Input = r
+	}
+}
+
+// WithOutput returns a modifier that makes Run write the output (help, version,
+// completion scripts etc.) to the given writer instead of os.Stdout.
+//
+// Note: by Cobra's convention, the usage printed along with usage errors also
+// goes to this writer (while the errors themselves go to the error writer).
+func WithOutput(w io.Writer) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Output = w
+	}
+}
+
+// WithError returns a modifier that makes Run write the errors (and logs, see
+// WithSlog) to the given writer instead of os.Stderr.
+func WithError(w io.Writer) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Error = w
+	}
+}
+
+func run(ctx context.Context, p internal.Plan, args []string, mods []func(*internal.RunOptions)) (int, error) {
+	opts := runOptions(mods)
+	cmd, err := build(p, opts)
+	if err != nil {
+		printRunError(opts, err)
+		return 1, err
+	}
+	return execute(ctx, cmd, opts, args)
+}
+
+// printRunError prints the errors Run runs into before even executing the
+// command (so, without Cobra printing them), as per the options.
+func printRunError(opts *internal.RunOptions, err error) {
+	w := opts.Error
+	if w == nil {
+		w = os.Stderr
+	}
+	switch {
+	case opts.ReturnError:
+	case opts.FormatError != nil:
+		printError(w, err, opts.FormatError)
+	default:
+		fmt.Fprintln(w, "Error:", err)
+	}
+}
+
+func execute(ctx context.Context, cmd *command, opts *internal.RunOptions, args []string) (int, error) {
+	if opts.ArgsFileExpansion {
+		expanded, _, err := expandArgsFiles(args, 0)
+		if err != nil {
+			err = ErrUsage(err)
+			printRunError(opts, err)
+			return exitCode(err), err
+		}
+		args = expanded
+	}
+	for _, transform := range opts.ArgsTransforms {
+		// Note: the transform gets a copy, so that it may modify it in place
+		// without touching the caller's args (os.Args, say).
+		args = transform(slices.Clone(args))
+	}
+	// Note: this needs to happen before looking for plugins, so that the
+	// subcommands still take precedence regardless of case.
+	if opts.CaseInsensitive {
+		args = normalizeCommandArgs(cmd.delegate, args)
+	}
+	ctx, signalled, stop := notifyContext(ctx, opts.Signals)
+	defer stop()
+	if opts.PluginPrefix != "" {
+		if path, ok := findPlugin(cmd.delegate, opts.PluginPrefix, args); ok {
+			return runPlugin(ctx, path, args[1:], signalled, opts)
+		}
 	}
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
 	// Cobra already prints the error to stderr, so just return exit code here.
-	return exitCode(p.Execute(ctx, md))
+	err := cmd.run(ctx, args)
+	// Note: the signal may just as well have arrived after the command is done,
+	// in which case it's not what the command exited with.
+	if sig := signalled(); sig != nil && errors.Is(err, context.Canceled) {
+		return signalExitCode(sig), err
+	}
+	return exitCode(err), err
+}
+
+// Run executes the given plan and returns the exit code.
+func Run(ctx context.Context, p internal.Plan, mods ...func(*internal.RunOptions)) int {
+	code, _ := run(ctx, p, os.Args[1:], mods)
+	return code
+}
+
+// RunE is similar to Run, except that it executes the given plan with the given
+// args (instead of os.Args) and returns the error (if any) along with the exit
+// code, for embedding the CLI (see WithReturnError). Errors in how the CLI was
+// invoked (unknown flags, missing args, ErrUsage etc.) are UsageErrors, while
+// errors returned by the func / method being run (or the hooks etc.) are
+// RuntimeErrors -- anything else is an error building the CLI itself (invalid
+// metadata, say).
+func RunE(ctx context.Context, p internal.Plan, args []string, mods ...func(*internal.RunOptions)) (int, error) {
+	return run(ctx, p, args, mods)
+}
+
+// Execute is similar to Run, except that it executes the given plan with the
+// given args (instead of os.Args) and returns everything written to stdout and
+// stderr (by climate, Cobra and the funcs / methods themselves) along with the
+// exit code and error, for testing.
+//
+//	stdout, stderr, code, err := climate.Execute(ctx, p, []string{"--help"})
+//
+// Note: Execute temporarily replaces os.Stdout and os.Stderr (to capture them),
+// so it's not safe to call concurrently (or with t.Parallel tests).
+func Execute(ctx context.Context, p internal.Plan, args []string, mods ...func(*internal.RunOptions)) (stdout, stderr string, code int, err error) {
+	return capture(func() (int, error) {
+		return run(ctx, p, args, mods)
+	})
+}
+
+// capture calls fn, capturing everything written to os.Stdout and os.Stderr in
+// the meantime (see Execute).
+func capture(fn func() (int, error)) (stdout, stderr string, code int, err error) {
+	var (
+		stdoutR, stdoutW, err1 = os.Pipe()
+		stderrR, stderrW, err2 = os.Pipe()
+		osStdout, osStderr     = os.Stdout, os.Stderr
+	)
+	assert.Nil(errors.Join(err1, err2))
+	// Read the pipes concurrently, so that writes don't block (and deadlock)
+	// once the output exceeds the pipe capacity.
+	read := func(r *os.File, s *string) <-chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			*s = string(assert.Ok(io.ReadAll(r)))
+			assert.Nil(r.Close())
+		}()
+		return done
+	}
+	stdoutDone, stderrDone := read(stdoutR, &stdout), read(stderrR, &stderr)
+	os.Stdout, os.Stderr = stdoutW, stderrW
+	defer func() {
+		os.Stdout, os.Stderr = osStdout, osStderr
+	}()
+	code, err = fn()
+	assert.Nil(errors.Join(stdoutW.Close(), stderrW.Close()))
+	<-stdoutDone
+	<-stderrDone
+	return stdout, stderr, code, err
 }
 
 // RunAndExit executes the given plan and exits with the exit code.
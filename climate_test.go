@@ -0,0 +1,4313 @@
+package climate_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate"
+	"github.com/avamsi/climate/internal"
+)
+
+type result struct {
+	stdout, stderr string
+	code           int
+}
+
+func run(t *testing.T, p internal.Plan, args []string, mods ...func(*internal.RunOptions)) result {
+	t.Helper()
+	// TODO(golang/go#36532): replace with t.Context().
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdout, stderr, code, _ := climate.Execute(ctx, p, args, mods...)
+	return result{stdout, stderr, code}
+}
+
+func diff(t *testing.T, want, got result) {
+	t.Helper()
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(result{})); diff != "" {
+		t.Errorf("want:\n%+v", want)
+		t.Errorf("got:\n%+v", got)
+		t.Errorf("diff(-want +got):\n%v", diff)
+	}
+}
+
+const pkgPath = "github.com/avamsi/climate_test"
+
+// metadata returns encoded metadata for the given (package level) funcs, only
+// recording their param names (which is enough to compute usage strings).
+func metadata(params map[string][]string) []byte {
+	var rmd internal.RawMetadata
+	for name, ps := range params {
+		rmd.Child(pkgPath).Child(name).Params = ps
+	}
+	return rmd.Encode()
+}
+
+func cp(args []string) {}
+
+func TestWithArgs(t *testing.T) {
+	var (
+		p  = climate.Func(cp, climate.WithArgs(climate.RangeArgs(2, 3)))
+		md = climate.WithMetadata(metadata(map[string][]string{"cp": {"args"}}))
+	)
+	tests := []struct {
+		name string
+		args []string
+		want result
+	}{
+		{
+			name: "help",
+			args: []string{"--help"},
+			want: result{
+				stdout: `Usage:
+  cp <args> <args> [args]
+
+Flags:
+  -h, --help  help for cp
+`,
+			},
+		},
+		{
+			name: "too-few",
+			args: []string{"a"},
+			want: result{
+				stderr: `Error: cp accepts at least 2 arg(s), received 1
+Usage:
+  cp <args> <args> [args]
+
+Flags:
+  -h, --help  help for cp
+
+`,
+				code: 2,
+			},
+		},
+		{
+			name: "too-many",
+			args: []string{"a", "b", "c", "d"},
+			want: result{
+				stderr: `Error: cp accepts at most 3 arg(s), received 4
+Usage:
+  cp <args> <args> [args]
+
+Flags:
+  -h, --help  help for cp
+
+`,
+				code: 2,
+			},
+		},
+		{
+			name: "just-right",
+			args: []string{"a", "b"},
+			want: result{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff(t, test.want, run(t, p, test.args, md))
+		})
+	}
+}
+
+func bookmark(name string) {}
+
+func show(rev *string) {}
+
+func swap(files [2]string) {}
+
+func TestSingleArgs(t *testing.T) {
+	md := climate.WithMetadata(metadata(map[string][]string{
+		"bookmark": {"name"},
+		"show":     {"rev"},
+		"swap":     {"files"},
+	}))
+	tests := []struct {
+		name string
+		p    internal.Plan
+		args []string
+		err  string
+	}{
+		{"string-missing", climate.Func(bookmark), nil, "bookmark: missing argument: name"},
+		{"string-extra", climate.Func(bookmark), []string{"a", "b"}, "bookmark accepts 1 arg(s), received 2"},
+		{"pointer-extra", climate.Func(show), []string{"a", "b"}, "show accepts at most 1 arg(s), received 2"},
+		{"array", climate.Func(swap), []string{"a"}, "swap accepts 2 arg(s), received 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := run(t, test.p, test.args, md)
+			if want := "Error: " + test.err + "\nUsage:\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+				t.Errorf("run(%q) = %+v, want prefix %q and code 2", test.args, got, want)
+			}
+		})
+	}
+}
+
+type dupOptions struct {
+	Verbose bool `cli:"short"`
+	Version bool `cli:"short=v"`
+}
+
+func dup(opts *dupOptions) {}
+
+func TestDuplicateShorthand(t *testing.T) {
+	defer func() {
+		var (
+			got  = recover()
+			want = "same shorthand -v for both Verbose and Version: climate_test.dupOptions"
+		)
+		if got != want {
+			t.Errorf("recover() = %v, want %v", got, want)
+		}
+	}()
+	run(t, climate.Func(dup), nil)
+}
+
+type uploadOptions struct {
+	Input  string `cli:"required"`
+	Output string `cli:"required"`
+}
+
+func upload(opts *uploadOptions) {}
+
+func TestRequiredFlags(t *testing.T) {
+	want := result{
+		stderr: `Error: required flag(s) "input", "output" not set
+Usage:
+  upload [flags]
+
+Flags:
+      --input  string  
+      --output string  
+  -h, --help           help for upload
+
+`,
+		code: 2,
+	}
+	diff(t, want, run(t, climate.Func(upload), nil))
+}
+
+type requiredDefaultOptions struct {
+	Output string `cli:"required" default:"out"`
+}
+
+func requiredDefault(opts *requiredDefaultOptions) {}
+
+func TestRequiredFlagWithDefault(t *testing.T) {
+	defer func() {
+		if got, want := recover(), "both required and default: Output"; got != want {
+			t.Errorf("recover() = %v, want %v", got, want)
+		}
+	}()
+	run(t, climate.Func(requiredDefault), nil)
+}
+
+type deployOptions struct {
+	Token string `cli:"env=DEPLOY_TOKEN"`
+	Count int    `default:"1"`
+}
+
+func deploy(opts *deployOptions) {
+	fmt.Println(opts.Token, opts.Count)
+}
+
+func TestEnv(t *testing.T) {
+	var (
+		p      = climate.Func(deploy)
+		prefix = climate.WithEnvPrefix("MYAPP")
+	)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  deploy [flags]
+
+Flags:
+      --token string (env $DEPLOY_TOKEN)             
+      --count int    (default 1) (env $MYAPP_COUNT)  
+  -h, --help                                         help for deploy
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}, prefix))
+	})
+	t.Run("default", func(t *testing.T) {
+		diff(t, result{stdout: " 1\n"}, run(t, p, nil, prefix))
+	})
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("DEPLOY_TOKEN", "t0k3n")
+		t.Setenv("MYAPP_COUNT", "3")
+		diff(t, result{stdout: "t0k3n 3\n"}, run(t, p, nil, prefix))
+	})
+	t.Run("flag>env", func(t *testing.T) {
+		t.Setenv("MYAPP_COUNT", "3")
+		diff(t, result{stdout: " 5\n"}, run(t, p, []string{"--count=5"}, prefix))
+	})
+	t.Run("no-prefix", func(t *testing.T) {
+		t.Setenv("MYAPP_COUNT", "3")
+		diff(t, result{stdout: " 1\n"}, run(t, p, nil))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("MYAPP_COUNT", "three")
+		want := result{
+			stderr: `Error: $MYAPP_COUNT: invalid argument "three" for "--count" flag: strconv.ParseInt: parsing "three": invalid syntax
+Usage:
+  deploy [flags]
+
+Flags:
+      --token string (env $DEPLOY_TOKEN)             
+      --count int    (default 1) (env $MYAPP_COUNT)  
+  -h, --help                                         help for deploy
+
+`,
+			code: 2,
+		}
+		diff(t, want, run(t, p, nil, prefix))
+	})
+}
+
+type format string
+
+func (format) Values() []string {
+	return []string{"json", "yaml", "text"}
+}
+
+type exportOptions struct {
+	Format format `cli:"short" default:"text"`
+	Color  string `cli:"enum=auto|always|never" default:"auto"`
+}
+
+func export(opts *exportOptions) {
+	fmt.Println(opts.Format, opts.Color)
+}
+
+func TestEnum(t *testing.T) {
+	p := climate.Func(export)
+	t.Run("default", func(t *testing.T) {
+		diff(t, result{stdout: "text auto\n"}, run(t, p, nil))
+	})
+	t.Run("valid", func(t *testing.T) {
+		args := []string{"-f", "json", "--color=never"}
+		diff(t, result{stdout: "json never\n"}, run(t, p, args))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		want := result{
+			stderr: `Error: invalid argument "xml" for "-f, --format" flag: must be one of json, yaml, text
+Usage:
+  export [flags]
+
+Flags:
+  -f, --format string (default text)  
+      --color  string (default auto)  
+  -h, --help                          help for export
+
+`,
+			code: 2,
+		}
+		diff(t, want, run(t, p, []string{"--format=xml"}))
+	})
+	t.Run("complete", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--color", "a"})
+		diff(t, result{stdout: "auto\nalways\n:4\n"}, result{stdout: got.stdout})
+	})
+	t.Run("complete-descriptions", func(t *testing.T) {
+		var rmd internal.RawMetadata
+		for name, comment := range map[string]string{"JSON": "output as JSON", "YAML": ""} {
+			md := rmd.Child(pkgPath).Child("format").Child(name)
+			md.Value, md.Comment = strings.ToLower(name), comment
+		}
+		md := climate.WithMetadata(rmd.Encode())
+		got := run(t, p, []string{"__complete", "--format", ""}, md)
+		diff(t, result{stdout: "json\toutput as JSON\nyaml\ntext\n:4\n"}, result{stdout: got.stdout})
+	})
+}
+
+type mapDefaults map[string]string
+
+func (d mapDefaults) Default(flag string) (string, bool) {
+	v, ok := d[flag]
+	return v, ok
+}
+
+func TestWithDefaults(t *testing.T) {
+	var (
+		p        = climate.Func(export)
+		defaults = climate.WithDefaults(mapDefaults{"color": "never"})
+	)
+	t.Run("defaults", func(t *testing.T) {
+		diff(t, result{stdout: "text never\n"}, run(t, p, nil, defaults))
+	})
+	t.Run("flag>defaults", func(t *testing.T) {
+		diff(t, result{stdout: "text always\n"}, run(t, p, []string{"--color=always"}, defaults))
+	})
+	t.Run("env>defaults", func(t *testing.T) {
+		t.Setenv("EXPORT_COLOR", "always")
+		got := run(t, p, nil, defaults, climate.WithEnvPrefix("EXPORT"))
+		diff(t, result{stdout: "text always\n"}, got)
+	})
+	t.Run("first-wins", func(t *testing.T) {
+		more := climate.WithDefaults(mapDefaults{"color": "always", "format": "json"})
+		diff(t, result{stdout: "json never\n"}, run(t, p, nil, defaults, more))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		want := result{
+			stderr: `Error: defaults: invalid argument "xml" for "-f, --format" flag: must be one of json, yaml, text
+Usage:
+  export [flags]
+
+Flags:
+  -f, --format string (default text)  
+      --color  string (default auto)  
+  -h, --help                          help for export
+
+`,
+			code: 2,
+		}
+		diff(t, want, run(t, p, nil, climate.WithDefaults(mapDefaults{"format": "xml"})))
+	})
+}
+
+type remote struct {
+	Verbose bool `cli:"short"`
+}
+
+func (r *remote) Add(name string) {}
+
+func (r *remote) Remove(names []string) {}
+
+func TestGenManTree(t *testing.T) {
+	dir := t.TempDir()
+	err := climate.GenManTree(climate.Struct[remote](), dir, climate.WithManSection("7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range assert.Ok(os.ReadDir(dir)) {
+		got = append(got, e.Name())
+	}
+	if want := []string{"remote-add.7", "remote-remove.7", "remote.7"}; !cmp.Equal(got, want) {
+		t.Errorf("GenManTree(...) = %v, want %v", got, want)
+	}
+}
+
+func TestDescribeJSON(t *testing.T) {
+	got, err := climate.DescribeJSON(climate.Struct[remote]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "version": 1,
+  "command": {
+    "name": "remote",
+    "path": "remote",
+    "usage": "remote [flags]",
+    "flags": [
+      {
+        "name": "verbose",
+        "shorthand": "v",
+        "type": "bool",
+        "default": "false",
+        "persistent": true
+      }
+    ],
+    "commands": [
+      {
+        "name": "add",
+        "path": "remote add",
+        "usage": "remote add [flags]",
+        "args": {
+          "names": [
+            "args"
+          ],
+          "min": 1,
+          "max": 1
+        }
+      },
+      {
+        "name": "remove",
+        "path": "remote remove",
+        "usage": "remote remove [flags]",
+        "args": {
+          "names": [
+            "args"
+          ],
+          "min": 0,
+          "max": -1
+        }
+      }
+    ]
+  }
+}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("DescribeJSON(...) diff(-want +got):\n%v", diff)
+	}
+	t.Run("args", func(t *testing.T) {
+		type args struct {
+			Names    []string
+			Min, Max int
+		}
+		describeArgs := func(p internal.Plan, mods ...func(*internal.RunOptions)) map[string]args {
+			t.Helper()
+			b, err := climate.DescribeJSON(p, mods...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var d struct {
+				Command struct {
+					Name     string
+					Args     *args
+					Commands []struct {
+						Name string
+						Args *args
+					}
+				}
+			}
+			if err := json.Unmarshal(b, &d); err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]args{}
+			if d.Command.Args != nil {
+				got[d.Command.Name] = *d.Command.Args
+			}
+			for _, c := range d.Command.Commands {
+				if c.Args != nil {
+					got[c.Name] = *c.Args
+				}
+			}
+			return got
+		}
+		var rmd internal.RawMetadata
+		rmd.Child(pkgPath).Child("remote").Child("Add").Params = []string{"name"}
+		p := climate.Method(climate.Struct[remote](), "Remove", climate.WithArgNames("first", "second"))
+		want := map[string]args{
+			"add":    {Names: []string{"name"}, Min: 1, Max: 1},
+			"remove": {Names: []string{"first", "second", "args"}, Min: 0, Max: -1},
+		}
+		if diff := cmp.Diff(want, describeArgs(p, climate.WithMetadata(rmd.Encode()))); diff != "" {
+			t.Errorf("DescribeJSON(remote) args diff(-want +got):\n%v", diff)
+		}
+		want = map[string]args{"copyfiles": {Names: []string{"src", "dst", "extra"}, Min: 2, Max: -1}}
+		if diff := cmp.Diff(want, describeArgs(climate.Func(copyFiles))); diff != "" {
+			t.Errorf("DescribeJSON(copyFiles) args diff(-want +got):\n%v", diff)
+		}
+	})
+}
+
+func TestGenMarkdownTree(t *testing.T) {
+	dir := t.TempDir()
+	if err := climate.GenMarkdownTree(climate.Struct[remote](), dir); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file, want string
+	}{
+		{
+			file: "remote.md",
+			want: `## remote
+
+### Synopsis
+
+` + "```" + `
+remote [command]
+` + "```" + `
+
+### Flags
+
+| Flag | Short | Type | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`--verbose` | `-v`" + ` |  |  |  |
+| ` + "`--help` | `-h`" + ` |  |  | help for remote |
+
+### See Also
+
+* [remote add](remote_add.md)
+* [remote remove](remote_remove.md)
+`,
+		},
+		{
+			file: "remote_add.md",
+			want: `## remote add
+
+### Synopsis
+
+` + "```" + `
+remote add [flags]
+` + "```" + `
+
+### Flags
+
+| Flag | Short | Type | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`--help` | `-h`" + ` |  |  | help for add |
+
+### Global Flags
+
+| Flag | Short | Type | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`--verbose` | `-v`" + ` |  |  |  |
+
+### See Also
+
+* [remote](remote.md)
+`,
+		},
+	}
+	for _, test := range tests {
+		got := string(assert.Ok(os.ReadFile(filepath.Join(dir, test.file))))
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%v: want:\n%v", test.file, test.want)
+			t.Errorf("%v: got:\n%v", test.file, got)
+			t.Errorf("%v: diff(-want +got):\n%v", test.file, diff)
+		}
+	}
+}
+
+func TestWithCobraHook(t *testing.T) {
+	hook := climate.WithCobraHook(func(root *cobra.Command) {
+		add, _, err := root.Find([]string{"add"})
+		assert.Nil(err)
+		add.Short = "Add a remote"
+	})
+	want := result{
+		stdout: `Usage:
+  remote [command]
+
+Available Commands:
+  add         Add a remote
+  completion  Generate the autocompletion script for the specified shell
+  help        Help about any command
+  remove      
+
+Flags:
+  -v, --verbose  
+  -h, --help     help for remote
+
+Use "remote [command] --help" for more information about a command.
+`,
+	}
+	diff(t, want, run(t, climate.Struct[remote](), nil, hook))
+}
+
+func TestWithVersion(t *testing.T) {
+	var (
+		v    = climate.WithVersion("1.4.0")
+		info = climate.WithVersionInfo(
+			climate.VersionInfo{Version: "1.4.0", Commit: "c0ffee", Date: "2024-12-07"},
+			"{{.Version}} ({{.Commit}}, {{.Date}})")
+	)
+	tests := []struct {
+		name string
+		p    internal.Plan
+		args []string
+		mod  func(*internal.RunOptions)
+		want result
+	}{
+		{
+			name: "func--version",
+			p:    climate.Func(cp),
+			args: []string{"--version"},
+			mod:  v,
+			want: result{stdout: "cp version 1.4.0\n"},
+		},
+		{
+			name: "struct-version",
+			p:    climate.Struct[remote](),
+			args: []string{"version"},
+			mod:  v,
+			want: result{stdout: "1.4.0\n"},
+		},
+		{
+			name: "struct--version-info",
+			p:    climate.Struct[remote](),
+			args: []string{"--version"},
+			mod:  info,
+			want: result{stdout: "1.4.0 (c0ffee, 2024-12-07)\n"},
+		},
+		{
+			name: "struct-version-info",
+			p:    climate.Struct[remote](),
+			args: []string{"version"},
+			mod:  info,
+			want: result{stdout: "1.4.0 (c0ffee, 2024-12-07)\n"},
+		},
+		{
+			name: "subcommand--version",
+			p:    climate.Struct[remote](),
+			args: []string{"remove", "--version"},
+			mod:  v,
+			want: result{
+				stderr: `Error: unknown flag: --version
+Usage:
+  remote remove [flags]
+
+Flags:
+  -h, --help  help for remove
+
+Global Flags:
+  -v, --verbose
+
+`,
+				code: 2,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff(t, test.want, run(t, test.p, test.args, test.mod))
+		})
+	}
+}
+
+type repeatOptions struct {
+	Word  string `cli:"arg"`
+	Times int    `cli:"arg"`
+	Rest  []int  `cli:"arg"`
+	Upper bool   `cli:"short"`
+}
+
+func repeat(opts *repeatOptions) {
+	fmt.Println(opts.Word, opts.Times, opts.Rest, opts.Upper)
+}
+
+func TestPositionals(t *testing.T) {
+	p := climate.Func(repeat)
+	usage := `Usage:
+  repeat <word> <times> [rest...] [flags]
+
+Flags:
+  -u, --upper  
+  -h, --help   help for repeat
+`
+	tests := []struct {
+		name string
+		args []string
+		want result
+	}{
+		{
+			name: "help",
+			args: []string{"--help"},
+			want: result{stdout: usage},
+		},
+		{
+			name: "exact",
+			args: []string{"hey", "2", "-u"},
+			want: result{stdout: "hey 2 [] true\n"},
+		},
+		{
+			name: "rest",
+			args: []string{"hey", "2", "44", "45"},
+			want: result{stdout: "hey 2 [44 45] false\n"},
+		},
+		{
+			name: "too-few",
+			args: []string{"hey"},
+			want: result{
+				stderr: "Error: repeat accepts at least 2 arg(s), received 1\n" + usage + "\n",
+				code:   2,
+			},
+		},
+		{
+			name: "mismatch",
+			args: []string{"hey", "two"},
+			want: result{
+				stderr: `Error: invalid argument "two" for <times>: strconv.ParseInt: parsing "two": invalid syntax` +
+					"\n" + usage + "\n",
+				code: 2,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff(t, test.want, run(t, p, test.args))
+		})
+	}
+}
+
+type loginOptions struct {
+	JSON     bool `cli:"exclusive=format"`
+	YAML     bool `cli:"exclusive=format"`
+	User     string
+	Password string
+}
+
+func login(opts *loginOptions) {
+	fmt.Println(opts.JSON, opts.YAML, opts.User, opts.Password)
+}
+
+func TestFlagGroups(t *testing.T) {
+	var (
+		p        = climate.Func(login)
+		together = climate.WithRequiredTogether("user", "password")
+	)
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "exclusive",
+			args: []string{"--json", "--yaml"},
+			want: "Error: if any flags in the group [json yaml] are set none of the others can be; [json yaml] were all set\n",
+		},
+		{
+			name: "together",
+			args: []string{"--user=me"},
+			want: "Error: if any flags in the group [user password] are set they must all be set; missing [password]\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := run(t, p, test.args, together)
+			if got.code != 2 || !strings.HasPrefix(got.stderr, test.want) {
+				t.Errorf("run(%v) = %+v, want prefix %q", test.args, got, test.want)
+			}
+		})
+	}
+	t.Run("ok", func(t *testing.T) {
+		args := []string{"--json", "--user=me", "--password=hunter2"}
+		diff(t, result{stdout: "true false me hunter2\n"}, run(t, p, args, together))
+	})
+}
+
+type traceOptions struct {
+	Trace bool `cli:"hidden"`
+	Size  int
+}
+
+func trace(opts *traceOptions) {
+	fmt.Println(opts.Trace, opts.Size)
+}
+
+func TestHidden(t *testing.T) {
+	t.Run("flag", func(t *testing.T) {
+		p := climate.Func(trace)
+		diff(t, result{stdout: "true 0\n"}, run(t, p, []string{"--trace"}))
+		want := result{
+			stdout: `Usage:
+  trace [flags]
+
+Flags:
+      --size int  
+  -h, --help      help for trace
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+		want = result{
+			stdout: `Usage:
+  trace [flags]
+
+Flags:
+      --trace      
+      --size  int  
+  -h, --help       help for trace
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help-hidden"}))
+	})
+	t.Run("bounded-args", func(t *testing.T) {
+		// Note: Cobra validates the args before running any of the pre-runs.
+		p := climate.Func(cp, climate.WithArgs(climate.ExactArgs(2)))
+		want := result{stdout: "Usage:\n  cp [flags]\n\nFlags:\n  -h, --help  help for cp\n"}
+		diff(t, want, run(t, p, []string{"--help-hidden"}))
+	})
+	t.Run("command", func(t *testing.T) {
+		var rmd internal.RawMetadata
+		rmd.Child(pkgPath).Child("remote").Child("Remove").Directives = map[string]string{"hidden": ""}
+		var (
+			p    = climate.Struct[remote]()
+			md   = climate.WithMetadata(rmd.Encode())
+			want = result{
+				stdout: `Usage:
+  remote [command]
+
+Available Commands:
+  add         
+  completion  Generate the autocompletion script for the specified shell
+  help        Help about any command
+
+Flags:
+  -v, --verbose  
+  -h, --help     help for remote
+
+Use "remote [command] --help" for more information about a command.
+`,
+			}
+		)
+		diff(t, want, run(t, p, []string{"--help"}, md))
+		diff(t, result{}, run(t, p, []string{"remove", "origin"}, md))
+	})
+}
+
+type renameOptions struct {
+	Dest   string `cli:"deprecated=use --output instead"`
+	Output string
+}
+
+func rename(opts *renameOptions) {
+	fmt.Println(opts.Dest, opts.Output)
+}
+
+func TestDeprecated(t *testing.T) {
+	t.Run("flag", func(t *testing.T) {
+		want := result{
+			stdout: "out \n",
+			stderr: "Flag --dest has been deprecated, use --output instead\n",
+		}
+		diff(t, want, run(t, climate.Func(rename), []string{"--dest=out"}))
+	})
+	t.Run("command", func(t *testing.T) {
+		var rmd internal.RawMetadata
+		rmd.Child(pkgPath).Child("remote").Child("Remove").Directives = map[string]string{
+			"deprecated": "use rm instead",
+		}
+		var (
+			p    = climate.Struct[remote]()
+			md   = climate.WithMetadata(rmd.Encode())
+			want = result{stderr: "Command \"remove\" is deprecated, use rm instead\n"}
+		)
+		diff(t, want, run(t, p, []string{"remove", "origin"}, md))
+	})
+}
+
+type notFoundError struct {
+	name string
+}
+
+func (nferr *notFoundError) Error() string {
+	return nferr.name + " not found"
+}
+
+func (nferr *notFoundError) ExitCode() int {
+	return 2
+}
+
+func find(name string) error {
+	return fmt.Errorf("find: %w", &notFoundError{name})
+}
+
+func TestExitCoder(t *testing.T) {
+	want := result{stderr: "Error: find: x not found\n", code: 2}
+	diff(t, want, run(t, climate.Func(find), []string{"x"}))
+}
+
+func deny(name string) error {
+	if name == "quietly" {
+		return climate.ErrExit(3)
+	}
+	return climate.ErrExit(3, errors.New("permission denied"))
+}
+
+func TestErrExit(t *testing.T) {
+	p := climate.Func(deny)
+	diff(t, result{stderr: "Error: permission denied\n", code: 3}, run(t, p, []string{"loudly"}))
+	diff(t, result{code: 3}, run(t, p, []string{"quietly"}))
+}
+
+func batch(names []string) error {
+	var errs []error
+	for _, name := range names {
+		switch name {
+		case "missing":
+			errs = append(errs, &notFoundError{name})
+		case "denied":
+			errs = append(errs, climate.ErrExit(3), fmt.Errorf("%v: permission denied", name))
+		case "quiet":
+			errs = append(errs, climate.ErrExit(4))
+		case "wrapped":
+			errs = append(errs, fmt.Errorf("batch: %w", climate.ErrExit(4)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func TestJoinedErrors(t *testing.T) {
+	p := climate.Func(batch)
+	t.Run("exit-code", func(t *testing.T) {
+		want := result{stderr: "Error: missing not found\ndenied: permission denied\n", code: 3}
+		diff(t, want, run(t, p, []string{"ok", "missing", "denied"}))
+	})
+	t.Run("exit-coder", func(t *testing.T) {
+		diff(t, result{stderr: "Error: missing not found\n", code: 2}, run(t, p, []string{"missing"}))
+	})
+	t.Run("quiet", func(t *testing.T) {
+		diff(t, result{code: 4}, run(t, p, []string{"quiet", "quiet"}))
+	})
+	t.Run("wrapped", func(t *testing.T) {
+		diff(t, result{stderr: "Error: batch\n", code: 4}, run(t, p, []string{"wrapped", "quiet"}))
+	})
+}
+
+func parse(format string) error {
+	if format != "json" {
+		return climate.ErrUsage(fmt.Errorf("unknown format: %v", format))
+	}
+	return errors.New("parse failed")
+}
+
+func TestErrUsage(t *testing.T) {
+	p := climate.Func(parse)
+	got := run(t, p, []string{"xml"})
+	if want := "Error: unknown format: xml\nUsage:\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+		t.Errorf("run(xml) = %+v, want prefix %q and code 2", got, want)
+	}
+	diff(t, result{stderr: "Error: parse failed\n", code: 1}, run(t, p, []string{"json"}))
+}
+
+func TestExecute(t *testing.T) {
+	stdout, stderr, code, err := climate.Execute(context.Background(), climate.Func(deny), []string{"loudly"})
+	if stdout != "" || stderr != "Error: permission denied\n" || code != 3 || err == nil || err.Error() != "permission denied" {
+		t.Errorf("Execute(deny, loudly) = %q, %q, %v, %v", stdout, stderr, code, err)
+	}
+}
+
+// interrupt interrupts itself and then waits for the context to be cancelled.
+func interrupt(ctx context.Context) error {
+	assert.Nil(syscall.Kill(os.Getpid(), syscall.SIGINT))
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithSignals(t *testing.T) {
+	p := climate.Func(interrupt)
+	want := result{stderr: "Error: context canceled\n", code: 130}
+	diff(t, want, run(t, p, nil, climate.WithSignals(os.Interrupt, syscall.SIGTERM)))
+	t.Run("completed", func(t *testing.T) {
+		p := climate.Func(func(ctx context.Context) error {
+			// The func handles the cancellation itself and completes fine.
+			_ = interrupt(ctx)
+			return nil
+		})
+		diff(t, result{}, run(t, p, nil, climate.WithSignals(os.Interrupt)))
+	})
+}
+
+type tagOptions struct {
+	Names  []string          `cli:"short"`
+	Ports  []int             `cli:"delim=;" default:"80;443"`
+	Labels map[string]string `cli:"short"`
+}
+
+func tag(opts *tagOptions) {
+	fmt.Println(opts.Names, opts.Ports, opts.Labels)
+}
+
+func TestSliceAndMapFlags(t *testing.T) {
+	p := climate.Func(tag)
+	t.Run("default", func(t *testing.T) {
+		diff(t, result{stdout: "[] [80 443] map[]\n"}, run(t, p, nil))
+	})
+	t.Run("repeated", func(t *testing.T) {
+		args := []string{"-n", "a,b", "-n", "c", "--ports=1;2", "--ports", "3", "-l", "k=v", "-l", "x=y"}
+		diff(t, result{stdout: "[a b c] [1 2 3] map[k:v x:y]\n"}, run(t, p, args))
+	})
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  tag [flags]
+
+Flags:
+  -n, --names  strings        (repeatable)                     
+      --ports  int64Slice     (default [80;443]) (repeatable)  
+  -l, --labels stringToString (repeatable)                     
+  -h, --help                                                   help for tag
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		got := run(t, p, []string{"--ports=1;x"})
+		want := `Error: invalid argument "1;x" for "--ports" flag: strconv.ParseInt: parsing "x": invalid syntax`
+		if !strings.HasPrefix(got.stderr, want+"\n") || got.code != 2 {
+			t.Errorf("run(--ports=1;x) = %+v, want %q", got, want)
+		}
+	})
+}
+
+type logOptions struct {
+	Verbose int `cli:"short,count"` // increase verbosity
+	Quiet   int `cli:"count" default:"1"`
+}
+
+func log(opts *logOptions) {
+	fmt.Println(opts.Verbose, opts.Quiet)
+}
+
+func TestCountFlags(t *testing.T) {
+	p := climate.Func(log)
+	t.Run("default", func(t *testing.T) {
+		diff(t, result{stdout: "0 1\n"}, run(t, p, nil))
+	})
+	t.Run("repeated", func(t *testing.T) {
+		diff(t, result{stdout: "3 3\n"}, run(t, p, []string{"-vvv", "--quiet", "--quiet"}))
+	})
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  log [flags]
+
+Flags:
+  -v, --verbose count (repeatable)              
+      --quiet   count (default 1) (repeatable)  
+  -h, --help                                    help for log
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+}
+
+type toolbox struct {
+	Verbose bool `cli:"short"`
+	Dry     bool
+	Scratch bool `cli:"local"`
+}
+
+type hammerOptions struct {
+	Dry bool
+}
+
+func (tb *toolbox) Hammer(opts *hammerOptions) {
+	fmt.Println(tb.Verbose, tb.Dry, opts.Dry)
+}
+
+func TestPersistentFlags(t *testing.T) {
+	p := climate.Struct[toolbox]()
+	t.Run("inherited", func(t *testing.T) {
+		diff(t, result{stdout: "true false false\n"}, run(t, p, []string{"hammer", "-v"}))
+	})
+	t.Run("shadowed", func(t *testing.T) {
+		diff(t, result{stdout: "false false true\n"}, run(t, p, []string{"hammer", "--dry"}))
+	})
+	t.Run("local", func(t *testing.T) {
+		got := run(t, p, []string{"hammer", "--scratch"})
+		if want := "Error: unknown flag: --scratch\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(hammer --scratch) = %+v, want %q", got, want)
+		}
+	})
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  toolbox hammer [flags]
+
+Flags:
+      --dry   
+  -h, --help  help for hammer
+
+Global Flags:
+  -v, --verbose
+`,
+		}
+		diff(t, want, run(t, p, []string{"hammer", "--help"}))
+	})
+}
+
+func TestWithTemplates(t *testing.T) {
+	var (
+		p  = climate.Func(export)
+		md = func() []byte {
+			var rmd internal.RawMetadata
+			rmd.Child(pkgPath).Child("export").Doc = "Export the thing."
+			return rmd.Encode()
+		}()
+		help  = climate.WithHelpTemplate("{{.Long}}\n\n{{.UsageString}}")
+		usage = climate.WithUsageTemplate("usage: {{.UseLine}}\n{{.LocalFlags | flagUsages}}")
+	)
+	want := result{
+		stdout: `Export the thing.
+
+usage: export
+  -f, --format string (default text)  
+      --color  string (default auto)  
+  -h, --help                          help for export
+`,
+	}
+	diff(t, want, run(t, p, []string{"--help"}, climate.WithMetadata(md), help, usage))
+}
+
+func TestWithColor(t *testing.T) {
+	p := climate.Struct[remote]()
+	t.Run("help", func(t *testing.T) {
+		ansi := strings.NewReplacer("<b>", "\x1b[1m", "<c>", "\x1b[36m", "</>", "\x1b[0m")
+		want := result{
+			stdout: ansi.Replace(`<b>Usage:</>
+  remote [command]
+
+<b>Available Commands:</>
+  <c>add</>         
+  <c>completion</>  Generate the autocompletion script for the specified shell
+  <c>help</>        Help about any command
+  <c>remove</>      
+
+<b>Flags:</>
+  <c>-v, --verbose</>  
+  <c>-h, --help</>     help for remote
+
+Use "remote [command] --help" for more information about a command.
+`),
+		}
+		diff(t, want, run(t, p, []string{"--help"}, climate.WithColor(true)))
+	})
+	t.Run("compiled", func(t *testing.T) {
+		cp, err := climate.Compile(p, climate.WithColor(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The subcommand help should go to the current stdout on every run.
+		for range 2 {
+			stdout, _, _, _ := cp.Execute(context.Background(), []string{"add", "--help"})
+			if want := "\x1b[1mUsage:\x1b[0m\n  remote add"; !strings.HasPrefix(stdout, want) {
+				t.Errorf("Execute(add --help) = %q, want prefix %q", stdout, want)
+			}
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		got := run(t, p, []string{"--bad"}, climate.WithColor(true))
+		if want := "\x1b[31mError:\x1b[0m unknown flag: --bad\n"; !strings.HasPrefix(got.stderr, want) {
+			t.Errorf("run(--bad) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("no-color", func(t *testing.T) {
+		got := run(t, p, []string{"--help"})
+		if strings.Contains(got.stdout, "\x1b[") {
+			t.Errorf("run(--help) = %q, want no color", got.stdout)
+		}
+	})
+}
+
+func TestWithInteractive(t *testing.T) {
+	p := climate.Func(upload)
+	t.Run("stdin", func(t *testing.T) {
+		// stdin is not a terminal here, so we should just error out as usual.
+		got := run(t, p, nil, climate.WithInteractive())
+		if want := "Error: required flag(s) \"input\", \"output\" not set\n"; !strings.HasPrefix(got.stderr, want) {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("input", func(t *testing.T) {
+		in := climate.WithInput(strings.NewReader("a.txt\nb.txt\n"))
+		diff(t, result{stderr: "--input: --output: "}, run(t, p, nil, climate.WithInteractive(), in))
+	})
+}
+
+type loadOptions struct {
+	Config string `cli:"complete=file:json|yaml"`
+	Dir    string `cli:"complete=dir"`
+}
+
+func load(opts *loadOptions) {}
+
+func TestCompleteFiles(t *testing.T) {
+	p := climate.Func(load)
+	t.Run("file", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--config", ""})
+		diff(t, result{stdout: "json\nyaml\n:8\n"}, result{stdout: got.stdout})
+	})
+	t.Run("dir", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--dir", ""})
+		diff(t, result{stdout: ":16\n"}, result{stdout: got.stdout})
+	})
+}
+
+type checkoutOptions struct {
+	Branch string
+}
+
+func checkout(opts *checkoutOptions) {}
+
+func TestWithCompletion(t *testing.T) {
+	var (
+		p        = climate.Func(checkout)
+		branches = climate.WithCompletion("branch", func(_ context.Context, toComplete string) ([]string, error) {
+			if toComplete == "x" {
+				return nil, errors.New("no branches")
+			}
+			return []string{toComplete + "-main", toComplete + "-dev"}, nil
+		})
+	)
+	t.Run("complete", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--branch", "b"}, branches)
+		diff(t, result{stdout: "b-main\nb-dev\n:4\n"}, result{stdout: got.stdout})
+	})
+	t.Run("error", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--branch", "x"}, branches)
+		diff(t, result{stdout: ":1\n"}, result{stdout: got.stdout})
+	})
+	t.Run("no-flag", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "no flag for completion: tag"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, p, nil, climate.WithCompletion("tag", nil))
+	})
+}
+
+func TestWithArgCompletion(t *testing.T) {
+	p := climate.Func(cp, climate.WithArgCompletion(func(_ context.Context, args []string, toComplete string) ([]string, error) {
+		if len(args) > 0 {
+			return nil, errors.New("no more args")
+		}
+		return []string{toComplete + "-src", toComplete + "-dst"}, nil
+	}))
+	t.Run("first", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "a"})
+		diff(t, result{stdout: "a-src\na-dst\n:4\n"}, result{stdout: got.stdout})
+	})
+	t.Run("second", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "a-src", "b"})
+		diff(t, result{stdout: ":1\n"}, result{stdout: got.stdout})
+	})
+	t.Run("no-args", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "arg completion without args: func()"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		none := func(context.Context, []string, string) ([]string, error) { return nil, nil }
+		run(t, climate.Func(func() {}, climate.WithArgCompletion(none)), nil)
+	})
+}
+
+func TestAliases(t *testing.T) {
+	aliases := func(v string) func(*internal.RunOptions) {
+		var rmd internal.RawMetadata
+		rmd.Child(pkgPath).Child("remote").Child("Remove").Directives = map[string]string{"aliases": v}
+		return climate.WithMetadata(rmd.Encode())
+	}
+	p := climate.Struct[remote]()
+	t.Run("alias", func(t *testing.T) {
+		diff(t, result{}, run(t, p, []string{"rm", "origin"}, aliases("rm,delete")))
+	})
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  remote remove
+
+Aliases:
+  remove, rm, delete
+
+Flags:
+  -h, --help  help for remove
+
+Global Flags:
+  -v, --verbose
+`,
+		}
+		diff(t, want, run(t, p, []string{"rm", "--help"}, aliases("rm,delete")))
+	})
+	t.Run("suggestions", func(t *testing.T) {
+		want := result{
+			stderr: `Error: unknown command "delet" for "remote"
+
+Did you mean this?
+	remove
+
+Run 'remote --help' for usage.
+`,
+			code: 2,
+		}
+		diff(t, want, run(t, p, []string{"delet"}, aliases("rm,delete")))
+	})
+	t.Run("collision", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "same name or alias add for both add and remove: remote"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, p, nil, aliases("add"))
+	})
+}
+
+func TestGroups(t *testing.T) {
+	var rmd internal.RawMetadata
+	for _, m := range []string{"Add", "Remove"} {
+		rmd.Child(pkgPath).Child("remote").Child(m).Directives = map[string]string{"group": "Management"}
+	}
+	var (
+		p    = climate.Struct[remote]()
+		md   = climate.WithMetadata(rmd.Encode())
+		want = result{
+			stdout: `Usage:
+  remote [command]
+
+Management Commands:
+  add         
+  remove      
+
+Other Commands:
+  completion  Generate the autocompletion script for the specified shell
+  help        Help about any command
+
+Flags:
+  -v, --verbose  
+  -h, --help     help for remote
+
+Use "remote [command] --help" for more information about a command.
+`,
+		}
+	)
+	diff(t, want, run(t, p, []string{"--help"}, md))
+}
+
+type repo struct {
+	Verbose bool `cli:"short"`
+}
+
+type statusOptions struct {
+	Short bool `cli:"short"`
+}
+
+func (r *repo) Status(opts *statusOptions, args []string) {
+	fmt.Println("status", r.Verbose, opts.Short, args)
+}
+
+func (r *repo) Commit() {
+	fmt.Println("commit")
+}
+
+func TestDefaultCommand(t *testing.T) {
+	var rmd internal.RawMetadata
+	rmd.Child(pkgPath).Child("repo").Child("Status").Directives = map[string]string{"default": ""}
+	var (
+		p  = climate.Struct[repo]()
+		md = climate.WithMetadata(rmd.Encode())
+	)
+	tests := []struct {
+		name string
+		args []string
+		want result
+	}{
+		{
+			name: "bare",
+			args: nil,
+			want: result{stdout: "status false false []\n"},
+		},
+		{
+			name: "flags-and-args",
+			args: []string{"-v", "-s", "a", "b"},
+			want: result{stdout: "status true true [a b]\n"},
+		},
+		{
+			name: "explicit",
+			args: []string{"commit"},
+			want: result{stdout: "commit\n"},
+		},
+		{
+			name: "typo",
+			args: []string{"comit"},
+			want: result{
+				stderr: `Error: unknown command "comit" for "repo"
+
+Did you mean this?
+	commit
+
+Run 'repo --help' for usage.
+`,
+				code: 2,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff(t, test.want, run(t, p, test.args, md))
+		})
+	}
+	t.Run("help", func(t *testing.T) {
+		if got := run(t, p, []string{"--help"}, md); !strings.Contains(got.stdout, "Available Commands:") {
+			t.Errorf("run(--help) = %+v, want root help", got)
+		}
+	})
+	t.Run("more-than-one", func(t *testing.T) {
+		rmd.Child(pkgPath).Child("repo").Child("Commit").Directives = map[string]string{"default": ""}
+		defer func() {
+			if got, want := recover(), "more than one default (commit and status): repo"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, p, nil, climate.WithMetadata(rmd.Encode()))
+	})
+}
+
+func TestWithCompletionCommand(t *testing.T) {
+	p := climate.Func(cp)
+	t.Run("script", func(t *testing.T) {
+		got := run(t, p, []string{"completion", "zsh"}, climate.WithCompletionCommand())
+		if want := "#compdef cp\n"; !strings.HasPrefix(got.stdout, want) || got.code != 0 {
+			t.Errorf("run(completion zsh) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("args", func(t *testing.T) {
+		diff(t, result{}, run(t, p, []string{"a", "b"}, climate.WithCompletionCommand()))
+	})
+	t.Run("no-command", func(t *testing.T) {
+		diff(t, result{}, run(t, p, []string{"completion", "zsh"}))
+	})
+}
+
+func TestWithMetadataFS(t *testing.T) {
+	p := climate.Func(cp, climate.WithArgs(climate.RangeArgs(2, 3)))
+	t.Run("default-path", func(t *testing.T) {
+		fsys := fstest.MapFS{"md.cli": {Data: metadata(map[string][]string{"cp": {"args"}})}}
+		got := run(t, p, []string{"--help"}, climate.WithMetadataFS(fsys, ""))
+		if want := "Usage:\n  cp <args> <args> [args]\n"; !strings.HasPrefix(got.stdout, want) {
+			t.Errorf("run(--help) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		want := result{stderr: "Error: climate: open md.cli: file does not exist\n", code: 1}
+		diff(t, want, run(t, p, nil, climate.WithMetadataFS(fstest.MapFS{}, "")))
+	})
+	t.Run("malformed", func(t *testing.T) {
+		fsys := fstest.MapFS{"meta/cli.gob": {Data: []byte("garbage")}}
+		got := run(t, p, nil, climate.WithMetadataFS(fsys, "meta/cli.gob"))
+		if want := "Error: climate: malformed metadata #1: "; !strings.HasPrefix(got.stderr, want) || got.code != 1 {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+func TestWithStrictMetadata(t *testing.T) {
+	var (
+		p      = climate.Struct[remote]()
+		strict = climate.WithStrictMetadata()
+	)
+	t.Run("ok", func(t *testing.T) {
+		var rmd internal.RawMetadata
+		for _, name := range []string{"Verbose", "Add", "Remove"} {
+			rmd.Child(pkgPath).Child("remote").Child(name)
+		}
+		diff(t, result{}, run(t, p, []string{"add", "origin"}, climate.WithMetadata(rmd.Encode()), strict))
+	})
+	t.Run("stale", func(t *testing.T) {
+		var rmd internal.RawMetadata
+		for _, name := range []string{"Add", "Gone"} {
+			rmd.Child(pkgPath).Child("remote").Child(name)
+		}
+		want := result{
+			stderr: `Error: climate: stale metadata:
+	metadata for nonexistent github.com/avamsi/climate_test.remote.Gone
+	missing metadata for github.com/avamsi/climate_test.remote.Remove
+	missing metadata for github.com/avamsi/climate_test.remote.Verbose
+`,
+			code: 1,
+		}
+		diff(t, want, run(t, p, nil, climate.WithMetadata(rmd.Encode()), strict))
+	})
+	t.Run("none", func(t *testing.T) {
+		want := result{stderr: "Error: climate: no metadata\n", code: 1}
+		diff(t, want, run(t, p, nil, strict))
+	})
+}
+
+func wait(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithTimeoutFlag(t *testing.T) {
+	var (
+		p       = climate.Func(wait)
+		timeout = climate.WithTimeoutFlag("timeout")
+	)
+	t.Run("timeout", func(t *testing.T) {
+		want := result{stderr: "Error: context deadline exceeded\n", code: 124}
+		diff(t, want, run(t, p, []string{"--timeout=10ms"}, timeout))
+	})
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  wait [flags]
+
+Flags:
+      --timeout duration  timeout for the command (e.g. 30s, 5m), 0 for no timeout
+  -h, --help              help for wait
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}, timeout))
+	})
+}
+
+type backupOptions struct {
+	Every time.Duration    `default:"1h"`
+	Since time.Time        `cli:"layout=2006-01-02"`
+	Limit climate.ByteSize `default:"1GiB"`
+}
+
+func backup(opts *backupOptions) {
+	fmt.Println(opts.Every, opts.Since.Format(time.DateOnly), int64(opts.Limit))
+}
+
+func TestDurationTimeAndByteSizeFlags(t *testing.T) {
+	p := climate.Func(backup)
+	t.Run("default", func(t *testing.T) {
+		diff(t, result{stdout: "1h0m0s 0001-01-01 1073741824\n"}, run(t, p, nil))
+	})
+	t.Run("set", func(t *testing.T) {
+		args := []string{"--every=90s", "--since=2024-02-29", "--limit=10MB"}
+		diff(t, result{stdout: "1m30s 2024-02-29 10000000\n"}, run(t, p, args))
+	})
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  backup [flags]
+
+Flags:
+      --every duration (default 1h0m0s)  
+      --since time                       
+      --limit bytes    (default 1GiB)    
+  -h, --help                             help for backup
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		got := run(t, p, []string{"--limit=10XB"})
+		if want := `Error: invalid argument "10XB" for "--limit" flag: invalid byte size "10XB": unknown unit "XB"`; !strings.HasPrefix(got.stderr, want+"\n") {
+			t.Errorf("run(--limit=10XB) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("complete", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--since", "t"})
+		diff(t, result{stdout: "today\n:4\n"}, result{stdout: got.stdout})
+	})
+}
+
+type fetchOptions struct {
+	Dest       string `cli:"name=output-dir,short"`
+	HTTPSProxy string
+	URL        string `cli:"required"`
+}
+
+func fetch(opts *fetchOptions) {
+	fmt.Println(opts.Dest, opts.HTTPSProxy, opts.URL)
+}
+
+func TestFlagNames(t *testing.T) {
+	p := climate.Func(fetch)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  fetch [flags]
+
+Flags:
+  -o, --output-dir  string  
+      --https-proxy string  
+      --url         string  
+  -h, --help                help for fetch
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+	t.Run("set", func(t *testing.T) {
+		args := []string{"-o", "out", "--https-proxy=proxy", "--url", "u"}
+		diff(t, result{stdout: "out proxy u\n"}, run(t, p, args))
+	})
+	t.Run("group", func(t *testing.T) {
+		args := []string{"--output-dir=out", "--https-proxy=proxy", "--url", "u"}
+		got := run(t, p, args, climate.WithMutuallyExclusive("output-dir", "https-proxy"))
+		if want := "Error: if any flags in the group [output-dir https-proxy] are set none of the others can be; [https-proxy output-dir] were all set\n"; !strings.HasPrefix(got.stderr, want) {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+func wrap(ctx context.Context, args []string) {
+	fmt.Println(args, climate.ArgsAfterDash(ctx))
+}
+
+func TestArgsAfterDash(t *testing.T) {
+	p := climate.Func(wrap)
+	diff(t, result{stdout: "[a ls -la] [ls -la]\n"}, run(t, p, []string{"a", "--", "ls", "-la"}))
+	diff(t, result{stdout: "[a] []\n"}, run(t, p, []string{"a", "--"}))
+	diff(t, result{stdout: "[a] []\n"}, run(t, p, []string{"a"}))
+}
+
+func serve(ctx context.Context) {
+	logger := climate.Logger(ctx)
+	logger.Debug("listening", "addr", ":8080")
+	logger.Info("serving")
+}
+
+func TestWithSlog(t *testing.T) {
+	p := climate.Func(serve)
+	t.Run("default", func(t *testing.T) {
+		got := run(t, p, nil, climate.WithSlog())
+		if !strings.Contains(got.stderr, "level=INFO msg=serving\n") || strings.Contains(got.stderr, "DEBUG") {
+			t.Errorf("run() = %+v, want only the info log", got)
+		}
+	})
+	t.Run("debug-json", func(t *testing.T) {
+		got := run(t, p, []string{"--log-level=debug", "--log-format=json"}, climate.WithSlog())
+		for _, want := range []string{`"level":"DEBUG","msg":"listening","addr":":8080"}`, `"level":"INFO","msg":"serving"}`} {
+			if !strings.Contains(got.stderr, want) {
+				t.Errorf("run(...) = %+v, want %q", got, want)
+			}
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		got := run(t, p, []string{"--log-level=trace"}, climate.WithSlog())
+		if want := `Error: invalid argument "trace" for "--log-level" flag: must be one of debug, info, warn, error`; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("without", func(t *testing.T) {
+		got := run(t, p, []string{"--log-level=debug"})
+		if want := "Error: unknown flag: --log-level\n"; !strings.HasPrefix(got.stderr, want) {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+type listenOptions struct {
+	Addr   string `default:":80"`
+	Ports  []int
+	Labels map[string]string
+	TLS    bool
+}
+
+func listen(opts *listenOptions) {
+	fmt.Println(opts.Addr, opts.Ports, opts.Labels, opts.TLS)
+}
+
+func TestWithConfigFile(t *testing.T) {
+	var (
+		p        = climate.Func(listen)
+		dir      = t.TempDir()
+		yamlPath = filepath.Join(dir, "app.yaml")
+		jsonPath = filepath.Join(dir, "app.json")
+		badPath  = filepath.Join(dir, "bad.yaml")
+	)
+	assert.Nil(os.WriteFile(yamlPath, []byte("addr: :8080\nports: [80, 443]\nlabels: {env: prod}\ntls: true\n"), 0o644))
+	assert.Nil(os.WriteFile(jsonPath, []byte(`{"addr": ":9090", "ports": [1000000]}`), 0o644))
+	assert.Nil(os.WriteFile(badPath, []byte("adr: :8080\n"), 0o644))
+	t.Run("yaml", func(t *testing.T) {
+		got := run(t, p, nil, climate.WithConfigFile(yamlPath, ""))
+		diff(t, result{stdout: ":8080 [80 443] map[env:prod] true\n"}, got)
+	})
+	t.Run("json", func(t *testing.T) {
+		got := run(t, p, []string{"--config", jsonPath}, climate.WithConfigFile(yamlPath, ""))
+		diff(t, result{stdout: ":9090 [1000000] map[] false\n"}, got)
+	})
+	t.Run("precedence", func(t *testing.T) {
+		t.Setenv("APP_PORTS", "8443")
+		got := run(t, p, []string{"--addr=:1"}, climate.WithConfigFile(yamlPath, ""), climate.WithEnvPrefix("APP"))
+		diff(t, result{stdout: ":1 [8443] map[env:prod] true\n"}, got)
+	})
+	t.Run("optional", func(t *testing.T) {
+		got := run(t, p, nil, climate.WithConfigFile(filepath.Join(dir, "missing.yaml"), ""))
+		diff(t, result{stdout: ":80 [] map[] false\n"}, got)
+	})
+	t.Run("missing", func(t *testing.T) {
+		missing := filepath.Join(dir, "missing.yaml")
+		got := run(t, p, []string{"--config", missing}, climate.WithConfigFile(yamlPath, ""))
+		want := result{stderr: "Error: open " + missing + ": no such file or directory\n", code: 1}
+		diff(t, want, got)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		got := run(t, p, nil, climate.WithConfigFile(badPath, ""))
+		if want := "Error: " + badPath + ": unknown flag: --adr\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run() = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+type cluster struct {
+	Name     string
+	Replicas int `default:"3"`
+	Zones    []string
+	Labels   map[string]string
+	Wait     time.Duration
+}
+
+func (*cluster) Scale(ctx context.Context) {
+	name, _ := climate.Flag[string](ctx, "name")
+	replicas, _ := climate.Flag[int](ctx, "replicas")
+	zones, _ := climate.Flag[[]string](ctx, "zones")
+	labels, _ := climate.Flag[map[string]string](ctx, "labels")
+	wait, _ := climate.Flag[time.Duration](ctx, "wait")
+	fmt.Println(name, replicas, zones, labels, wait)
+	_, ok1 := climate.Flag[int](ctx, "name")
+	_, ok2 := climate.Flag[string](ctx, "nonexistent")
+	fmt.Println(ok1, ok2)
+}
+
+func TestFlag(t *testing.T) {
+	p := climate.Struct[cluster]()
+	args := []string{"--name=prod", "--zones=a,b", "--labels=tier=web", "scale", "--wait=1m"}
+	diff(t, result{stdout: "prod 3 [a b] map[tier:web] 1m0s\nfalse false\n"}, run(t, p, args))
+}
+
+func TestWithOutputAndError(t *testing.T) {
+	var (
+		p  = climate.Func(cp, climate.WithArgs(climate.RangeArgs(2, 3)))
+		md = climate.WithMetadata(metadata(map[string][]string{"cp": {"args"}}))
+	)
+	t.Run("help", func(t *testing.T) {
+		var out, err bytes.Buffer
+		got := run(t, p, []string{"--help"}, md, climate.WithOutput(&out), climate.WithError(&err))
+		want := "Usage:\n  cp <args> <args> [args]\n\nFlags:\n  -h, --help  help for cp\n"
+		if diff := cmp.Diff(want, out.String()); diff != "" || err.Len() != 0 || got != (result{}) {
+			t.Errorf("run(--help) = %+v, %q, %q; diff(-want +got):\n%v", got, out.String(), err.String(), diff)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var out, err bytes.Buffer
+		got := run(t, p, []string{"a"}, md, climate.WithOutput(&out), climate.WithError(&err))
+		if want := "Error: cp accepts at least 2 arg(s), received 1\n"; err.String() != want || !strings.HasPrefix(out.String(), "Usage:\n") || got != (result{code: 2}) {
+			t.Errorf("run(a) = %+v, %q, %q; want error %q", got, out.String(), err.String(), want)
+		}
+	})
+}
+
+type tlsOptions struct {
+	Cert string `cli:"short"`
+	Key  string
+}
+
+type commonOptions struct {
+	Verbose bool
+}
+
+type authOptions struct {
+	User, Password string
+}
+
+type proxyOptions struct {
+	URL  string `cli:"short"`
+	Auth authOptions
+}
+
+type dialOptions struct {
+	commonOptions
+	TLS   tlsOptions
+	Proxy proxyOptions `cli:"prefix=via"`
+	Addr  string
+}
+
+func dial(opts *dialOptions) {
+	fmt.Println(opts.Verbose, opts.TLS, opts.Proxy, opts.Addr)
+}
+
+func TestNestedOptions(t *testing.T) {
+	var rmd internal.RawMetadata
+	rmd.Child(pkgPath).Child("tlsOptions").Child("Cert").Comment = "path to the cert"
+	rmd.Child(pkgPath).Child("authOptions").Child("User").Comment = "user to authenticate as"
+	var (
+		p  = climate.Func(dial)
+		md = climate.WithMetadata(rmd.Encode())
+	)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  dial
+
+Flags:
+      --verbose                   
+  -c, --tls-cert          string  path to the cert
+      --tls-key           string  
+  -u, --via-url           string  
+      --via-auth-user     string  user to authenticate as
+      --via-auth-password string  
+      --addr              string  
+  -h, --help                      help for dial
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}, md))
+	})
+	t.Run("set", func(t *testing.T) {
+		args := []string{"--verbose", "-c", "a", "--tls-key=b", "-u", "c", "--via-auth-user=d", "--addr=e"}
+		diff(t, result{stdout: "true {a b} {c {d }} e\n"}, run(t, p, args, md))
+	})
+}
+
+type semver struct {
+	major, minor int
+}
+
+func (v *semver) UnmarshalText(b []byte) error {
+	if _, err := fmt.Sscanf(string(b), "v%d.%d", &v.major, &v.minor); err != nil {
+		return fmt.Errorf("not vMAJOR.MINOR: %w", err)
+	}
+	return nil
+}
+
+func (v semver) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("v%d.%d", v.major, v.minor)), nil
+}
+
+type pingOptions struct {
+	Host    net.IP `default:"127.0.0.1"`
+	Version semver
+}
+
+func ping(opts *pingOptions) {
+	fmt.Println(opts.Host, opts.Version.major, opts.Version.minor)
+}
+
+func TestTextUnmarshalerFlags(t *testing.T) {
+	p := climate.Func(ping)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  ping [flags]
+
+Flags:
+      --host    ip     (default 127.0.0.1)  
+      --version semver                      
+  -h, --help                                help for ping
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+	t.Run("set", func(t *testing.T) {
+		diff(t, result{stdout: "::1 1 2\n"}, run(t, p, []string{"--host=::1", "--version", "v1.2"}))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		got := run(t, p, []string{"--version=1.2"})
+		if want := `Error: invalid argument "1.2" for "--version" flag: not vMAJOR.MINOR: `; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+type yesNo bool
+
+type yesNoValue struct {
+	p *yesNo
+}
+
+func (v yesNoValue) String() string {
+	if *v.p {
+		return "yes"
+	}
+	return "no"
+}
+
+func (v yesNoValue) Set(s string) error {
+	switch s {
+	case "yes":
+		*v.p = true
+	case "no":
+		*v.p = false
+	default:
+		return errors.New("not yes or no")
+	}
+	return nil
+}
+
+func (v yesNoValue) Type() string {
+	return "yes|no"
+}
+
+func init() {
+	climate.RegisterFlagType(func(p *yesNo) pflag.Value { return yesNoValue{p} })
+}
+
+type confirmOptions struct {
+	Sure    yesNo `default:"no"`
+	Careful yesNo
+}
+
+func confirm(opts *confirmOptions) {
+	fmt.Println(opts.Sure, opts.Careful)
+}
+
+func TestRegisterFlagType(t *testing.T) {
+	p := climate.Func(confirm)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  confirm [flags]
+
+Flags:
+      --sure    yes|no (default no)  
+      --careful yes|no               
+  -h, --help                         help for confirm
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+	t.Run("set", func(t *testing.T) {
+		diff(t, result{stdout: "true false\n"}, run(t, p, []string{"--sure=yes"}))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		got := run(t, p, []string{"--sure=maybe"})
+		if want := `Error: invalid argument "maybe" for "--sure" flag: not yes or no`; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+// ticket is a registered flag type whose pflag.Value doesn't follow pflag's own
+// conventions (i.e., doesn't hold the pointer in a field named value or p).
+type ticket string
+
+type ticketValue struct {
+	target *ticket
+}
+
+func (v ticketValue) String() string {
+	return string(*v.target)
+}
+
+func (v ticketValue) Set(s string) error {
+	*v.target = ticket("T-" + s)
+	return nil
+}
+
+func (v ticketValue) Type() string {
+	return "ticket"
+}
+
+func init() {
+	climate.RegisterFlagType(func(p *ticket) pflag.Value { return ticketValue{p} })
+}
+
+type resolveTicketOptions struct {
+	Ticket ticket
+}
+
+func resolveTicket(ctx context.Context, opts *resolveTicketOptions) {
+	v, ok := climate.Flag[ticket](ctx, "ticket")
+	s, _ := climate.Flag[string](ctx, "ticket")
+	fmt.Println(opts.Ticket, v, ok, s)
+}
+
+func TestRegisterFlagTypeFlag(t *testing.T) {
+	var (
+		p         = climate.Func(resolveTicket)
+		validator = climate.WithValidator("ticket", func(v ticket) error {
+			if v == "T-0" {
+				return errors.New("no such ticket")
+			}
+			return nil
+		})
+	)
+	t.Run("flag", func(t *testing.T) {
+		diff(t, result{stdout: "T-42 T-42 true T-42\n"}, run(t, p, []string{"--ticket=42"}, validator))
+	})
+	t.Run("validator", func(t *testing.T) {
+		got := run(t, p, []string{"--ticket=0"}, validator)
+		if want := `Error: invalid value "T-0" for --ticket: no such ticket`; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(...) = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+func touch(ctx context.Context, opts *toolbox, names ...string) {
+	fmt.Println(opts.Verbose, names)
+}
+
+func TestVariadicArgs(t *testing.T) {
+	var (
+		p  = climate.Func(touch, climate.WithArgs(climate.MinimumArgs(1)))
+		md = climate.WithMetadata(metadata(map[string][]string{"touch": {"ctx", "opts", "names"}}))
+	)
+	diff(t, result{stdout: "true [a b]\n"}, run(t, p, []string{"-v", "a", "b"}, md))
+	got := run(t, p, nil, md)
+	if want := "Error: touch accepts at least 1 arg(s), received 0\nUsage:\n  touch [opts] <names> [names...]\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+		t.Errorf("run() = %+v, want prefix %q", got, want)
+	}
+}
+
+func hammer(opts hammerOptions, args []string) {
+	fmt.Println(opts.Dry, args)
+}
+
+func TestOptsByValue(t *testing.T) {
+	var (
+		p  = climate.Func(hammer)
+		md = climate.WithMetadata(metadata(map[string][]string{"hammer": {"opts", "args"}}))
+	)
+	diff(t, result{stdout: "true [nail]\n"}, run(t, p, []string{"--dry", "nail"}, md))
+	got := run(t, p, []string{"--help"}, md)
+	if want := "Usage:\n  hammer [opts] [args...]\n"; !strings.HasPrefix(got.stdout, want) {
+		t.Errorf("run(--help) = %+v, want prefix %q", got, want)
+	}
+}
+
+type compileOptions struct {
+	Cache bool `cli:"negatable" default:"true"`
+	Strip bool `cli:"negatable"`
+}
+
+func compile(opts *compileOptions) {
+	fmt.Println(opts.Cache, opts.Strip)
+}
+
+func TestNegatableFlags(t *testing.T) {
+	p := climate.Func(compile)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  compile [flags]
+
+Flags:
+      --[no-]cache (default true)  
+      --[no-]strip                 
+  -h, --help                       help for compile
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "true false\n"},
+		{[]string{"--no-cache"}, "false false\n"},
+		{[]string{"--strip", "--no-strip", "--no-cache", "--cache"}, "true false\n"},
+		{[]string{"--no-strip=false"}, "true true\n"},
+	} {
+		diff(t, result{stdout: test.want}, run(t, p, test.args))
+	}
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("APP_CACHE", "true")
+		diff(t, result{stdout: "false false\n"}, run(t, p, []string{"--no-cache"}, climate.WithEnvPrefix("APP")))
+	})
+}
+
+type dbKey struct{}
+
+func query(ctx context.Context, args []string) error {
+	fmt.Println("query", ctx.Value(dbKey{}))
+	if len(args) > 0 {
+		return errors.New(args[0])
+	}
+	return nil
+}
+
+func TestRunHooks(t *testing.T) {
+	var (
+		p   = climate.Func(query)
+		pre = climate.WithPreRun(func(ctx context.Context) (context.Context, error) {
+			fmt.Println("pre")
+			return context.WithValue(ctx, dbKey{}, "db"), nil
+		})
+		post = func(name string) func(*internal.RunOptions) {
+			return climate.WithPostRun(func(ctx context.Context, runErr error) error {
+				fmt.Println("post", name, ctx.Value(dbKey{}), runErr)
+				return nil
+			})
+		}
+	)
+	t.Run("ok", func(t *testing.T) {
+		want := result{stdout: "pre\nquery db\npost b db <nil>\npost a db <nil>\n"}
+		diff(t, want, run(t, p, nil, pre, post("a"), post("b")))
+	})
+	t.Run("run-error", func(t *testing.T) {
+		want := result{
+			stdout: "pre\nquery db\npost a db oops\n",
+			stderr: "Error: oops\n",
+			code:   1,
+		}
+		diff(t, want, run(t, p, []string{"oops"}, pre, post("a")))
+	})
+	t.Run("pre-error", func(t *testing.T) {
+		failing := climate.WithPreRun(func(ctx context.Context) (context.Context, error) {
+			return ctx, climate.ErrExit(3, errors.New("no db"))
+		})
+		want := result{stderr: "Error: no db\n", code: 3}
+		diff(t, want, run(t, p, nil, failing, post("a")))
+	})
+	t.Run("post-error", func(t *testing.T) {
+		failing := climate.WithPostRun(func(context.Context, error) error {
+			return errors.New("close failed")
+		})
+		want := result{
+			stdout: "query <nil>\n",
+			stderr: "Error: oops\nclose failed\n",
+			code:   1,
+		}
+		diff(t, want, run(t, p, []string{"oops"}, failing))
+	})
+}
+
+func crash(args []string) {
+	var m map[string]int
+	m[args[0]]++
+}
+
+func TestWithRecover(t *testing.T) {
+	p := climate.Func(crash)
+	t.Run("recover", func(t *testing.T) {
+		want := result{
+			stderr: "Error: panic: assignment to entry in nil map\n",
+			code:   1,
+		}
+		diff(t, want, run(t, p, []string{"x"}, climate.WithRecover()))
+	})
+	t.Run("stack-trace", func(t *testing.T) {
+		got := run(t, p, []string{"--stack-trace", "x"}, climate.WithRecover())
+		if want := "goroutine "; !strings.Contains(got.stderr, want) || got.code != 1 {
+			t.Errorf("run(--stack-trace) = %+v, want %q in stderr", got, want)
+		}
+	})
+	t.Run("post-run", func(t *testing.T) {
+		post := climate.WithPostRun(func(_ context.Context, runErr error) error {
+			fmt.Println("post", runErr)
+			return nil
+		})
+		want := result{
+			stdout: "post panic: assignment to entry in nil map\n",
+			stderr: "Error: panic: assignment to entry in nil map\n",
+			code:   1,
+		}
+		diff(t, want, run(t, p, []string{"x"}, climate.WithRecover(), post))
+	})
+	t.Run("build", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("recover() = nil, want panic")
+			}
+		}()
+		run(t, climate.Func(func(int) {}), nil, climate.WithRecover())
+	})
+}
+
+type report struct {
+	Name  string   `json:"name" yaml:"name"`
+	Tags  []string `json:"tags" yaml:"tags"`
+	Count int      `json:"count" yaml:"count"`
+}
+
+func (r report) String() string {
+	return fmt.Sprintf("%v (%v)", r.Name, r.Count)
+}
+
+func summarize(args []string) (report, error) {
+	if len(args) == 0 {
+		return report{}, errors.New("nothing to summarize")
+	}
+	return report{Name: args[0], Tags: args[1:], Count: len(args)}, nil
+}
+
+func TestOutput(t *testing.T) {
+	p := climate.Func(summarize)
+	t.Run("text", func(t *testing.T) {
+		diff(t, result{stdout: "a (2)\n"}, run(t, p, []string{"a", "b"}))
+	})
+	t.Run("json", func(t *testing.T) {
+		want := result{stdout: `{
+  "name": "a",
+  "tags": [
+    "b"
+  ],
+  "count": 2
+}
+`}
+		diff(t, want, run(t, p, []string{"--output=json", "a", "b"}))
+	})
+	t.Run("yaml", func(t *testing.T) {
+		want := result{stdout: "name: a\ntags:\n  - b\ncount: 2\n"}
+		diff(t, want, run(t, p, []string{"--output", "yaml", "a", "b"}))
+	})
+	t.Run("error", func(t *testing.T) {
+		want := result{stderr: "Error: nothing to summarize\n", code: 1}
+		diff(t, want, run(t, p, []string{"--output=json"}))
+	})
+	t.Run("value-only", func(t *testing.T) {
+		diff(t, result{stdout: "42\n"}, run(t, climate.Func(func() int { return 42 }), nil))
+	})
+	t.Run("two-values", func(t *testing.T) {
+		defer func() {
+			want := "not func([context.Context], [*struct], [io.Writer], [[]string]) ([T], [error]): func() (int, int)"
+			if got := recover(); got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, climate.Func(func() (int, int) { return 0, 0 }), nil)
+	})
+}
+
+type connectOptions struct {
+	Host string
+	Port int16
+}
+
+func connect(opts *connectOptions) {
+	fmt.Println(opts.Host, opts.Port)
+}
+
+func TestWithValidator(t *testing.T) {
+	var (
+		p    = climate.Func(connect)
+		port = climate.WithValidator("port", func(port int) error {
+			if port < 1 {
+				return errors.New("must be positive")
+			}
+			return nil
+		})
+		host = climate.WithValidator("host", func(host string) error {
+			if strings.Contains(host, " ") {
+				return errors.New("must not contain spaces")
+			}
+			return nil
+		})
+	)
+	t.Run("valid", func(t *testing.T) {
+		diff(t, result{stdout: "example.com 80\n"}, run(t, p, []string{"--host=example.com", "--port=80"}, port, host))
+	})
+	t.Run("default", func(t *testing.T) {
+		diff(t, result{stdout: " 0\n"}, run(t, p, nil, port, host))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		got := run(t, p, []string{"--host=a b", "--port=-1"}, port, host)
+		want := "Error: invalid value \"a b\" for --host: must not contain spaces\ninvalid value \"-1\" for --port: must be positive\n"
+		if !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run() = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("type", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "cannot validate --port as string"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, p, nil, climate.WithValidator("port", func(string) error { return nil }))
+	})
+	t.Run("no-flag", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "no flag for validator: user"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, p, nil, climate.WithValidator("user", func(string) error { return nil }))
+	})
+}
+
+type repl struct {
+	Tags    []string
+	Env     map[string]string
+	Verbose bool
+	Level   int `default:"1"`
+}
+
+func (r *repl) Echo(args []string) {
+	fmt.Println(r.Tags, r.Env, r.Verbose, r.Level, args)
+}
+
+func TestCompile(t *testing.T) {
+	cp, err := climate.Compile(climate.Struct[repl]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TODO(golang/go#36532): replace with t.Context().
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tests := []struct {
+		args []string
+		want result
+	}{
+		{
+			args: []string{"echo", "--tags=a", "--tags=b", "--env=k=v", "--verbose", "--level=2", "x"},
+			want: result{stdout: "[a b] map[k:v] true 2 [x]\n"},
+		},
+		{
+			args: []string{"echo", "--tags=c", "y"},
+			want: result{stdout: "[c] map[] false 1 [y]\n"},
+		},
+		{
+			args: []string{"echo", "--help"},
+			want: result{stdout: `Usage:
+  repl echo [flags]
+
+Flags:
+  -h, --help  help for echo
+
+Global Flags:
+  --env     stringToString (repeatable)  
+  --level   int            (default 1)   
+  --tags    strings        (repeatable)  
+  --verbose
+`},
+		},
+		{
+			args: []string{"echo"},
+			want: result{stdout: "[] map[] false 1 []\n"},
+		},
+	}
+	for _, test := range tests {
+		stdout, stderr, code, _ := cp.Execute(ctx, test.args)
+		diff(t, test.want, result{stdout, stderr, code})
+	}
+}
+
+type inspect struct {
+	Verbose bool
+}
+
+func (i inspect) Status() {
+	fmt.Println("status", i.Verbose)
+}
+
+func (i *inspect) Reset() {
+	i.Verbose = false
+	fmt.Println("reset")
+}
+
+func TestValueReceivers(t *testing.T) {
+	p := climate.Struct[inspect]()
+	t.Run("value", func(t *testing.T) {
+		diff(t, result{stdout: "status true\n"}, run(t, p, []string{"status", "--verbose"}))
+	})
+	t.Run("pointer", func(t *testing.T) {
+		diff(t, result{stdout: "reset\n"}, run(t, p, []string{"reset"}))
+	})
+}
+
+type wcOptions struct {
+	Data   []byte `cli:"stdin"`
+	Header string `cli:"stdin"`
+}
+
+func wc(opts *wcOptions) {
+	fmt.Printf("%q %q\n", opts.Header, opts.Data)
+}
+
+func TestStdinFields(t *testing.T) {
+	var (
+		p    = climate.Func(wc)
+		path = filepath.Join(t.TempDir(), "data.txt")
+	)
+	if err := os.WriteFile(path, []byte("from file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		args  []string
+		piped bool
+		want  result
+	}{
+		{
+			name:  "piped",
+			piped: true,
+			want:  result{stdout: "\"\" \"piped\"\n"},
+		},
+		{
+			name:  "file",
+			args:  []string{"--data", path},
+			piped: true,
+			want:  result{stdout: "\"piped\" \"from file\"\n"},
+		},
+		{
+			name:  "dash",
+			args:  []string{"--header=-", "--data", path},
+			piped: true,
+			want:  result{stdout: "\"piped\" \"from file\"\n"},
+		},
+		{
+			name:  "both-dash",
+			args:  []string{"--header=-", "--data=-"},
+			piped: true,
+			want: result{
+				stderr: "Error: both --data and --header read from stdin\n",
+				code:   2,
+			},
+		},
+		{
+			name: "missing",
+			args: []string{"--data", path + ".missing"},
+			want: result{
+				stderr: "Error: --data: open " + path + ".missing: no such file or directory\n",
+				code:   1,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mods []func(*internal.RunOptions)
+			if test.piped {
+				mods = append(mods, climate.WithInput(strings.NewReader("piped")))
+			}
+			got := run(t, p, test.args, mods...)
+			if test.want.code == 2 {
+				got.stderr, _, _ = strings.Cut(got.stderr, "Usage:")
+			}
+			diff(t, test.want, got)
+		})
+	}
+}
+
+func TestFlagSuggestions(t *testing.T) {
+	p := climate.Struct[remote]()
+	t.Run("inherited", func(t *testing.T) {
+		got := run(t, p, []string{"remove", "--verbsoe", "origin"})
+		want := "Error: unknown flag: --verbsoe\n\nDid you mean this?\n\t--verbose\nUsage:"
+		if !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(remove --verbsoe) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("none", func(t *testing.T) {
+		got := run(t, p, []string{"remove", "--quiet", "origin"})
+		if want := "Error: unknown flag: --quiet\nUsage:"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(remove --quiet) = %+v, want prefix %q", got, want)
+		}
+	})
+}
+
+func TestWithSuggestions(t *testing.T) {
+	p := climate.Struct[remote]()
+	t.Run("without", func(t *testing.T) {
+		want := result{
+			stderr: "Error: unknown command \"remvoe\" for \"remote\"\nRun 'remote --help' for usage.\n",
+			code:   2,
+		}
+		diff(t, want, run(t, p, []string{"remvoe"}, climate.WithoutSuggestions()))
+		got := run(t, p, []string{"remove", "--verbsoe"}, climate.WithoutSuggestions())
+		if want := "Error: unknown flag: --verbsoe\nUsage:"; !strings.HasPrefix(got.stderr, want) {
+			t.Errorf("run(remove --verbsoe) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("distance", func(t *testing.T) {
+		want := result{
+			stderr: "Error: unknown command \"remvoe\" for \"remote\"\nRun 'remote --help' for usage.\n",
+			code:   2,
+		}
+		diff(t, want, run(t, p, []string{"remvoe"}, climate.WithSuggestions(1)))
+		want.stderr = "Error: unknown command \"remvoe\" for \"remote\"\n\nDid you mean this?\n\tremove\n\nRun 'remote --help' for usage.\n"
+		diff(t, want, run(t, p, []string{"remvoe"}, climate.WithSuggestions(3)))
+	})
+}
+
+type releaseOptions struct {
+	Env     string `cli:"short,enum=dev|prod,required"`
+	Tags    []string
+	Config  string `cli:"complete=file:yaml"`
+	Verbose int    `cli:"short,count"`
+	Debug   bool   `cli:"hidden"`
+}
+
+func release(opts *releaseOptions) {}
+
+func TestGenCarapaceSpec(t *testing.T) {
+	got, err := climate.GenCarapaceSpec(climate.Func(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name: release
+flags:
+  --config=: ""
+  --tags*=: ""
+  -e, --env!=: ""
+  -v, --verbose*: ""
+completion:
+  flag:
+    config:
+      - $files([.yaml])
+    env:
+      - dev
+      - prod
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("GenCarapaceSpec(...) diff(-want +got):\n%v", diff)
+	}
+}
+
+type copyOptions struct {
+	Src   string   `cli:"arg"`
+	Dst   string   `cli:"arg"`
+	Extra []string `cli:"arg"`
+}
+
+func copyFiles(opts *copyOptions) {}
+
+func TestPositionalsHelp(t *testing.T) {
+	var rmd internal.RawMetadata
+	fields := rmd.Child(pkgPath).Child("copyOptions")
+	fields.Child("Src").Comment = "source path"
+	fields.Child("Dst").Comment = "destination path"
+	want := result{stdout: `Usage:
+  copyfiles <src> <dst> [extra...]
+
+Arguments:
+  src    source path
+  dst    destination path
+  extra
+
+Flags:
+  -h, --help  help for copyfiles
+`}
+	diff(t, want, run(t, climate.Func(copyFiles), []string{"--help"}, climate.WithMetadata(rmd.Encode())))
+}
+
+func proceed(ctx context.Context, args []string) error {
+	defer fmt.Println("cleanup")
+	func() {
+		if len(args) > 0 && args[0] == "no" {
+			climate.Exit(ctx, 3)
+		}
+	}()
+	fmt.Println("confirmed")
+	return nil
+}
+
+func TestExit(t *testing.T) {
+	p := climate.Func(proceed)
+	t.Run("exit", func(t *testing.T) {
+		diff(t, result{stdout: "cleanup\n", code: 3}, run(t, p, []string{"no"}))
+	})
+	t.Run("no-exit", func(t *testing.T) {
+		diff(t, result{stdout: "confirmed\ncleanup\n"}, run(t, p, []string{"yes"}))
+	})
+	t.Run("foreign-context", func(t *testing.T) {
+		defer func() {
+			want := "climate.Exit with a context not passed by Run"
+			if got := recover(); got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		climate.Exit(context.Background(), 3)
+	})
+}
+
+type serveConfig struct {
+	LogLevel string `yaml:"log_level" json:"logLevel"`
+	Addr     string `json:"listen"`
+	Port     int    `yaml:"-" json:"port" cli:"name=http-port"`
+	Quiet    bool   `yaml:",omitempty"`
+	TLS      struct {
+		Cert string `yaml:"cert_file"`
+	} `yaml:"tls"`
+}
+
+func serveWith(opts *serveConfig) {
+	fmt.Println(opts.LogLevel, opts.Addr, opts.Port, opts.Quiet, opts.TLS.Cert)
+}
+
+func TestWithTagPreference(t *testing.T) {
+	var (
+		p    = climate.Func(serveWith)
+		pref = climate.WithTagPreference("yaml", "json")
+	)
+	t.Run("preferred", func(t *testing.T) {
+		args := []string{"--log-level=debug", "--listen=:80", "--http-port=8080", "--quiet", "--tls-cert-file=c.pem"}
+		diff(t, result{stdout: "debug :80 8080 true c.pem\n"}, run(t, p, args, pref))
+	})
+	t.Run("default", func(t *testing.T) {
+		args := []string{"--log-level=debug", "--addr=:80", "--tls-cert=c.pem"}
+		diff(t, result{stdout: "debug :80 0 false c.pem\n"}, run(t, p, args))
+	})
+}
+
+type mirrorOptions struct {
+	commonOptions `cli:"-"`
+	Source        string
+	Remote        proxyOptions `cli:"-"`
+	Resolved      string       `cli:"-"`
+}
+
+func mirror(opts *mirrorOptions) {
+	fmt.Println(opts.Source, opts.Resolved == "")
+}
+
+func TestSkippedFields(t *testing.T) {
+	var rmd internal.RawMetadata
+	rmd.Child(pkgPath).Child("mirror")
+	opts := rmd.Child(pkgPath).Child("mirrorOptions")
+	opts.Child("Source").Comment = "directory to sync from"
+	opts.Child("Resolved").Comment = "resolved by a pre-run hook"
+	opts.Child("commonOptions")
+	opts.Child("Remote")
+	var (
+		p    = climate.Func(mirror)
+		md   = climate.WithMetadata(rmd.Encode())
+		want = result{
+			stdout: `Usage:
+  mirror
+
+Flags:
+      --source string  directory to sync from
+  -h, --help           help for mirror
+`,
+		}
+	)
+	diff(t, want, run(t, p, []string{"--help"}, md, climate.WithStrictMetadata()))
+	got := run(t, p, []string{"--resolved=x"})
+	if want := "Error: unknown flag: --resolved\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+		t.Errorf("run(--resolved=x) = %+v, want stderr prefix %q and code 2", got, want)
+	}
+}
+
+func TestWithName(t *testing.T) {
+	var (
+		p    = climate.Struct[remote]()
+		name = climate.WithName("git-remote")
+	)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  git-remote add [flags]
+
+Flags:
+  -h, --help  help for add
+
+Global Flags:
+  -v, --verbose
+`,
+		}
+		diff(t, want, run(t, p, []string{"add", "--help"}, name))
+	})
+	t.Run("completion", func(t *testing.T) {
+		got := run(t, p, []string{"completion", "fish"}, name, climate.WithCompletionCommand())
+		if want := "complete -c git-remote "; !strings.Contains(got.stdout, want) {
+			t.Errorf("completion fish = %v, want it to contain %q", got.stdout, want)
+		}
+	})
+}
+
+type fleet struct {
+	Host string `cli:"short"`
+}
+
+func (c *fleet) Status() {
+	fmt.Println(c.Host)
+}
+
+func TestHelpCommandAndFlag(t *testing.T) {
+	p := climate.Struct[fleet]()
+	t.Run("without-help-command", func(t *testing.T) {
+		var (
+			// Note: -h is taken by --host (but see the help-flag test below).
+			hf  = climate.WithHelpFlag("help", "")
+			mod = climate.WithoutHelpCommand()
+		)
+		want := result{
+			stderr: "Error: unknown command \"help\" for \"fleet\"\nRun 'fleet --help' for usage.\n",
+			code:   2,
+		}
+		diff(t, want, run(t, p, []string{"help"}, hf, mod))
+		want = result{
+			stdout: `Usage:
+  fleet [command]
+
+Available Commands:
+  completion  Generate the autocompletion script for the specified shell
+  status      
+
+Flags:
+  -h, --host string  
+      --help         help for fleet
+
+Use "fleet [command] --help" for more information about a command.
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help-hidden"}, hf, mod))
+	})
+	t.Run("help-flag", func(t *testing.T) {
+		var (
+			hf   = climate.WithHelpFlag("usage", "u")
+			want = result{
+				stdout: `Usage:
+  fleet status [flags]
+
+Flags:
+  -u, --usage  help for status
+
+Global Flags:
+  -h, --host string
+`,
+			}
+		)
+		diff(t, want, run(t, p, []string{"status", "-u"}, hf))
+		diff(t, want, run(t, p, []string{"status", "--help"}, hf))
+		diff(t, result{stdout: "h0st\n"}, run(t, p, []string{"status", "-h", "h0st"}, hf))
+	})
+	t.Run("bounded-args", func(t *testing.T) {
+		// Note: Cobra validates the args before running any of the pre-runs.
+		var (
+			p  = climate.Func(cp, climate.WithArgs(climate.ExactArgs(2)))
+			hf = climate.WithHelpFlag("usage", "u")
+		)
+		want := result{stdout: "Usage:\n  cp [flags]\n\nFlags:\n  -u, --usage  help for cp\n"}
+		diff(t, want, run(t, p, []string{"-u"}, hf))
+	})
+}
+
+type convertOptions struct {
+	To    format   `cli:"arg"`
+	Files []string `cli:"arg"`
+}
+
+func convert(opts *convertOptions) {
+	fmt.Println(opts.To, opts.Files)
+}
+
+func TestEnumPositionals(t *testing.T) {
+	p := climate.Func(convert)
+	t.Run("complete", func(t *testing.T) {
+		var rmd internal.RawMetadata
+		md := rmd.Child(pkgPath).Child("format").Child("YAML")
+		md.Value, md.Comment = "yaml", "output as YAML"
+		got := run(t, p, []string{"__complete", ""}, climate.WithMetadata(rmd.Encode()))
+		diff(t, result{stdout: "json\nyaml\toutput as YAML\ntext\n:4\n"}, result{stdout: got.stdout})
+		// Files are not enums, so it falls back to the default (file) completion.
+		got = run(t, p, []string{"__complete", "json", ""})
+		diff(t, result{stdout: ":0\n"}, result{stdout: got.stdout})
+	})
+	t.Run("valid", func(t *testing.T) {
+		diff(t, result{stdout: "yaml [a.json]\n"}, run(t, p, []string{"yaml", "a.json"}))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		want := result{
+			stderr: `Error: invalid argument "xml" for <to>: must be one of json, yaml, text
+Usage:
+  convert <to> [files...] [flags]
+
+Flags:
+  -h, --help  help for convert
+
+`,
+			code: 2,
+		}
+		diff(t, want, run(t, p, []string{"xml"}))
+	})
+}
+
+func TestWithMetadataOverride(t *testing.T) {
+	var rmd internal.RawMetadata
+	rmd.Child(pkgPath).Child("remote").Doc = "Remote manages the remotes."
+	add := rmd.Child(pkgPath).Child("remote").Child("Add")
+	add.Doc, add.Directives = "Add adds a remote.", map[string]string{"short": "Add a remote"}
+	rmd.Child(pkgPath).Child("remote").Child("Verbose").Comment = "be verbose"
+	var (
+		p        = climate.Struct[remote]()
+		md       = climate.WithMetadata(rmd.Encode())
+		override = climate.WithMetadataOverride(map[string]string{
+			pkgPath + ".remote":         "Acme manages the Acme remotes.",
+			pkgPath + ".remote.Add":     "Add adds an Acme remote.",
+			pkgPath + ".remote.Verbose": "be very verbose",
+		})
+	)
+	// Note: the override takes precedence even though it's given first.
+	want := result{
+		stdout: `Acme manages the Acme remotes.
+
+Usage:
+  remote [command]
+
+Available Commands:
+  add         Add adds an Acme remote
+  completion  Generate the autocompletion script for the specified shell
+  help        Help about any command
+  remove      
+
+Flags:
+  -v, --verbose  be very verbose
+  -h, --help     help for remote
+
+Use "remote [command] --help" for more information about a command.
+`,
+	}
+	diff(t, want, run(t, p, []string{"--help"}, override, md))
+}
+
+func TestWithTiming(t *testing.T) {
+	durationRegexp := regexp.MustCompile(`after [0-9.]+[µmn]?s|took [0-9.]+[µmn]?s`)
+	timing := func(t *testing.T, p internal.Plan, args []string) result {
+		t.Helper()
+		got := run(t, p, args, climate.WithTiming())
+		got.stderr = durationRegexp.ReplaceAllStringFunc(got.stderr, func(s string) string {
+			verb, _, _ := strings.Cut(s, " ")
+			return verb + " <d>"
+		})
+		return got
+	}
+	t.Run("success", func(t *testing.T) {
+		diff(t, result{stdout: "text auto\n", stderr: "export took <d>\n"}, timing(t, climate.Func(export), []string{"--timing"}))
+	})
+	t.Run("failure", func(t *testing.T) {
+		want := result{stderr: "deny failed after <d>\nError: permission denied\n", code: 3}
+		diff(t, want, timing(t, climate.Func(deny), []string{"--timing", "loudly"}))
+	})
+	t.Run("off", func(t *testing.T) {
+		diff(t, result{stdout: "text auto\n"}, timing(t, climate.Func(export), nil))
+	})
+}
+
+type severity int
+
+func (s severity) String() string {
+	return [...]string{"info", "warning", "error"}[s]
+}
+
+// perm is a file mode, which is shown in octal (which the flag accepts too).
+type perm uint
+
+func (p perm) String() string {
+	return fmt.Sprintf("%#o", uint(p))
+}
+
+type alertOptions struct {
+	Min     severity `default:"1"`
+	Page    severity
+	Mode    perm `default:"420"`
+	Retries int  `default:"3"`
+}
+
+func alert(opts *alertOptions) {
+	fmt.Println(opts.Min, opts.Page, opts.Mode, opts.Retries)
+}
+
+func TestStringerDefaults(t *testing.T) {
+	p := climate.Func(alert)
+	t.Run("help", func(t *testing.T) {
+		// Note: --min can't be passed "warning", so its default is shown as is.
+		want := result{
+			stdout: `Usage:
+  alert [flags]
+
+Flags:
+      --min     int  (default 1)     
+      --page    int                  
+      --mode    uint (default 0644)  
+      --retries int  (default 3)     
+  -h, --help                         help for alert
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+	t.Run("run", func(t *testing.T) {
+		diff(t, result{stdout: "warning info 0644 3\n"}, run(t, p, nil))
+		diff(t, result{stdout: "warning info 0755 3\n"}, run(t, p, []string{"--mode=0755"}))
+	})
+	t.Run("complete", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--mode", ""})
+		diff(t, result{stdout: "0644\tdefault\n:4\n"}, result{stdout: got.stdout})
+		got = run(t, p, []string{"__complete", "--min", ""})
+		diff(t, result{stdout: ":0\n"}, result{stdout: got.stdout})
+	})
+}
+
+func TestNoArgs(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		got := run(t, climate.Func(export), []string{"extra", "more args"})
+		if want := "Error: export takes no args, received \"extra\" \"more args\"\nUsage:\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(extra, more args) = %+v, want prefix %q and code 2", got, want)
+		}
+	})
+	t.Run("explicit", func(t *testing.T) {
+		p := climate.Func(func(args []string) { fmt.Println(args) }, climate.WithArgs(climate.NoArgs()))
+		diff(t, result{stdout: "[]\n"}, run(t, p, nil))
+		got := run(t, p, []string{"extra"})
+		if want := "takes no args, received \"extra\"\n"; !strings.Contains(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(extra) = %+v, want %q and code 2", got, want)
+		}
+	})
+}
+
+type cloud struct {
+	Region string `default:"us"`
+}
+
+func (c *cloud) Regions() {
+	fmt.Println(c.Region)
+}
+
+type vm struct {
+	Cloud *cloud
+	Zone  string `default:"a"`
+}
+
+func (v *vm) List() {
+	fmt.Println(v.Cloud.Region, v.Zone)
+}
+
+type disk struct {
+	VM *vm
+}
+
+func (d *disk) Attach(name string) {
+	fmt.Println(d.VM.Cloud.Region, d.VM.Zone, name)
+}
+
+func TestTree(t *testing.T) {
+	var (
+		root = climate.Struct[cloud]()
+		vms  = climate.Struct[vm]()
+	)
+	// Note: the order of the Tree calls doesn't matter.
+	climate.Tree(root, vms)
+	climate.Tree(vms, climate.Struct[disk]())
+	args := []string{"--region=eu", "vm", "--zone=b", "disk", "attach", "d0"}
+	diff(t, result{stdout: "eu b d0\n"}, run(t, root, args))
+	diff(t, result{stdout: "us a\n"}, run(t, root, []string{"vm", "list"}))
+	t.Run("twice", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("recover() = nil, want panic")
+			}
+		}()
+		climate.Tree(root, vms)
+	})
+	t.Run("two-parents", func(t *testing.T) {
+		defer func() {
+			want := "plan added to more than one parent: climate_test.disk (climate_test.vm and climate_test.cloud)"
+			if got := recover(); got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		disk := climate.Struct[disk]()
+		climate.Tree(climate.Struct[vm](), disk)
+		climate.Tree(climate.Struct[cloud](), disk)
+	})
+	t.Run("cycle", func(t *testing.T) {
+		defer func() {
+			want := "cycle in plans: climate_test.cloud -> climate_test.vm -> climate_test.cloud"
+			if got := recover(); got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		var (
+			root = climate.Struct[cloud]()
+			vms  = climate.Struct[vm]()
+		)
+		climate.Tree(root, vms)
+		climate.Tree(vms, root)
+		run(t, root, []string{"vm", "list"})
+	})
+}
+
+func TestWithDebug(t *testing.T) {
+	var rmd internal.RawMetadata
+	rmd.Child(pkgPath).Child("mirror").Doc = "Mirror mirrors."
+	md := climate.WithMetadata(rmd.Encode())
+	want := result{
+		stdout: "x true\n",
+		stderr: `climate: func github.com/avamsi/climate_test.mirror -> command mirror
+climate: field climate_test.mirrorOptions.commonOptions -> skipped (cli:"-")
+climate: field climate_test.mirrorOptions.Source -> flag --source
+climate: field climate_test.mirrorOptions.Remote -> skipped (cli:"-")
+climate: field climate_test.mirrorOptions.Resolved -> skipped (cli:"-")
+climate: metadata for github.com/avamsi/climate_test.mirror: found
+climate: metadata for github.com/avamsi/climate_test.mirrorOptions: missing
+climate: metadata for github.com/avamsi/climate_test.mirrorOptions.commonOptions: missing
+climate: metadata for github.com/avamsi/climate_test.mirrorOptions.Source: missing
+climate: metadata for github.com/avamsi/climate_test.mirrorOptions.Remote: missing
+climate: metadata for github.com/avamsi/climate_test.mirrorOptions.Resolved: missing
+`,
+	}
+	diff(t, want, run(t, climate.Func(mirror), []string{"--source=x"}, md, climate.WithDebug()))
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("CLIMATE_DEBUG", "1")
+		want := result{
+			stderr: `climate: struct climate_test.remote -> command remote
+climate: field climate_test.remote.Verbose -> flag --verbose
+climate: method (*climate_test.remote).Add -> command add
+climate: method (*climate_test.remote).Remove -> command remove
+climate: no metadata (see WithMetadata)
+`,
+		}
+		diff(t, want, run(t, climate.Struct[remote](), []string{"add", "x"}))
+	})
+}
+
+type gatewayTLSOptions struct {
+	CertFile string
+	Insecure bool `cli:"section=Security"`
+}
+
+type gatewayOptions struct {
+	Listen  string
+	Host    string            `cli:"section=Connection"`
+	Port    int               `cli:"section=Connection"`
+	TLS     gatewayTLSOptions `cli:"section=TLS"`
+	Verbose bool
+}
+
+func gateway(opts *gatewayOptions) {
+	fmt.Println(opts.Host, opts.Port)
+}
+
+func TestFlagSections(t *testing.T) {
+	want := result{
+		stdout: `Usage:
+  gateway [flags]
+
+Flags:
+      --listen        string  
+      --verbose               
+  -h, --help                  help for gateway
+
+  Connection:
+      --host          string  
+      --port          int     
+
+  TLS:
+      --tls-cert-file string  
+
+  Security:
+      --tls-insecure
+`,
+	}
+	diff(t, want, run(t, climate.Func(gateway), []string{"--help"}))
+	t.Run("multi-line-usage", func(t *testing.T) {
+		var rmd internal.RawMetadata
+		rmd.Child(pkgPath).Child("gatewayOptions").Child("Host").Doc = "host to connect to\n(or a comma separated list of hosts)"
+		want := result{
+			stdout: `Usage:
+  gateway
+
+Flags:
+      --listen        string  
+      --verbose               
+  -h, --help                  help for gateway
+
+  Connection:
+      --host          string  host to connect to
+                              (or a comma separated list of hosts)
+      --port          int     
+
+  TLS:
+      --tls-cert-file string  
+
+  Security:
+      --tls-insecure
+`,
+		}
+		diff(t, want, run(t, climate.Func(gateway), []string{"--help"}, climate.WithMetadata(rmd.Encode())))
+	})
+	t.Run("markdown", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := climate.GenMarkdownTree(climate.Func(gateway), dir); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, "gateway.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `## gateway
+
+### Synopsis
+
+` + "```" + `
+gateway [flags]
+` + "```" + `
+
+### Flags
+
+| Flag | Short | Type | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`--listen`" + ` |  | string |  |  |
+| ` + "`--verbose`" + ` |  |  |  |  |
+| ` + "`--help` | `-h`" + ` |  |  | help for gateway |
+
+#### Connection
+
+| Flag | Short | Type | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`--host`" + ` |  | string |  |  |
+| ` + "`--port`" + ` |  | int |  |  |
+
+#### TLS
+
+| Flag | Short | Type | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`--tls-cert-file`" + ` |  | string |  |  |
+
+#### Security
+
+| Flag | Short | Type | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`--tls-insecure`" + ` |  |  |  |  |
+
+`
+		if diff := cmp.Diff(want, string(got)); diff != "" {
+			t.Errorf("gateway.md diff(-want +got):\n%v", diff)
+		}
+	})
+}
+
+func TestWithErrorFormatter(t *testing.T) {
+	var (
+		p      = climate.Func(deny)
+		format = climate.WithErrorFormatter(func(err error) string {
+			return "deny: " + strings.ToUpper(err.Error())
+		})
+	)
+	diff(t, result{stderr: "deny: PERMISSION DENIED\n", code: 3}, run(t, p, []string{"loudly"}, format))
+	diff(t, result{code: 3}, run(t, p, []string{"quietly"}, format))
+	want := result{
+		stderr: `Usage:
+  deny [flags]
+
+Flags:
+  -h, --help  help for deny
+
+deny: DENY ACCEPTS 1 ARG(S), RECEIVED 2
+`,
+		code: 2,
+	}
+	diff(t, want, run(t, p, []string{"loudly", "twice"}, format))
+	t.Run("prefix", func(t *testing.T) {
+		prefix := climate.WithErrorPrefix("deny:")
+		diff(t, result{stderr: "deny: permission denied\n", code: 3}, run(t, p, []string{"loudly"}, prefix))
+	})
+}
+
+type pruneOptions struct {
+	DryRun bool
+	Force  bool `cli:"explicit"`
+}
+
+func prune(opts *pruneOptions) {
+	fmt.Println(opts.DryRun, opts.Force)
+}
+
+func TestBoolValues(t *testing.T) {
+	p := climate.Func(prune)
+	tests := []struct {
+		args []string
+		want result
+	}{
+		{
+			args: []string{"--dry-run", "--force=true"},
+			want: result{stdout: "true true\n"},
+		},
+		{
+			args: []string{"--dry-run=true", "--force", "true"},
+			want: result{stdout: "true true\n"},
+		},
+		{
+			args: []string{"--dry-run=false", "--force=false"},
+			want: result{stdout: "false false\n"},
+		},
+		{
+			args: []string{"--force"},
+			want: result{
+				stderr: `Error: flag needs an argument: --force
+Usage:
+  prune [flags]
+
+Flags:
+      --dry-run       
+      --force   bool  
+  -h, --help          help for prune
+
+`,
+				code: 2,
+			},
+		},
+		{
+			args: []string{"--help"},
+			want: result{
+				stdout: `Usage:
+  prune [flags]
+
+Flags:
+      --dry-run       
+      --force   bool  
+  -h, --help          help for prune
+`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			diff(t, test.want, run(t, p, test.args))
+		})
+	}
+}
+
+func TestWithArgNames(t *testing.T) {
+	var (
+		p     = climate.Func(cp, climate.WithArgs(climate.RangeArgs(2, 3)), climate.WithArgNames("source", "dest"))
+		md    = climate.WithMetadata(metadata(map[string][]string{"cp": {"paths"}}))
+		tests = []struct {
+			name string
+			args []string
+			mods []func(*internal.RunOptions)
+			want result
+		}{
+			{
+				name: "help",
+				args: []string{"--help"},
+				mods: []func(*internal.RunOptions){md},
+				want: result{
+					stdout: `Usage:
+  cp <source> <dest> [paths]
+
+Flags:
+  -h, --help  help for cp
+`,
+				},
+			},
+			{
+				name: "help-without-metadata",
+				args: []string{"--help"},
+				want: result{
+					stdout: `Usage:
+  cp <source> <dest> [args] [flags]
+
+Flags:
+  -h, --help  help for cp
+`,
+				},
+			},
+			{
+				name: "missing-one",
+				args: []string{"a"},
+				want: result{
+					stderr: `Error: cp: missing argument: dest
+Usage:
+  cp <source> <dest> [args] [flags]
+
+Flags:
+  -h, --help  help for cp
+
+`,
+					code: 2,
+				},
+			},
+			{
+				name: "missing-both",
+				want: result{
+					stderr: `Error: cp: missing arguments: source, dest
+Usage:
+  cp <source> <dest> [args] [flags]
+
+Flags:
+  -h, --help  help for cp
+
+`,
+					code: 2,
+				},
+			},
+			{
+				name: "too-many",
+				args: []string{"a", "b", "c", "d"},
+				want: result{
+					stderr: `Error: cp accepts at most 3 arg(s), received 4
+Usage:
+  cp <source> <dest> [args] [flags]
+
+Flags:
+  -h, --help  help for cp
+
+`,
+					code: 2,
+				},
+			},
+		}
+	)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff(t, test.want, run(t, p, test.args, test.mods...))
+		})
+	}
+	t.Run("unbounded", func(t *testing.T) {
+		p := climate.Func(cp, climate.WithArgNames("source"))
+		want := result{
+			stdout: `Usage:
+  cp [source] [args...] [flags]
+
+Flags:
+  -h, --help  help for cp
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}))
+	})
+}
+
+func TestGroupCommands(t *testing.T) {
+	var (
+		p    = climate.Struct[cloud](climate.Struct[vm]())
+		help = `Usage:
+  cloud vm [command]
+
+Available Commands:
+  list        
+
+Flags:
+      --zone string (default a)  
+  -h, --help                     help for vm
+
+Global Flags:
+  --region string (default us)
+
+Use "cloud vm [command] --help" for more information about a command.
+`
+		typo = result{
+			stderr: `Error: unknown command "lisst" for "cloud vm"
+
+Did you mean this?
+	list
+
+Run 'cloud vm --help' for usage.
+`,
+			code: 2,
+		}
+	)
+	diff(t, result{stdout: help}, run(t, p, []string{"vm"}))
+	diff(t, typo, run(t, p, []string{"vm", "lisst"}))
+	t.Run("exit-code", func(t *testing.T) {
+		code := climate.WithGroupExitCode(1)
+		diff(t, result{stderr: help, code: 1}, run(t, p, []string{"vm"}, code))
+		diff(t, typo, run(t, p, []string{"vm", "lisst"}, code))
+		diff(t, result{stdout: "us a\n"}, run(t, p, []string{"vm", "list"}, code))
+	})
+}
+
+func TestWithArgsTransform(t *testing.T) {
+	var (
+		p       = climate.Struct[cloud](climate.Struct[vm]())
+		renamed = climate.WithArgsTransform(func(args []string) []string {
+			for i, arg := range args {
+				if arg == "-region" { // the old (Go flag style) spelling
+					args[i] = "--region"
+				}
+			}
+			return args
+		})
+		// list used to be a top-level command.
+		moved = climate.WithArgsTransform(func(args []string) []string {
+			if len(args) > 0 && args[len(args)-1] == "list" {
+				return append(args[:len(args)-1], "vm", "list")
+			}
+			return args
+		})
+		args = []string{"-region", "eu", "list"}
+	)
+	diff(t, result{stdout: "eu a\n"}, run(t, p, args, renamed, moved))
+	if want := []string{"-region", "eu", "list"}; !slices.Equal(args, want) {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+}
+
+type patchOptions struct {
+	Replicas *int
+	Image    *string `cli:"short"`
+	Paused   *bool
+	Timeout  *time.Duration
+}
+
+func patch(opts *patchOptions) {
+	var fields []string
+	if opts.Replicas != nil {
+		fields = append(fields, fmt.Sprint("replicas=", *opts.Replicas))
+	}
+	if opts.Image != nil {
+		fields = append(fields, fmt.Sprintf("image=%q", *opts.Image))
+	}
+	if opts.Paused != nil {
+		fields = append(fields, fmt.Sprint("paused=", *opts.Paused))
+	}
+	if opts.Timeout != nil {
+		fields = append(fields, fmt.Sprint("timeout=", *opts.Timeout))
+	}
+	fmt.Println(strings.Join(fields, " "))
+}
+
+func TestOptionalFlags(t *testing.T) {
+	p := climate.Func(patch)
+	tests := []struct {
+		args []string
+		want result
+	}{
+		{
+			args: nil,
+			want: result{stdout: "\n"},
+		},
+		{
+			args: []string{"--replicas=0", "-i", "", "--paused=false"},
+			want: result{stdout: "replicas=0 image=\"\" paused=false\n"},
+		},
+		{
+			args: []string{"--paused", "--timeout=1m"},
+			want: result{stdout: "paused=true timeout=1m0s\n"},
+		},
+		{
+			args: []string{"--replicas=x"},
+			want: result{
+				stderr: `Error: invalid argument "x" for "--replicas" flag: strconv.ParseInt: parsing "x": invalid syntax
+Usage:
+  patch [flags]
+
+Flags:
+      --replicas int       
+  -i, --image    string    
+      --paused             
+      --timeout  duration  
+  -h, --help               help for patch
+
+`,
+				code: 2,
+			},
+		},
+		{
+			args: []string{"--help"},
+			want: result{
+				stdout: `Usage:
+  patch [flags]
+
+Flags:
+      --replicas int       
+  -i, --image    string    
+      --paused             
+      --timeout  duration  
+  -h, --help               help for patch
+`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			diff(t, test.want, run(t, p, test.args))
+		})
+	}
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("PATCH_REPLICAS", "0")
+		diff(t, result{stdout: "replicas=0\n"}, run(t, p, nil, climate.WithEnvPrefix("PATCH")))
+	})
+	t.Run("compiled", func(t *testing.T) {
+		cp, err := climate.Compile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The pointers are reset to nil between runs, like with any other flag.
+		for _, test := range []struct {
+			args []string
+			want string
+		}{
+			{args: []string{"--replicas=3"}, want: "replicas=3\n"},
+			{args: nil, want: "\n"},
+		} {
+			if stdout, _, _, _ := cp.Execute(context.Background(), test.args); stdout != test.want {
+				t.Errorf("Execute(%q) = %q, want %q", test.args, stdout, test.want)
+			}
+		}
+	})
+}
+
+func TestGenRSTTree(t *testing.T) {
+	dir := t.TempDir()
+	if err := climate.GenRSTTree(climate.Struct[remote](), dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := climate.GenRSTTree(climate.Func(gateway), dir); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file, want string
+	}{
+		{
+			file: "remote.rst",
+			want: `remote
+======
+
+.. program:: remote
+
+Synopsis
+--------
+
+.. code-block:: text
+
+   remote [command]
+
+Flags
+-----
+
+.. option:: -v, --verbose
+
+.. option:: -h, --help
+
+   help for remote
+
+See Also
+--------
+
+* :doc:` + "`" + `remote add <remote_add>` + "`" + `
+* :doc:` + "`" + `remote remove <remote_remove>` + "`" + `
+`,
+		},
+		{
+			file: "remote_add.rst",
+			want: `remote add
+==========
+
+.. program:: remote add
+
+Synopsis
+--------
+
+.. code-block:: text
+
+   remote add [flags]
+
+Flags
+-----
+
+.. option:: -h, --help
+
+   help for add
+
+Global Flags
+------------
+
+.. option:: -v, --verbose
+
+See Also
+--------
+
+* :doc:` + "`" + `remote <remote>` + "`" + `
+`,
+		},
+		{
+			file: "gateway.rst",
+			want: `gateway
+=======
+
+.. program:: gateway
+
+Synopsis
+--------
+
+.. code-block:: text
+
+   gateway [flags]
+
+Flags
+-----
+
+.. option:: --listen <string>
+
+.. option:: --verbose
+
+.. option:: -h, --help
+
+   help for gateway
+
+Connection
+~~~~~~~~~~
+
+.. option:: --host <string>
+
+.. option:: --port <int>
+
+TLS
+~~~
+
+.. option:: --tls-cert-file <string>
+
+Security
+~~~~~~~~
+
+.. option:: --tls-insecure
+
+`,
+		},
+	}
+	for _, test := range tests {
+		got := string(assert.Ok(os.ReadFile(filepath.Join(dir, test.file))))
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%v: diff(-want +got):\n%v", test.file, diff)
+		}
+	}
+}
+
+type janitor struct{}
+
+func (j *janitor) Purge(ctx context.Context, paths []string) {
+	for _, path := range paths {
+		if climate.DryRun(ctx) {
+			fmt.Println("would purge", path)
+			continue
+		}
+		fmt.Println("purged", path)
+	}
+}
+
+func TestWithDryRunFlag(t *testing.T) {
+	var (
+		p      = climate.Struct[janitor]()
+		dryRun = climate.WithDryRunFlag()
+	)
+	diff(t, result{stdout: "would purge a\nwould purge b\n"}, run(t, p, []string{"--dry-run", "purge", "a", "b"}, dryRun))
+	diff(t, result{stdout: "purged a\n"}, run(t, p, []string{"purge", "a"}, dryRun))
+	// Without the modifier, there's no --dry-run and DryRun is always false.
+	diff(t, result{stdout: "purged a\n"}, run(t, p, []string{"purge", "a"}))
+	want := result{
+		stdout: `Usage:
+  janitor purge [flags]
+
+Flags:
+  -h, --help  help for purge
+
+Global Flags:
+  --dry-run  show what would be done, without doing it
+`,
+	}
+	diff(t, want, run(t, p, []string{"purge", "--help"}, dryRun))
+}
+
+type zone string
+
+type provisionOptions struct {
+	Zone    zone
+	Mirrors []string
+}
+
+func provision(opts *provisionOptions) {
+	fmt.Println(opts.Zone, opts.Mirrors)
+}
+
+func TestWithEnumSource(t *testing.T) {
+	var (
+		p     = climate.Func(provision)
+		zones = climate.WithEnumSource("zone", func(context.Context) ([]string, error) {
+			return []string{"us-east", "us-west", "eu-west"}, nil
+		})
+		mirrors = climate.WithEnumSource("mirrors", func(context.Context) ([]string, error) {
+			return nil, errors.New("mirrors unavailable")
+		})
+	)
+	diff(t, result{stdout: "us-west []\n"}, run(t, p, []string{"--zone=us-west"}, zones))
+	got := run(t, p, []string{"--zone=ap-south"}, zones)
+	if want := "Error: invalid value \"ap-south\" for --zone: must be one of us-east, us-west, eu-west\nUsage:\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+		t.Errorf("run(--zone=ap-south) = %+v, want prefix %q and code 2", got, want)
+	}
+	// The values are only fetched (and validated against) when the flag is set.
+	diff(t, result{stdout: " []\n"}, run(t, p, nil, zones, mirrors))
+	diff(t, result{stderr: "Error: --mirrors: mirrors unavailable\n", code: 1}, run(t, p, []string{"--mirrors=a"}, mirrors))
+	t.Run("complete", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--zone", "us"}, zones)
+		diff(t, result{stdout: "us-east\nus-west\n:4\n"}, result{stdout: got.stdout})
+		got = run(t, p, []string{"__complete", "--mirrors", ""}, mirrors)
+		diff(t, result{stdout: ":1\n"}, result{stdout: got.stdout})
+	})
+	t.Run("exit", func(t *testing.T) {
+		regions := climate.WithEnumSource("zone", func(context.Context) ([]string, error) {
+			return nil, fmt.Errorf("zones: %w", climate.ErrExit(5))
+		})
+		diff(t, result{stderr: "Error: zones\n", code: 5}, run(t, p, []string{"--zone=a"}, regions))
+	})
+	t.Run("with-completion", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "both WithEnumSource and WithCompletion for: --zone"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, p, nil, zones, climate.WithCompletion("zone", nil))
+	})
+}
+
+func vendor(paths []string) {
+	fmt.Println("vendor", paths)
+}
+
+func TestRunHooksFunc(t *testing.T) {
+	var (
+		p     = climate.Func(vendor)
+		check = func(env string) func(*internal.RunOptions) {
+			return climate.WithPreRun(func(ctx context.Context) (context.Context, error) {
+				if env == "" {
+					return ctx, climate.ErrExit(4, errors.New("GOPATH not set"))
+				}
+				return context.WithValue(ctx, dbKey{}, env), nil
+			})
+		}
+		post = climate.WithPostRun(func(ctx context.Context, runErr error) error {
+			fmt.Println("post", ctx.Value(dbKey{}), runErr)
+			return nil
+		})
+	)
+	t.Run("ok", func(t *testing.T) {
+		want := result{stdout: "vendor [a b]\npost /go <nil>\n"}
+		diff(t, want, run(t, p, []string{"a", "b"}, check("/go"), post))
+	})
+	t.Run("abort", func(t *testing.T) {
+		want := result{stderr: "Error: GOPATH not set\n", code: 4}
+		diff(t, want, run(t, p, []string{"a"}, check(""), post))
+	})
+}
+
+func lookup(key string) {}
+
+func TestWithExitCodes(t *testing.T) {
+	var (
+		p     = climate.Func(lookup)
+		codes = climate.WithExitCodes(map[int]string{3: "denied", 2: "not found"})
+	)
+	t.Run("help", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  lookup [flags]
+
+Flags:
+  -h, --help  help for lookup
+
+Exit Codes:
+  2  not found
+  3  denied
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}, codes))
+	})
+	t.Run("usage-error", func(t *testing.T) {
+		got := run(t, p, []string{"--bad"}, codes)
+		if strings.Contains(got.stderr, "Exit Codes:") {
+			t.Errorf("run(--bad) = %+v, want no exit codes in stderr", got)
+		}
+	})
+	t.Run("merge", func(t *testing.T) {
+		got := run(t, p, []string{"--help"}, codes, climate.WithExitCodes(map[int]string{3: "forbidden"}))
+		if want := "  3  forbidden\n"; !strings.HasSuffix(got.stdout, want) {
+			t.Errorf("run(--help) = %+v, want %q suffix in stdout", got, want)
+		}
+	})
+	t.Run("markdown", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := climate.GenMarkdownTree(p, dir, codes); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, "lookup.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "### Exit Codes\n\n| Code | Meaning |\n| --- | --- |\n| `2` | not found |\n| `3` | denied |\n"
+		if !strings.Contains(string(got), want) {
+			t.Errorf("lookup.md = %s, want %q in it", got, want)
+		}
+	})
+	t.Run("man", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := climate.GenManTree(p, dir, codes); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, "lookup.1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ".SH EXIT STATUS"; !strings.Contains(string(got), want) {
+			t.Errorf("lookup.1 = %s, want %q in it", got, want)
+		}
+	})
+}
+
+type shoutOptions struct {
+	Times int
+}
+
+func shout(ctx context.Context, opts *shoutOptions, w io.Writer, words []string) error {
+	for range opts.Times {
+		if _, err := fmt.Fprintln(w, strings.ToUpper(strings.Join(words, " "))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWriterParam(t *testing.T) {
+	p := climate.Func(shout)
+	t.Run("stdout", func(t *testing.T) {
+		want := result{stdout: "HELLO WORLD\nHELLO WORLD\n"}
+		diff(t, want, run(t, p, []string{"--times=2", "hello", "world"}))
+	})
+	t.Run("output", func(t *testing.T) {
+		var b strings.Builder
+		diff(t, result{}, run(t, p, []string{"--times=1", "hi"}, climate.WithOutput(&b)))
+		if got, want := b.String(), "HI\n"; got != want {
+			t.Errorf("WithOutput(...) = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestFlagValueCompletion(t *testing.T) {
+	branches := climate.WithCompletion("branch", func(_ context.Context, toComplete string) ([]string, error) {
+		return []string{toComplete + "-main"}, nil
+	})
+	zones := climate.WithEnumSource("zone", func(context.Context) ([]string, error) {
+		return []string{"us-east", "eu-west"}, nil
+	})
+	tests := []struct {
+		name string
+		p    internal.Plan
+		args []string
+		mods []func(*internal.RunOptions)
+		want string
+	}{
+		{"enum", climate.Func(export), []string{"--color", "al"}, nil, "always\n:4\n"},
+		{"enum=", climate.Func(export), []string{"--color=al"}, nil, "always\n:4\n"},
+		{"enum-short", climate.Func(export), []string{"-f", "j"}, nil, "json\n:4\n"},
+		{"enum-short=", climate.Func(export), []string{"-f=j"}, nil, "json\n:4\n"},
+		{"dynamic", climate.Func(checkout), []string{"--branch", "b"}, []func(*internal.RunOptions){branches}, "b-main\n:4\n"},
+		{"dynamic=", climate.Func(checkout), []string{"--branch=b"}, []func(*internal.RunOptions){branches}, "b-main\n:4\n"},
+		{"source", climate.Func(provision), []string{"--zone", "eu"}, []func(*internal.RunOptions){zones}, "eu-west\n:4\n"},
+		{"source=", climate.Func(provision), []string{"--zone=eu"}, []func(*internal.RunOptions){zones}, "eu-west\n:4\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := run(t, test.p, append([]string{"__complete"}, test.args...), test.mods...)
+			diff(t, result{stdout: test.want}, result{stdout: got.stdout})
+		})
+	}
+}
+
+func resolve(host string) error {
+	if strings.HasSuffix(host, ".invalid") {
+		return climate.ErrExit(3, fmt.Errorf("%v: not found", host))
+	}
+	return nil
+}
+
+func TestWithReturnError(t *testing.T) {
+	var (
+		p              = climate.Func(resolve)
+		stdout, stderr strings.Builder
+		mods           = []func(*internal.RunOptions){
+			climate.WithReturnError(),
+			climate.WithOutput(&stdout),
+			climate.WithError(&stderr),
+		}
+	)
+	tests := []struct {
+		name    string
+		args    []string
+		code    int
+		usage   bool
+		runtime bool
+		err     string
+	}{
+		{"ok", []string{"example.com"}, 0, false, false, ""},
+		{"usage", []string{"--port=53"}, 2, true, false, "unknown flag: --port"},
+		{"args", nil, 2, true, false, "resolve accepts 1 arg(s), received 0"},
+		{"runtime", []string{"example.invalid"}, 3, false, true, "example.invalid: not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout.Reset()
+			stderr.Reset()
+			code, err := climate.RunE(context.Background(), p, test.args, mods...)
+			var (
+				uerr *climate.UsageError
+				rerr *climate.RuntimeError
+			)
+			if code != test.code || errors.As(err, &uerr) != test.usage || errors.As(err, &rerr) != test.runtime {
+				t.Errorf("RunE(%q) = %v, %#v; want %v (usage: %v, runtime: %v)",
+					test.args, code, err, test.code, test.usage, test.runtime)
+			}
+			if err != nil && err.Error() != test.err {
+				t.Errorf("RunE(%q) = %q, want %q", test.args, err, test.err)
+			}
+			if stdout.Len() > 0 || stderr.Len() > 0 {
+				t.Errorf("RunE(%q) wrote %q, %q; want nothing", test.args, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestWithCaseInsensitiveCommands(t *testing.T) {
+	var (
+		p       = climate.Struct[remote]()
+		ci      = climate.WithCaseInsensitiveCommands()
+		aliases = func() func(*internal.RunOptions) {
+			var rmd internal.RawMetadata
+			rmd.Child(pkgPath).Child("remote").Child("Remove").Directives = map[string]string{"aliases": "rm"}
+			return climate.WithMetadata(rmd.Encode())
+		}()
+	)
+	t.Run("default", func(t *testing.T) {
+		got := run(t, p, []string{"ADD", "origin"})
+		if want := "Error: unknown command \"ADD\" for \"remote\""; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(ADD origin) = %+v, want prefix %q and code 2", got, want)
+		}
+	})
+	t.Run("command", func(t *testing.T) {
+		diff(t, result{}, run(t, p, []string{"Add", "origin"}, ci))
+		diff(t, result{}, run(t, p, []string{"ADD", "origin"}, ci))
+		diff(t, result{}, run(t, p, []string{"-v", "ADD", "origin"}, ci))
+	})
+	t.Run("alias", func(t *testing.T) {
+		want := result{
+			stdout: `Usage:
+  remote remove
+
+Aliases:
+  remove, rm
+
+Flags:
+  -h, --help  help for remove
+
+Global Flags:
+  -v, --verbose
+`,
+		}
+		diff(t, want, run(t, p, []string{"RM", "--help"}, ci, aliases))
+		diff(t, want, run(t, p, []string{"help", "RM"}, ci, aliases))
+	})
+	if cobra.EnableCaseInsensitive {
+		t.Error("cobra.EnableCaseInsensitive = true after Run, want false")
+	}
+}
+
+type shipOptions struct {
+	Env     string
+	Message string
+}
+
+func ship(opts *shipOptions, args []string) {
+	fmt.Printf("%q %q %q\n", opts.Env, opts.Message, args)
+}
+
+func TestWithArgsFileExpansion(t *testing.T) {
+	var (
+		p     = climate.Func(ship)
+		dir   = t.TempDir()
+		write = func(name, content string) string {
+			path := filepath.Join(dir, name)
+			assert.Nil(os.WriteFile(path, []byte(content), 0o644))
+			return "@" + path
+		}
+		expand = climate.WithArgsFileExpansion()
+	)
+	common := write("common.args", "--env=prod # the default\n")
+	release := write("release.args", common+"\n--message \"ship \\\"it\\\"\" 'a b' c\\ d\n# done\n")
+	t.Run("expand", func(t *testing.T) {
+		want := result{stdout: `"prod" "ship \"it\"" ["a b" "c d" "x"]` + "\n"}
+		diff(t, want, run(t, p, []string{release, "x"}, expand))
+	})
+	t.Run("dash", func(t *testing.T) {
+		want := result{stdout: `"prod" "" ["` + common + `"]` + "\n"}
+		diff(t, want, run(t, p, []string{common, "--", common}, expand))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		want := result{stdout: `"" "" ["` + common + `"]` + "\n"}
+		diff(t, want, run(t, p, []string{common}))
+	})
+	t.Run("missing", func(t *testing.T) {
+		want := result{
+			stderr: "Error: reading args file: open " + filepath.Join(dir, "missing.args") + ": no such file or directory\n",
+			code:   2,
+		}
+		diff(t, want, run(t, p, []string{"@" + filepath.Join(dir, "missing.args")}, expand))
+	})
+	t.Run("unterminated", func(t *testing.T) {
+		bad := write("bad.args", `--message "oops`)
+		want := result{stderr: "Error: " + bad + ": unterminated \" quote\n", code: 2}
+		diff(t, want, run(t, p, []string{bad}, expand))
+	})
+	t.Run("loop", func(t *testing.T) {
+		loop := "@" + filepath.Join(dir, "loop.args")
+		write("loop.args", loop)
+		want := result{stderr: "Error: " + loop + ": args files nested too deeply (more than 10 levels)\n", code: 2}
+		diff(t, want, run(t, p, []string{loop}, expand))
+	})
+}
+
+type ingestOptions struct {
+	Stdin bool   `cli:"onerequired=input,exclusive=input"`
+	File  string `cli:"onerequired=input,exclusive=input"`
+	URL   string `cli:"onerequired=input,exclusive=input"`
+}
+
+func ingest(opts *ingestOptions) {
+	fmt.Println(opts.Stdin, opts.File, opts.URL)
+}
+
+func TestOneRequired(t *testing.T) {
+	tests := []struct {
+		name string
+		p    internal.Plan
+		args []string
+		mods []func(*internal.RunOptions)
+		want string
+	}{
+		{
+			name: "tags",
+			p:    climate.Func(ingest),
+			want: "Error: at least one of the flags in the group [file stdin url] is required\n",
+		},
+		{
+			name: "tags-exclusive",
+			p:    climate.Func(ingest),
+			args: []string{"--file=a", "--url=b"},
+			want: "Error: if any flags in the group [file stdin url] are set none of the others can be; [file url] were all set\n",
+		},
+		{
+			name: "modifier",
+			p:    climate.Func(login),
+			mods: []func(*internal.RunOptions){climate.WithOneRequired("json", "yaml")},
+			want: "Error: at least one of the flags in the group [json yaml] is required\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := run(t, test.p, test.args, test.mods...)
+			if got.code != 2 || !strings.HasPrefix(got.stderr, test.want) {
+				t.Errorf("run(%v) = %+v, want prefix %q", test.args, got, test.want)
+			}
+		})
+	}
+	t.Run("ok", func(t *testing.T) {
+		diff(t, result{stdout: "false a \n"}, run(t, climate.Func(ingest), []string{"--file=a"}))
+	})
+}
+
+func TestWithCompactHelp(t *testing.T) {
+	var (
+		p       = climate.Struct[remote]()
+		compact = climate.WithCompactHelp()
+	)
+	t.Run("parent", func(t *testing.T) {
+		want := result{
+			stdout: `Usage: remote [command]
+Commands:
+  add         
+  completion  Generate the autocompletion script for the specified shell
+  help        Help about any command
+  remove      
+Flags:
+  -v, --verbose  
+  -h, --help     help for remote
+`,
+		}
+		diff(t, want, run(t, p, []string{"--help"}, compact))
+	})
+	t.Run("child", func(t *testing.T) {
+		want := result{
+			stdout: `Usage: remote add [flags]
+Flags:
+  -v, --verbose  
+  -h, --help     help for add
+`,
+		}
+		diff(t, want, run(t, p, []string{"add", "--help"}, compact))
+	})
+	t.Run("usage-error", func(t *testing.T) {
+		want := result{
+			stderr: `Error: remote add accepts 1 arg(s), received 0
+Usage: remote add [flags]
+Flags:
+  -v, --verbose  
+  -h, --help     help for add
+
+`,
+			code: 2,
+		}
+		diff(t, want, run(t, p, []string{"add"}, compact))
+	})
+	t.Run("template", func(t *testing.T) {
+		tmpl := climate.WithHelpTemplate("{{.Name}}\n")
+		diff(t, result{stdout: "add\n"}, run(t, p, []string{"add", "--help"}, compact, tmpl))
+	})
+}
+
+type labelOptions struct {
+	Label string
+}
+
+func label(opts *labelOptions, args []string) {}
+
+func TestSetCompletionDirective(t *testing.T) {
+	var (
+		labels = climate.WithCompletion("label", func(ctx context.Context, toComplete string) ([]string, error) {
+			key, _, ok := strings.Cut(toComplete, "=")
+			if !ok {
+				climate.SetCompletionDirective(ctx, cobra.ShellCompDirectiveNoSpace|cobra.ShellCompDirectiveNoFileComp)
+				return []string{"env=", "team="}, nil
+			}
+			return []string{key + "=prod", key + "=dev"}, nil
+		})
+		files = func(ctx context.Context, _ []string, _ string) ([]string, error) {
+			climate.SetCompletionDirective(ctx, cobra.ShellCompDirectiveDefault)
+			return nil, nil
+		}
+		p = climate.Func(label, climate.WithArgCompletion(files))
+	)
+	t.Run("directive", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--label", ""}, labels)
+		diff(t, result{stdout: "env=\nteam=\n:6\n"}, result{stdout: got.stdout})
+	})
+	t.Run("default", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "--label=env="}, labels)
+		diff(t, result{stdout: "env=prod\nenv=dev\n:4\n"}, result{stdout: got.stdout})
+	})
+	t.Run("args", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", ""}, labels)
+		diff(t, result{stdout: ":0\n"}, result{stdout: got.stdout})
+	})
+	t.Run("outside", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("recover() = nil, want panic")
+			}
+		}()
+		climate.SetCompletionDirective(context.Background(), cobra.ShellCompDirectiveNoSpace)
+	})
+}
+
+type secureOptions struct {
+	TLS  bool
+	CA   string
+	Cert string `cli:"requires=tls|ca"`
+	Key  string `cli:"requires=tls"`
+	User string
+	Pass string
+}
+
+func secure(opts *secureOptions) {
+	fmt.Println(opts.TLS, opts.Cert, opts.User)
+}
+
+func TestRequires(t *testing.T) {
+	var (
+		p    = climate.Func(secure)
+		pass = climate.WithRequires("pass", "user")
+	)
+	t.Run("ok", func(t *testing.T) {
+		args := []string{"--tls", "--ca=ca.pem", "--cert=a.pem", "--user=me"}
+		diff(t, result{stdout: "true a.pem me\n"}, run(t, p, args, pass))
+	})
+	t.Run("one-directional", func(t *testing.T) {
+		diff(t, result{stdout: "true  me\n"}, run(t, p, []string{"--tls", "--user=me"}, pass))
+	})
+	t.Run("violations", func(t *testing.T) {
+		got := run(t, p, []string{"--cert=a.pem", "--key=a.key", "--pass=hunter2"}, pass)
+		want := "Error: --cert requires --tls, --ca\n--key requires --tls\n--pass requires --user\nUsage:\n"
+		if got.code != 2 || !strings.HasPrefix(got.stderr, want) {
+			t.Errorf("run(...) = %+v, want prefix %q and code 2", got, want)
+		}
+	})
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("SECURE_TLS", "true")
+		got := run(t, p, []string{"--key=a.key"}, climate.WithEnvPrefix("SECURE"))
+		diff(t, result{stdout: "true  \n"}, got)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "no flag for requires: token"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		run(t, p, nil, climate.WithRequires("token", "user"))
+	})
+}
+
+func TestWithPluginPrefix(t *testing.T) {
+	var (
+		p      = climate.Struct[remote]()
+		dir    = t.TempDir()
+		plugin = func(name, script string) {
+			path := filepath.Join(dir, "remote-"+name)
+			assert.Nil(os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755))
+		}
+		prefix = climate.WithPluginPrefix("remote-")
+	)
+	plugin("hello", `echo hello "$@"`)
+	plugin("fail", `echo oops >&2; exit 3`)
+	plugin("add", `echo shadowed`)
+	plugin("killed", `kill -KILL $$`)
+	// The plugin signals Run, which should then forward the signal to it.
+	plugin("graceful", `trap 'echo shutting down; exit 7' TERM; kill -TERM $PPID; while :; do sleep 0.1; done`)
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	t.Run("plugin", func(t *testing.T) {
+		want := result{stdout: "hello world --loud\n"}
+		diff(t, want, run(t, p, []string{"hello", "world", "--loud"}, prefix))
+	})
+	t.Run("exit-code", func(t *testing.T) {
+		want := result{stderr: "oops\n", code: 3}
+		diff(t, want, run(t, p, []string{"fail"}, prefix))
+	})
+	t.Run("killed", func(t *testing.T) {
+		diff(t, result{code: 128 + int(syscall.SIGKILL)}, run(t, p, []string{"killed"}, prefix))
+	})
+	t.Run("signals", func(t *testing.T) {
+		want := result{stdout: "shutting down\n", code: 7}
+		diff(t, want, run(t, p, []string{"graceful"}, prefix, climate.WithSignals(syscall.SIGTERM)))
+	})
+	t.Run("builtin", func(t *testing.T) {
+		diff(t, result{}, run(t, p, []string{"add", "origin"}, prefix))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		got := run(t, p, []string{"hello"})
+		if got.code != 2 || !strings.Contains(got.stderr, `unknown command "hello"`) {
+			t.Errorf("got %+v, want an unknown command error", got)
+		}
+	})
+	t.Run("help", func(t *testing.T) {
+		got := run(t, p, []string{"--help"}, prefix)
+		if want := "\nPlugins:\n  fail\n  graceful\n  hello\n  killed\n"; !strings.HasSuffix(got.stdout, want) {
+			t.Errorf("got:\n%v\nwant suffix:\n%v", got.stdout, want)
+		}
+	})
+}
+
+type editor struct{}
+
+func (*editor) Open(files []string) {
+	fmt.Println(files)
+}
+
+func (*editor) Close() {}
+
+func TestMethod(t *testing.T) {
+	p := climate.Method(climate.Struct[editor](), "Open",
+		climate.WithArgs(climate.MinimumArgs(1)),
+		climate.WithArgNames("file"),
+		climate.WithArgCompletion(func(_ context.Context, _ []string, toComplete string) ([]string, error) {
+			return []string{toComplete + ".go", toComplete + ".md"}, nil
+		}))
+	t.Run("run", func(t *testing.T) {
+		diff(t, result{stdout: "[a.go b.go]\n"}, run(t, p, []string{"open", "a.go", "b.go"}))
+	})
+	t.Run("args", func(t *testing.T) {
+		got := run(t, p, []string{"open"})
+		if want := "Error: editor open: missing argument: file\n"; !strings.HasPrefix(got.stderr, want) || got.code != 2 {
+			t.Errorf("run(open) = %+v, want prefix %q", got, want)
+		}
+	})
+	t.Run("complete", func(t *testing.T) {
+		got := run(t, p, []string{"__complete", "open", "main"})
+		diff(t, result{stdout: "main.go\nmain.md\n:4\n"}, result{stdout: got.stdout})
+	})
+	t.Run("no-method", func(t *testing.T) {
+		defer func() {
+			if got, want := recover(), "no method Save on: *climate_test.editor"; got != want {
+				t.Errorf("recover() = %v, want %v", got, want)
+			}
+		}()
+		climate.Method(climate.Struct[editor](), "Save")
+	})
+}
+
+func TestExitFromHooks(t *testing.T) {
+	p := climate.Func(proceed)
+	t.Run("pre-run", func(t *testing.T) {
+		hook := climate.WithPreRun(func(ctx context.Context) (context.Context, error) {
+			climate.Exit(ctx, 4)
+			return ctx, nil
+		})
+		diff(t, result{code: 4}, run(t, p, []string{"yes"}, hook))
+	})
+	t.Run("post-run", func(t *testing.T) {
+		hook := climate.WithPostRun(func(ctx context.Context, err error) error {
+			climate.Exit(ctx, 5)
+			return err
+		})
+		diff(t, result{stdout: "confirmed\ncleanup\n", code: 5}, run(t, p, []string{"yes"}, hook))
+	})
+	t.Run("completion", func(t *testing.T) {
+		p := climate.Func(cp, climate.WithArgCompletion(func(ctx context.Context, _ []string, _ string) ([]string, error) {
+			climate.Exit(ctx, 6)
+			return []string{"unreachable"}, nil
+		}))
+		got := run(t, p, []string{"__complete", "a"})
+		diff(t, result{stdout: ":1\n"}, result{stdout: got.stdout})
+	})
+}
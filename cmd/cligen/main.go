@@ -4,6 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -24,13 +27,16 @@ func parseFunc(f *ast.FuncDecl, pkgMd *internal.RawMetadata) {
 	if f.Recv != nil {
 		assert.Truef(len(f.Recv.List) == 1,
 			"not exactly one receiver: %v", litter.Sdump(f.Recv.List))
-		recv := f.Recv.List[0]
-		// We only support pointer receivers, skip others.
-		e, ok := recv.Type.(*ast.StarExpr)
-		if !ok {
+		t := f.Recv.List[0].Type
+		// Methods with both pointer and value receivers become subcommands.
+		if e, ok := t.(*ast.StarExpr); ok {
+			t = e.X
+		}
+		ident, ok := t.(*ast.Ident)
+		if !ok { // generic receivers, for example
 			return
 		}
-		parentMd = pkgMd.Child(e.X.(*ast.Ident).Name)
+		parentMd = pkgMd.Child(ident.Name)
 	}
 	md := parentMd.Child(f.Name.Name)
 	md.SetDoc(f.Doc)
@@ -63,6 +69,35 @@ func parseType(g *ast.GenDecl, pkgMd *internal.RawMetadata) {
 	}
 }
 
+// parseConsts records the (string) constants of named types in this package as
+// children of their types, so they can be described in (enum) completions.
+func parseConsts(g *ast.GenDecl, pkg *packages.Package, pkgMd *internal.RawMetadata) {
+	for _, spec := range g.Specs {
+		spec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		doc := spec.Doc
+		if doc == nil && len(g.Specs) == 1 {
+			doc = g.Doc
+		}
+		for _, n := range spec.Names {
+			c, ok := pkg.TypesInfo.Defs[n].(*types.Const)
+			if !ok || c.Val().Kind() != constant.String {
+				continue
+			}
+			t, ok := c.Type().(*types.Named)
+			if !ok || t.Obj().Pkg() != pkg.Types {
+				continue
+			}
+			md := pkgMd.Child(t.Obj().Name()).Child(n.Name)
+			md.SetDoc(doc)
+			md.SetComment(spec.Comment)
+			md.Value = constant.StringVal(c.Val())
+		}
+	}
+}
+
 func parsePkg(pkg *packages.Package, rootMd *internal.RawMetadata) {
 	pkgMd := rootMd.Child(pkg.PkgPath)
 	if pkg.Name == "main" {
@@ -82,6 +117,10 @@ func parsePkg(pkg *packages.Package, rootMd *internal.RawMetadata) {
 			case *ast.FuncDecl:
 				parseFunc(decl, pkgMd)
 			case *ast.GenDecl:
+				if decl.Tok == token.CONST {
+					parseConsts(decl, pkg, pkgMd)
+					continue
+				}
 				parseType(decl, pkgMd)
 			}
 		}
@@ -9,10 +9,19 @@ import (
 )
 
 // Exported struct fields are automatically declared as flags --
-//	1. Field names are converted to kebab-case and are used as flag names.
+//	1. Field names are converted to kebab-case and are used as flag names
+//	   (unless overridden via "name" subfield tags under the "cli" tags).
+//	   Acronyms are kept together, so URL is --url and HTTPSProxy is
+//	   --https-proxy.
 //	   That said, users can pass flags in camelCase, PascalCase, snake_case or
 //	   SCREAMING_SNAKE_CASE and everything just works (thanks to normalization).
-//	2. Field types are used as flag types (string, bool, int, etc.).
+//	2. Field types are used as flag types (string, bool, int, etc.). Types
+//	   that implement encoding.TextUnmarshaler (net.IP, for example) are used
+//	   via UnmarshalText (and MarshalText, if implemented, for the defaults),
+//	   taking precedence over their kinds (but not over time.Duration,
+//	   time.Time and climate.ByteSize, which are handled specially). Any type
+//	   can also be registered explicitly via climate.RegisterFlagType (which
+//	   takes precedence over everything else).
 //	3. "short" subfield tags (under the "cli" tags) are used as short flag names
 //	   (as is). It's also possible to omit the value, in which case the first
 //	   letter of the field name is used.
@@ -21,6 +30,31 @@ import (
 //	5. Field docs / comments are used* as flag usage strings (as is).
 //	6. "required" subfield tags (under the "cli" tags) are used to mark the
 //	   flags as required (i.e., the command is errored out without these flags).
+//	7. "env" subfield tags (under the "cli" tags) are used to bind the flags to
+//	   environment variables (which are used when the flags are not passed).
+//	8. "enum" subfield tags (under the "cli" tags) are used to restrict string
+//	   flags to the given "|" separated values (which are also completed). It's
+//	   also possible to implement Values() []string on the field type instead.
+//	9. "exclusive" / "together" / "onerequired" subfield tags (under the "cli"
+//	   tags) are used to group flags (by name) as mutually exclusive / required
+//	   together / one (at least) required, while "requires" subfield tags mark
+//	   the flags as requiring other flags (--cert requiring --tls, say).
+//	10. Slice and map[string]string fields are declared as repeatable flags
+//	   ("delim" subfield tags can be used to split on something other than ",").
+//	11. "count" subfield tags (under the "cli" tags) are used to declare int
+//	   flags that count the number of times they're passed (-vvv for 3, say).
+//	12. "complete" subfield tags (under the "cli" tags) are used to complete
+//	   flags as files (complete=file, or complete=file:json|yaml to filter by
+//	   extensions) or directories (complete=dir).
+//	13. Struct fields are flattened into flags of their own (recursively),
+//	   prefixed with the field name (--tls-cert for TLS.Cert, say) unless
+//	   overridden via "prefix" subfield tags (under the "cli" tags). Embedded
+//	   struct fields aren't prefixed at all (unless given a prefix explicitly).
+//	14. "negatable" subfield tags (under the "cli" tags) are used to declare
+//	   bool flags that can also be turned off via --no-X (shown as --[no-]X).
+//	15. "stdin" subfield tags (under the "cli" tags) are used to declare string,
+//	   []byte or io.Reader fields populated from the file given via the flag,
+//	   or from stdin (for "-", or when the flag is omitted and stdin is piped).
 
 type greetOptions struct {
 	Greeting string `cli:"short" default:"Hello"`   // greeting to use
@@ -35,8 +69,13 @@ type greetOptions struct {
 //	3. (Optional) Next argument if a string slice is used to collect args.
 //	4. Doc is used* as long help string (as is).
 //	5. Usage directive is used* to explicitly set the usage string.
+//	6. "Examples:" section (at the end of the doc) is used* as the examples.
 
 // Greet someone.
+//
+// Examples:
+//
+//	greet --name=Gopher --times=2
 func greet(opts *greetOptions) {
 	for i := 0; i < opts.Times; i++ {
 		fmt.Printf("%v, %v!\n", opts.Greeting, opts.Name)
@@ -17,6 +17,9 @@ func TestMain(t *testing.T) {
 Usage:
   greet [opts]
 
+Examples:
+  greet --name=Gopher --times=2
+
 Flags:
   -g, --greeting string (default Hello)  greeting to use
   -n, --name     string (default World)  name to greet
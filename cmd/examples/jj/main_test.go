@@ -103,7 +103,7 @@ Did you mean this?
 
 Run 'jj git --help' for usage.
 `,
-				Code: 1,
+				Code: 2,
 			},
 		},
 		{
@@ -113,7 +113,7 @@ Run 'jj git --help' for usage.
 				Stderr: `Error: unknown command "x" for "jj git"
 Run 'jj git --help' for usage.
 `,
-				Code: 1,
+				Code: 2,
 			},
 		},
 	}
@@ -0,0 +1,146 @@
+package climate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithColor returns a modifier that forces Run to colorize (or not) the help and
+// error output. By default, output is colorized only if it's a terminal and the
+// NO_COLOR environment variable (see https://no-color.org) is not set.
+func WithColor(color bool) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Color = &color
+	}
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// isTerminal reports whether rw is a terminal (it's a var so that the tests can
+// pretend to be on one).
+var isTerminal = func(rw any) bool {
+	f, ok := rw.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// /dev/null is a character device too, but certainly not a terminal (and
+	// it's what stdin is under go test, cron etc., where WithInteractive must
+	// not prompt and stdin fields must not wait for input).
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+func useColor(color *bool, w io.Writer) bool {
+	if color != nil {
+		return *color
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+var (
+	headerRegexp  = regexp.MustCompile(`^[A-Z][A-Za-z ]*:$`)
+	commandRegexp = regexp.MustCompile(`^(  )(\S+)`)
+	flagRegexp    = regexp.MustCompile(`^(  )((?:-\w, )?--[\w-]+|-\w)`)
+)
+
+// colorize colorizes the section headers and the command / flag names in the
+// given help output (but leaves everything before "Usage:" alone, as that's the
+// free-form long description).
+func colorize(help string) string {
+	var (
+		lines   = strings.SplitAfter(help, "\n")
+		usage   = false
+		section string
+	)
+	for i, line := range lines {
+		text := strings.TrimSuffix(line, "\n")
+		if !usage {
+			usage = (text == "Usage:")
+		}
+		if !usage {
+			continue
+		}
+		switch {
+		case headerRegexp.MatchString(text):
+			section = text
+			text = ansiBold + text + ansiReset
+		case strings.HasSuffix(section, "Flags:"):
+			text = flagRegexp.ReplaceAllString(text, "$1"+ansiCyan+"$2"+ansiReset)
+		case strings.HasSuffix(section, "Commands:"):
+			text = commandRegexp.ReplaceAllString(text, "$1"+ansiCyan+"$2"+ansiReset)
+		}
+		lines[i] = text + line[len(strings.TrimSuffix(line, "\n")):]
+	}
+	return strings.Join(lines, "")
+}
+
+// inheritsOut reports whether c doesn't have an output writer of its own (as far
+// as we can tell, as Cobra doesn't expose it), i.e., whether out (what c
+// resolved it to) is the same as its parent's (or stdout, for the root).
+func inheritsOut(c *cobra.Command, out io.Writer) bool {
+	parent := io.Writer(os.Stdout)
+	if c.HasParent() {
+		parent = c.Parent().OutOrStdout()
+	}
+	// Note: comparing interfaces panics if their (same) type is not comparable.
+	return reflect.TypeOf(out).Comparable() && out == parent
+}
+
+func colorizeHelp(cmd *cobra.Command, color *bool) {
+	// Resolve all the (possibly inherited) help funcs first, so that we don't
+	// end up wrapping the already wrapped help funcs of the parents.
+	helps := map[*cobra.Command]func(*cobra.Command, []string){}
+	visitCommands(cmd, func(c *cobra.Command) {
+		helps[c] = c.HelpFunc()
+	})
+	visitCommands(cmd, func(c *cobra.Command) {
+		help := helps[c]
+		c.SetHelpFunc(func(c *cobra.Command, args []string) {
+			// Note: this is decided based on the actual output writer, so that
+			// redirecting stdout (to a file, say) just works.
+			out := c.OutOrStdout()
+			if !useColor(color, out) {
+				help(c, args)
+				return
+			}
+			var (
+				b       bytes.Buffer
+				inherit = inheritsOut(c, out)
+			)
+			c.SetOut(&b)
+			help(c, args)
+			// Note: commands may be run again (see Compile), so don't pin the
+			// writer they merely inherited (from the parent, say) this time.
+			if inherit {
+				c.SetOut(nil)
+			} else {
+				c.SetOut(out)
+			}
+			fmt.Fprint(out, colorize(b.String()))
+		})
+	})
+	if useColor(color, cmd.ErrOrStderr()) {
+		cmd.SetErrPrefix(ansiRed + "Error:" + ansiReset)
+	}
+}
@@ -1,15 +1,17 @@
 package climate
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
 	"runtime/debug"
 	"strconv"
 	"strings"
-	"text/tabwriter"
 	"time"
+	"unicode/utf8"
 
 	"github.com/avamsi/ergo"
 	"github.com/avamsi/ergo/assert"
@@ -21,26 +23,91 @@ import (
 )
 
 type command struct {
-	delegate cobra.Command
+	delegate    *cobra.Command
+	formatError func(error) string // see WithErrorFormatter
+	returnError bool               // see WithReturnError
 }
 
-func newCommand(name string, md *internal.Metadata, params []internal.ParamType) *command {
-	delegate := cobra.Command{
-		Use:     md.Usage(name, params),
-		Aliases: md.Aliases(),
-		Short:   md.Short(),
-		Long:    md.Long(),
+func newCommand(name string, md *internal.Metadata, params []internal.ParamType, bounds *internal.ArgsBounds) *command {
+	var (
+		_, hidden     = md.Directive("hidden")
+		deprecated, _ = md.Directive("deprecated")
+		group, _      = md.Directive("group")
+	)
+	delegate := &cobra.Command{
+		Use:        md.Usage(name, params, bounds),
+		Aliases:    md.Aliases(),
+		Short:      md.Short(),
+		Long:       md.Long(),
+		Example:    md.Example(),
+		Hidden:     hidden,
+		Deprecated: deprecated,
+		GroupID:    group,
+	}
+	if _, ok := md.Directive("default"); ok {
+		delegate.Annotations = map[string]string{isDefaultAnnotation: ""}
 	}
 	delegate.Flags().SortFlags = false
 	delegate.PersistentFlags().SortFlags = false
 	if md != nil {
 		delegate.DisableFlagsInUseLine = true
 	}
-	return &command{delegate}
+	return &command{delegate: delegate}
 }
 
 func (cmd *command) addCommand(sub *command) {
-	cmd.delegate.AddCommand(&sub.delegate)
+	for _, other := range cmd.delegate.Commands() {
+		for _, name := range append([]string{sub.delegate.Name()}, sub.delegate.Aliases...) {
+			if other.HasAlias(name) || other.Name() == name {
+				ergo.Panicf("same name or alias %v for both %v and %v: %v",
+					name, other.Name(), sub.delegate.Name(), cmd.delegate.Name())
+			}
+		}
+	}
+	// Register the groups on the parent as needed (Cobra panics otherwise).
+	if id := sub.delegate.GroupID; id != "" && !cmd.delegate.ContainsGroup(id) {
+		cmd.delegate.AddGroup(&cobra.Group{ID: id, Title: id + " Commands:"})
+	}
+	markDefault(cmd.delegate, sub.delegate)
+	cmd.delegate.AddCommand(sub.delegate)
+}
+
+func visitCommands(cmd *cobra.Command, fn func(*cobra.Command)) {
+	fn(cmd)
+	for _, sub := range cmd.Commands() {
+		visitCommands(sub, fn)
+	}
+}
+
+type runFunc = func(*cobra.Command, []string) error
+
+// wrapRunE replaces the RunE of the given command and its subcommands (the ones
+// that have it, that is) with what wrap returns for it.
+func wrapRunE(cmd *cobra.Command, wrap func(runFunc) runFunc) {
+	visitCommands(cmd, func(c *cobra.Command) {
+		if c.RunE != nil {
+			c.RunE = wrap(c.RunE)
+		}
+	})
+}
+
+// visitFlags calls fn exactly once for each of the flags (both local and
+// persistent) of the given command and its subcommands (recursively), along
+// with the command that declared the flag.
+func visitFlags(cmd *cobra.Command, fn func(*cobra.Command, *pflag.Flag)) {
+	seen := map[*pflag.Flag]bool{}
+	visitCommands(cmd, func(c *cobra.Command) {
+		visit := func(f *pflag.Flag) {
+			// Cobra merges the persistent flags of the parents into the flags
+			// of the children, so we may come across the same flag again.
+			if !seen[f] {
+				seen[f] = true
+				fn(c, f)
+			}
+		}
+		c.PersistentFlags().VisitAll(visit)
+		c.Flags().VisitAll(visit)
+	})
 }
 
 func version() string {
@@ -75,92 +142,475 @@ func version() string {
 	return module.PseudoVersion("", "", t, rev)
 }
 
-func flagUsages(fset *pflag.FlagSet) string {
+// sectionAnnotation holds the section (declared via the section tag) the flag
+// is grouped under in help and docs.
+const sectionAnnotation = "climate_annotation_section"
+
+// flagSections splits the flags into the ungrouped ones and the ones in each of
+// the sections (in the order they're first seen), as separate flag sets.
+func flagSections(fset *pflag.FlagSet) (*pflag.FlagSet, []string, map[string]*pflag.FlagSet) {
 	var (
-		b strings.Builder
-		t = tabwriter.NewWriter(&b, 0, 0, 0, ' ', 0)
+		ungrouped = pflag.NewFlagSet("", pflag.ContinueOnError)
+		sections  []string
+		grouped   = map[string]*pflag.FlagSet{}
 	)
+	ungrouped.SortFlags = false
 	fset.VisitAll(func(f *pflag.Flag) {
-		var short string
-		if f.Shorthand != "" {
-			short = fmt.Sprintf("-%v, ", f.Shorthand)
-		}
-		var (
-			qtype, usage = pflag.UnquoteUsage(f)
-			value        string
-		)
-		if qtype != "" {
-			qtype += " "
+		vs := f.Annotations[sectionAnnotation]
+		if len(vs) != 1 {
+			ungrouped.AddFlag(f)
+			return
 		}
-		if _, ok := f.Annotations[nonZeroDefault]; ok {
-			value = fmt.Sprintf("(default %v) ", f.DefValue)
+		s, ok := grouped[vs[0]]
+		if !ok {
+			s = pflag.NewFlagSet(vs[0], pflag.ContinueOnError)
+			s.SortFlags = false
+			sections = append(sections, vs[0])
+			grouped[vs[0]] = s
 		}
-		fmt.Fprintf(t, "  %v\t--%v\t %v\t%v \t%v\n", short, f.Name, qtype, value, usage)
+		s.AddFlag(f)
 	})
-	t.Flush()
+	return ungrouped, sections, grouped
+}
+
+// flagUsages renders the flag usages (ungrouped first, followed by each of the
+// sections under an indented heading of their own), aligned all together.
+func flagUsages(fset *pflag.FlagSet) string {
+	var (
+		ungrouped, sections, grouped = flagSections(fset)
+		sets                         = []*pflag.FlagSet{ungrouped}
+		headings                     = []string{""}
+	)
+	for _, s := range sections {
+		sets = append(sets, grouped[s])
+		headings = append(headings, s)
+	}
+	// Compute the column widths across all the sections first, so that they're
+	// all aligned together (while each section is still rendered on its own).
+	var (
+		rows   = make([][]flagRow, len(sets))
+		widths flagWidths
+	)
+	for i, s := range sets {
+		s.VisitAll(func(f *pflag.Flag) {
+			if f.Hidden {
+				return
+			}
+			r := newFlagRow(f)
+			for j := range widths {
+				widths[j] = max(widths[j], utf8.RuneCountInString(r[j]))
+			}
+			rows[i] = append(rows[i], r)
+		})
+	}
+	var b strings.Builder
+	for i, rs := range rows {
+		if len(rs) == 0 {
+			continue
+		}
+		if headings[i] != "" {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString("  " + headings[i] + ":\n")
+		}
+		for _, r := range rs {
+			r.write(&b, widths)
+		}
+	}
 	return b.String()
 }
 
+// unquoteUsage is pflag.UnquoteUsage, except that it names the type of the bool
+// flags that require an explicit value too (see the explicit tag), as they'd
+// otherwise look like they can be passed bare (pflag omits the type for bools).
+func unquoteUsage(f *pflag.Flag) (string, string) {
+	qtype, usage := pflag.UnquoteUsage(f)
+	if qtype == "" && f.Value.Type() == "bool" && f.NoOptDefVal == "" {
+		qtype = "bool"
+	}
+	return qtype, usage
+}
+
+// flagRow is the columns of a flag's usage: the shorthand, name, type, default
+// value (and other annotations) and the usage itself.
+type flagRow [5]string
+
+// flagWidths is the widths of all but the last (usage) column of flagRows, which
+// isn't padded.
+type flagWidths [len(flagRow{}) - 1]int
+
+func newFlagRow(f *pflag.Flag) flagRow {
+	var short string
+	if f.Shorthand != "" {
+		short = fmt.Sprintf("-%v, ", f.Shorthand)
+	}
+	var (
+		qtype, usage = unquoteUsage(f)
+		value        string
+	)
+	if qtype != "" {
+		qtype += " "
+	}
+	if v, ok := defaultText(f); ok {
+		value = fmt.Sprintf("(default %v) ", v)
+	}
+	if _, ok := f.Annotations[repeatable]; ok {
+		value += "(repeatable) "
+	}
+	if env, ok := envVar(f); ok {
+		value += fmt.Sprintf("(env $%v) ", env)
+	}
+	name := f.Name
+	if _, ok := f.Annotations[negatableAnnotation]; ok {
+		name = "[no-]" + name
+	}
+	return flagRow{"  " + short, "--" + name, " " + qtype, value + " ", usage}
+}
+
+// write writes the row with its columns padded to the given widths, with the
+// continuation lines of multi-line usages indented to line up with the first.
+func (r flagRow) write(b *strings.Builder, widths flagWidths) {
+	indent := 0
+	for j, w := range widths {
+		b.WriteString(r[j] + strings.Repeat(" ", w-utf8.RuneCountInString(r[j])))
+		indent += w
+	}
+	usage := strings.ReplaceAll(r[len(r)-1], "\n", "\n"+strings.Repeat(" ", indent))
+	b.WriteString(usage + "\n")
+}
+
 func versionCommand(name, v string) *cobra.Command {
 	help := fmt.Sprintf("Display %v's version information", name)
 	return &cobra.Command{
 		Use:   "version",
 		Short: help,
 		Long:  help + ".",
-		Args:  cobra.ExactArgs(0),
+		Args:  validateArgs(&internal.ArgsBounds{}),
 		Run: func(cmd *cobra.Command, _ []string) {
-			cmd.Println(v)
+			// Note: cmd.Println prints to stderr, unlike the --version flag.
+			fmt.Fprintln(cmd.OutOrStdout(), v)
 		},
 	}
 }
 
-func (cmd *command) run(ctx context.Context) error {
+const helpHidden = "help-hidden"
+
+func unhide(cmd *cobra.Command) {
+	unhideFlag := func(f *pflag.Flag) {
+		if f.Name != helpHidden {
+			f.Hidden = false
+		}
+	}
+	cmd.Flags().VisitAll(unhideFlag)
+	cmd.InheritedFlags().VisitAll(unhideFlag)
+	for _, sub := range cmd.Commands() {
+		if sub.Name() != noHelpCommand {
+			sub.Hidden = false
+		}
+	}
+}
+
+// wrapHelpArgs wraps the args validation of cmd and all of its subcommands to
+// check for --help-hidden (and the help flag, see WithHelpFlag) first, as Cobra
+// validates the args before running any of the pre-runs (and the help should be
+// shown regardless of the args).
+func wrapHelpArgs(cmd *cobra.Command, hf *internal.HelpFlag) {
+	visitCommands(cmd, func(c *cobra.Command) {
+		args := c.Args
+		if args == nil {
+			args = cobra.ArbitraryArgs // see Command.ValidateArgs
+		}
+		c.Args = func(c *cobra.Command, a []string) error {
+			// Note: Cobra checks for --help itself (before validating the args).
+			if hf != nil && hf.Name != cobraHelpFlag && assert.Ok(c.Flags().GetBool(hf.Name)) {
+				return pflag.ErrHelp
+			}
+			if assert.Ok(c.Flags().GetBool(helpHidden)) {
+				unhide(c)
+				// Cobra prints the help (and exits cleanly) on pflag.ErrHelp.
+				return pflag.ErrHelp
+			}
+			return args(c, a)
+		}
+	})
+}
+
+// prepare applies the finishing touches to the (fully built) root command, as
+// common to both running it and generating docs from it.
+func (cmd *command) prepare(opts *internal.RunOptions) {
 	normalize := func(_ *pflag.FlagSet, name string) pflag.NormalizedName {
 		return pflag.NormalizedName(internal.NormalizeToKebabCase(name))
 	}
 	// While we prefer kebab-case for flags, we do support other well-formed,
 	// cases through normalization (but only kebab-case shows up in --help).
 	cmd.delegate.SetGlobalNormalizationFunc(normalize)
-	if v := version(); v != "" {
+	if opts.Slog {
+		// Note: this (and declareConfigFlag etc.) needs to happen before
+		// bindEnvPrefix and the completions, so that these flags get the
+		// environment variables and completions too.
+		declareSlogFlags(cmd.delegate)
+	}
+	if opts.ConfigPath != "" {
+		declareConfigFlag(cmd.delegate, opts.ConfigPath)
+	}
+	if opts.DryRunFlag {
+		declareDryRunFlag(cmd.delegate)
+	}
+	if opts.EnvPrefix != "" {
+		// Note: this needs to happen after normalization, so that the derived
+		// environment variables are based on the kebab-case flag names.
+		bindEnvPrefix(cmd.delegate, opts.EnvPrefix)
+	}
+	// Note: this needs to happen before registerEnumCompletions, so that the
+	// custom completions take precedence over the enum ones.
+	registerCompletions(cmd.delegate, opts.Completions)
+	registerEnumSources(cmd.delegate, opts.Fields, opts.EnumSources)
+	registerEnumCompletions(cmd.delegate)
+	registerTimeCompletions(cmd.delegate)
+	registerStringerCompletions(cmd.delegate)
+	checkValidators(cmd.delegate, opts.Fields, opts.Validators)
+	markRequires(cmd.delegate, opts.Requires)
+	if opts.CompletionCommand {
+		addCompletionCommand(cmd.delegate)
+	}
+	cmd.delegate.SetFlagErrorFunc(suggestFlags)
+	configureSuggestions(cmd.delegate, opts.SuggestionsDistance, opts.DisableSuggestions)
+	// --help-hidden is --help, except that it also shows the hidden flags and
+	// subcommands (and is itself hidden).
+	cmd.delegate.PersistentFlags().Bool(helpHidden, false, "")
+	assert.Nil(cmd.delegate.PersistentFlags().MarkHidden(helpHidden))
+	cmd.delegate.PersistentPreRunE = func(c *cobra.Command, _ []string) error {
+		if err := applyEnv(c.Flags()); err != nil {
+			return err
+		}
+		// Note: this needs to happen after applyEnv, so that the environment
+		// variables take precedence over the config file.
+		if opts.ConfigPath != "" {
+			if err := applyConfig(c, opts.ConfigFormat); err != nil {
+				return err
+			}
+		}
+		// Note: this needs to happen after applyConfig, so that the config file
+		// takes precedence over the defaults providers.
+		if err := applyDefaults(c.Flags(), opts.Defaults); err != nil {
+			return err
+		}
+		// Note: this needs to happen after applyEnv, so that we only prompt for
+		// the required flags that aren't set via environment variables either.
+		if in := c.InOrStdin(); opts.Interactive && (in != os.Stdin || isTerminal(in)) {
+			err := promptRequired(c.Flags(), bufio.NewReader(in), c.ErrOrStderr())
+			if err != nil {
+				// Failing to read the answers is not the user's fault.
+				return runtimeError(c, err)
+			}
+		}
+		// Note: this needs to happen after prompting, so that the prompt doesn't
+		// compete with the fields for stdin.
+		if err := applyStdin(c); err != nil {
+			return err
+		}
+		// Note: this needs to happen after all of the above, so that the flags
+		// set in any way (and not just on the command line) are validated.
+		if err := applyEnumSources(c, opts.Fields, opts.EnumSources); err != nil {
+			return err
+		}
+		if err := applyValidators(c.Flags(), opts.Fields, opts.Validators); err != nil {
+			return err
+		}
+		if err := applyRequires(c.Flags()); err != nil {
+			return err
+		}
+		if opts.Slog {
+			applySlog(c)
+		}
+		// Note: this needs to happen after prompting, so that the timeout doesn't
+		// include the time spent doing so.
+		if opts.TimeoutFlag != "" {
+			applyTimeout(c, opts.TimeoutFlag)
+		}
+		// Note: this needs to happen after everything else, so that the hooks
+		// see the final flag values and context (with the logger, timeout etc.).
+		return applyPreRuns(c, opts.Fields, opts.PreRuns)
+	}
+	if opts.Recover {
+		declareStackTraceFlag(cmd.delegate)
+		// Note: this needs to happen before wrapPostRuns, so that the post-run
+		// hooks are called (with the panic as the error) on panics too.
+		wrapRecover(cmd.delegate)
+	}
+	if opts.Timing {
+		declareTimingFlag(cmd.delegate)
+		// Note: this needs to happen after wrapRecover (so that the recovered
+		// panics are timed as failures) but before wrapPostRuns (so that the
+		// post-run hooks are not timed).
+		wrapTiming(cmd.delegate)
+	}
+	if len(opts.PostRuns) > 0 {
+		wrapPostRuns(cmd.delegate, opts.PostRuns)
+	}
+	if opts.TimeoutFlag != "" {
+		declareTimeoutFlag(cmd.delegate, opts.TimeoutFlag)
+	}
+	v, text := opts.Version, opts.VersionText
+	if v == "" {
+		v = version()
+	}
+	if v != "" {
+		if text == "" {
+			text = v
+		}
 		// Add the version subcommand only when the root command already has
 		// subcommands (similar to how Cobra does it for help / completion).
 		if cmd.delegate.HasSubCommands() {
-			cmd.delegate.AddCommand(versionCommand(cmd.delegate.Name(), v))
+			cmd.delegate.AddCommand(versionCommand(cmd.delegate.Name(), text))
 		}
+		// Note: Cobra only adds the --version flag to the root command.
 		cmd.delegate.Version = v
+		if opts.VersionText != "" {
+			cmd.delegate.SetVersionTemplate("{{" + strconv.Quote(text) + "}}\n")
+		}
+	}
+	if opts.NoHelpCommand {
+		disableHelpCommand(cmd.delegate)
 	}
+	// Note: this needs to happen after all the subcommands are added (including
+	// the help subcommand, so after disableHelpCommand too).
+	if opts.HelpFlag != nil {
+		declareHelpFlags(cmd.delegate, opts.HelpFlag)
+	}
+	if opts.GroupExitCode != 0 {
+		setGroupExitCode(cmd.delegate, opts.GroupExitCode)
+	}
+	// Note: this needs to happen after all the subcommands are added too.
+	wrapHelpArgs(cmd.delegate, opts.HelpFlag)
 	// Align the flag usages as a table (pflag's FlagUsages already does this to
 	// some extent but doesn't align types and default values).
 	cobra.AddTemplateFunc("flagUsages", flagUsages)
-	t := cmd.delegate.UsageTemplate()
-	t = strings.ReplaceAll(t, ".FlagUsages", " | flagUsages")
-	cmd.delegate.SetUsageTemplate(t)
-	return cmd.delegate.ExecuteContext(ctx)
+	if t := opts.UsageTemplate; t != "" {
+		cmd.delegate.SetUsageTemplate(t)
+	} else if opts.CompactHelp {
+		cmd.delegate.SetUsageTemplate(compactUsageTemplate)
+	} else {
+		t = cmd.delegate.UsageTemplate()
+		t = strings.ReplaceAll(t, ".FlagUsages", " | flagUsages")
+		// Ungrouped commands go under "Other Commands" (when there are groups).
+		t = strings.ReplaceAll(t, "Additional Commands:", "Other Commands:")
+		// Document the positionals (if any, see positionalsHelp) before the
+		// examples (and flags).
+		t = strings.Replace(t, "{{if .HasExample}}",
+			`{{with index .Annotations "`+argsAnnotation+`"}}
+
+Arguments:
+{{.}}{{end}}{{if .HasExample}}`, 1)
+		cmd.delegate.SetUsageTemplate(t)
+	}
+	if len(opts.ExitCodes) > 0 {
+		setExitCodes(cmd.delegate, opts.ExitCodes)
+	}
+	if opts.PluginPrefix != "" {
+		if cmd.delegate.Annotations == nil {
+			cmd.delegate.Annotations = map[string]string{}
+		}
+		cmd.delegate.Annotations[pluginPrefixAnnotation] = opts.PluginPrefix
+	}
+	cobra.AddTemplateFunc("exitCodesHelp", exitCodesHelp)
+	cobra.AddTemplateFunc("pluginsHelp", pluginsHelp)
+	if t := opts.HelpTemplate; t != "" {
+		cmd.delegate.SetHelpTemplate(t)
+	} else if opts.CompactHelp {
+		cmd.delegate.SetHelpTemplate(`{{.UsageString}}{{with pluginsHelp .}}Plugins:
+{{.}}{{end}}{{with exitCodesHelp .}}Exit Codes:
+{{.}}{{end}}`)
+	} else {
+		// Document the plugins and exit codes (if any) after the usage, in
+		// --help only (and not on usage errors, unlike everything in the usage
+		// template).
+		cmd.delegate.SetHelpTemplate(cmd.delegate.HelpTemplate() + `{{with pluginsHelp .}}
+Plugins:
+{{.}}{{end}}{{with exitCodesHelp .}}
+Exit Codes:
+{{.}}{{end}}`)
+	}
+	colorizeHelp(cmd.delegate, opts.Color)
+	if opts.FormatError != nil {
+		cmd.formatError = opts.FormatError
+		// We print the (formatted) errors ourselves instead (see command.run).
+		cmd.delegate.SilenceErrors = true
+	}
+	if opts.ReturnError {
+		cmd.returnError = true
+		// Note: Cobra respects these on the root for all the subcommands.
+		cmd.delegate.SilenceErrors = true
+		cmd.delegate.SilenceUsage = true
+	}
+	// Note: this needs to happen last as Cobra merges the persistent flags of
+	// the parents into the flags of the children when marking flag groups.
+	markFlagGroups(cmd.delegate, opts.FlagGroups)
+}
+
+func (cmd *command) run(ctx context.Context, args []string) error {
+	if dargs, ok := withDefault(cmd.delegate, args); ok {
+		args = dargs
+	}
+	cmd.delegate.SetArgs(args)
+	c, err := cmd.delegate.ExecuteContextC(ctx)
+	if err != nil && cmd.formatError != nil && !cmd.returnError {
+		printError(c.ErrOrStderr(), err, cmd.formatError)
+	}
+	if timedOut(ctx, c, err) {
+		return runtimeError(c, ErrExit(timeoutExitCode, err))
+	}
+	// Runtime errors are wrapped in RuntimeErrors (see runtimeError), so
+	// anything else must be an error Cobra ran into parsing / validating the
+	// flags, args etc.
+	if rerr := new(RuntimeError); err != nil && !errors.As(err, &rerr) {
+		if uerr := new(UsageError); !errors.As(err, &uerr) {
+			err = ErrUsage(err)
+		}
+	}
+	return err
 }
 
 type funcCommandBuilder struct {
 	name string
 	reflection
-	md *internal.Metadata
+	md            *internal.Metadata
+	opts          *internal.CommandOptions
+	tagPreference []string
+	trace         *tracer
+	fields        map[*pflag.Flag]reflect.Value
+	args          map[*cobra.Command]*internal.ArgsBounds
 }
 
 type runSignature struct {
-	numIn  int
-	inCtx  bool
-	inOpts *reflect.Value
-	inArgs internal.ParamType
-	outErr bool
+	numIn         int
+	inCtx         bool
+	inOpts        *reflect.Value
+	inWriter      bool
+	inPositionals []positional
+	inArgs        internal.ParamType
+	outValue      bool
+	outErr        bool
 }
 
 func (fcb *funcCommandBuilder) run(sig *runSignature) func(*cobra.Command, []string) error {
-	return func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		if err := setPositionals(sig.inPositionals, args); err != nil {
+			return err
+		}
 		var in []reflect.Value
 		if sig.inCtx {
-			in = append(in, reflect.ValueOf(cmd.Context()))
+			ctx := withFlagSet(withArgsAfterDash(cmd.Context(), cmd, args), cmd.Flags(), fcb.fields)
+			ctx = withExit(ctx)
+			in = append(in, reflect.ValueOf(ctx))
 		}
 		if sig.inOpts != nil {
 			in = append(in, *sig.inOpts)
 		}
+		if sig.inWriter {
+			in = append(in, reflect.ValueOf(cmd.OutOrStdout()))
+		}
 		switch sig.inArgs {
 		case internal.RequiredParam:
 			in = append(in, reflect.ValueOf(args[0]))
@@ -177,101 +627,262 @@ func (fcb *funcCommandBuilder) run(sig *runSignature) func(*cobra.Command, []str
 		case internal.ArbitraryLengthParam:
 			in = append(in, reflect.ValueOf(args))
 		}
-		out := fcb.v().Call(in)
+		var out []reflect.Value
+		err = callWithExit(func() error {
+			if fcb.t().IsVariadic() { // i.e., args ...string
+				out = fcb.v().CallSlice(in)
+			} else {
+				out = fcb.v().Call(in)
+			}
+			return nil
+		})
+		if err != nil {
+			return runtimeError(cmd, err)
+		}
 		if sig.outErr {
-			if out[0].IsNil() { // if _no_ error
-				return nil
+			if errV := out[len(out)-1]; !errV.IsNil() { // if there's an error
+				err := errV.Interface().(error)
+				if uerr := new(UsageError); errors.As(err, &uerr) {
+					// Let Cobra print both the error and usage information.
+					return err
+				}
+				return runtimeError(cmd, err)
 			}
-			err := out[0].Interface().(error)
-			if uerr := new(usageError); errors.As(err, &uerr) {
-				// Let Cobra print both the error and usage information.
-				return err
+		}
+		if sig.outValue {
+			if err := printOutput(cmd, out[0]); err != nil {
+				return runtimeError(cmd, err)
 			}
-			// err is not a usage error (anymore), so set SilenceUsage to true
-			// to prevent Cobra from printing usage information.
-			cmd.SilenceUsage = true
-			// exitError may just be used to exit with a particular exit code
-			// and not necessarily have anything to print.
-			if eerr := new(exitError); errors.As(err, &eerr) {
-				cmd.SilenceErrors = len(eerr.errs) == 0
+		}
+		return nil
+	}
+}
+
+// runtimeError marks err as a runtime error (i.e., one that's not caused by the
+// user invoking cmd wrong), by wrapping it in a RuntimeError and setting
+// SilenceUsage to prevent Cobra from printing the usage information along with
+// it (which is just noise then).
+func runtimeError(cmd *cobra.Command, err error) error {
+	cmd.SilenceUsage = true
+	// exitError may just be used to exit with a particular exit code and not
+	// necessarily have anything to print (even when joined with other errors).
+	if msg, pruned := message(err); pruned {
+		cmd.SilenceErrors = cmd.SilenceErrors || msg == ""
+		return &RuntimeError{&prunedError{msg, err}}
+	}
+	return &RuntimeError{err}
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = strconv.Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func validateArgs(bounds *internal.ArgsBounds) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		var (
+			n    = len(args)
+			path = cmd.CommandPath()
+		)
+		switch {
+		case n < bounds.Min && bounds.Min <= len(bounds.Names):
+			missing := bounds.Names[n:bounds.Min]
+			if len(missing) == 1 {
+				return fmt.Errorf("%v: missing argument: %v", path, missing[0])
 			}
-			return err
+			return fmt.Errorf("%v: missing arguments: %v", path, strings.Join(missing, ", "))
+		case bounds.Max == 0 && n > 0:
+			return fmt.Errorf("%v takes no args, received %v", path, quoteArgs(args))
+		case bounds.Min == bounds.Max && n != bounds.Min:
+			return fmt.Errorf("%v accepts %v arg(s), received %v", path, bounds.Min, n)
+		case n < bounds.Min:
+			return fmt.Errorf("%v accepts at least %v arg(s), received %v", path, bounds.Min, n)
+		case bounds.Max >= 0 && n > bounds.Max:
+			return fmt.Errorf("%v accepts at most %v arg(s), received %v", path, bounds.Max, n)
 		}
 		return nil
 	}
 }
 
+// argBounds returns the bounds of the i-th param (a string or *string, i.e., a
+// single arg), named after the param (if known) for validateArgs to refer to.
+func (fcb *funcCommandBuilder) argBounds(i, min, max int) *internal.ArgsBounds {
+	bounds := &internal.ArgsBounds{Min: min, Max: max}
+	if name, ok := fcb.md.ParamName(i); ok {
+		bounds.Names = []string{name}
+	}
+	return bounds
+}
+
 func (fcb *funcCommandBuilder) build() *command {
+	if names := fcb.opts.ArgNames; names != nil {
+		// The names are carried along with the bounds (if any), as both the
+		// usage and validateArgs need them.
+		bounds := internal.ArgsBounds{Max: -1}
+		if fcb.opts.Args != nil {
+			bounds = *fcb.opts.Args
+		}
+		bounds.Names = names
+		fcb.opts.Args = &bounds
+	}
 	var (
-		cmd    = newCommand(fcb.name, fcb.md, internal.ParamTypes(fcb.t()))
+		cmd    = newCommand(fcb.name, fcb.md, internal.ParamTypes(fcb.t()), fcb.opts.Args)
 		i      = 0
 		n      = fcb.t().NumIn()
 		inCtx  bool
 		inOpts *reflect.Value
+		inW    bool
+		inPos  []positional
 		inArgs = internal.NoParam
+		// inBounds is the bounds of the args param (if any) and inName its name.
+		inBounds *internal.ArgsBounds
+		inName   = "args"
 	)
 	// We support the signatures (excuse the partial [optional] notation)
-	// func([ctx context.Context], [opts *T], [args []string]) [(err error)],
-	// which is to say all of ctx, opts, args and error are optional. If opts is
-	// present, T must be a struct (and we use its fields as flags).
-	// TODO: maybe support variadic, array and normal string arguments too.
+	// func([ctx context.Context], [opts *T], [w io.Writer], [args []string])
+	// [(err error)], which is to say all of ctx, opts, w, args and error are
+	// optional. If opts is present, T must be a struct (and we use its fields
+	// as flags), which may also be passed by value (opts T). w is the output
+	// writer (see WithOutput). args may also be variadic (args ...string),
+	// which is handled just like []string.
 	if i < n && typeIsContext(fcb.t().In(i)) {
 		i++
 		inCtx = true
 	}
 	if i < n {
-		if t := fcb.t().In(i); typeIsStructPointer(t) {
+		t := fcb.t().In(i)
+		// opts may be passed by value too (in which case the func gets a copy).
+		byValue := (t.Kind() == reflect.Struct)
+		if byValue {
+			t = reflect.PointerTo(t)
+		}
+		if typeIsStructPointer(t) {
 			var (
 				r    = reflection{ptr: &reflection{ot: t}}
 				opts = &options{
 					r,
 					nil, // no parent
 					cmd.delegate.Flags(),
+					nil, // already local
 					fcb.md.LookupType(t.Elem()),
+					fcb.tagPreference,
+					fcb.trace,
+					nil,
+					fcb.fields,
 				}
 			)
 			opts.declare()
 			i++
 			inOpts = r.ptr.v()
+			if byValue {
+				inOpts = r.v()
+			}
+			inPos = opts.positionals
 		}
 	}
+	if i < n && fcb.t().In(i) == writerType {
+		i++
+		inW = true
+	}
 	if i < n {
+		if name, ok := fcb.md.ParamName(i); ok {
+			inName = name
+		}
 		switch t := fcb.t().In(i); t.Kind() {
 		case reflect.String:
+			inArgs, inBounds = internal.RequiredParam, &internal.ArgsBounds{Min: 1, Max: 1}
+			cmd.delegate.Args = validateArgs(fcb.argBounds(i, 1, 1))
 			i++
-			inArgs = internal.RequiredParam
-			cmd.delegate.Args = cobra.ExactArgs(1)
 		case reflect.Pointer, reflect.Array, reflect.Slice:
 			if t.Elem().Kind() != reflect.String {
 				break
 			}
-			i++
 			switch t.Kind() {
 			case reflect.Pointer:
-				inArgs = internal.OptionalParam
-				cmd.delegate.Args = cobra.MaximumNArgs(1)
+				inArgs, inBounds = internal.OptionalParam, &internal.ArgsBounds{Min: 0, Max: 1}
+				cmd.delegate.Args = validateArgs(fcb.argBounds(i, 0, 1))
 			case reflect.Array:
-				inArgs = internal.FixedLengthParam
-				cmd.delegate.Args = cobra.ExactArgs(t.Len())
+				inArgs, inBounds = internal.FixedLengthParam, &internal.ArgsBounds{Min: t.Len(), Max: t.Len()}
+				cmd.delegate.Args = validateArgs(inBounds)
 			case reflect.Slice:
-				inArgs = internal.ArbitraryLengthParam
+				inArgs, inBounds = internal.ArbitraryLengthParam, &internal.ArgsBounds{Max: -1}
+				if fcb.opts.Args != nil {
+					inBounds = fcb.opts.Args
+					cmd.delegate.Args = validateArgs(fcb.opts.Args)
+				}
 			}
+			i++
 		}
 	} else {
-		cmd.delegate.Args = cobra.ExactArgs(0)
+		cmd.delegate.Args = validateArgs(&internal.ArgsBounds{})
+	}
+	if fcb.opts.ArgNames != nil && inArgs != internal.ArbitraryLengthParam {
+		ergo.Panicf("arg names without []string param: %v", fcb.t())
+	}
+	if fcb.opts.Args != nil && inArgs != internal.ArbitraryLengthParam {
+		ergo.Panicf("args bounds without []string param: %v", fcb.t())
+	}
+	if fcb.opts.ArgCompletion != nil {
+		if inArgs == internal.NoParam && len(inPos) == 0 {
+			ergo.Panicf("arg completion without args: %v", fcb.t())
+		}
+		cmd.delegate.ValidArgsFunction = cobraCompletion(fcb.opts.ArgCompletion)
+	}
+	if len(inPos) > 0 {
+		if inArgs != internal.NoParam {
+			ergo.Panicf("both positional fields and args param: %v", fcb.t())
+		}
+		validatePositionals(inPos)
+		cmd.delegate.Args = validateArgs(positionalsBounds(inPos))
+		if _, ok := fcb.md.Directive("usage"); !ok {
+			cmd.delegate.Use += positionalsUsage(inPos)
+		}
+		// Note: the explicit arg completion (if any) takes precedence.
+		if cmd.delegate.ValidArgsFunction == nil {
+			cmd.delegate.ValidArgsFunction = completePositionals(inPos)
+		}
+		if help := positionalsHelp(inPos); help != "" {
+			if cmd.delegate.Annotations == nil {
+				cmd.delegate.Annotations = map[string]string{}
+			}
+			cmd.delegate.Annotations[argsAnnotation] = help
+		}
+		fcb.args[cmd.delegate] = namedPositionalsBounds(inPos)
+	} else if inBounds != nil {
+		fcb.args[cmd.delegate] = namedBounds(inBounds, inName)
+	}
+	// The func may also return a value (to print as per --output, see
+	// printOutput), i.e., func(...) [(value T)] [(err error)] (with T not being
+	// an error itself).
+	var (
+		numOut   = fcb.t().NumOut()
+		outErr   = numOut > 0 && typeIsError(fcb.t().Out(numOut-1))
+		outValue = numOut > 0 && !typeIsError(fcb.t().Out(0))
+	)
+	// Note: if the func is variadic, the variadic param must've been consumed as
+	// args above (as a []string) or i != n (as it's always the last param).
+	if i != n || numOut > 2 || (numOut == 2 && !(outValue && outErr)) {
+		ergo.Panicf("not func([context.Context], [*struct], [io.Writer], [[]string]) ([T], [error]): %v", fcb.t())
 	}
-	outErr := fcb.t().NumOut() == 1 && typeIsError(fcb.t().Out(0))
-	if i != n || fcb.t().IsVariadic() || (fcb.t().NumOut() != 0 && !outErr) {
-		ergo.Panicf("not func([context.Context], [*struct], [[]string]) [error]: %v", fcb.t())
+	if outValue {
+		declareOutputFlag(cmd.delegate.Flags(), fcb.t())
 	}
-	cmd.delegate.RunE = fcb.run(&runSignature{n, inCtx, inOpts, inArgs, outErr})
+	cmd.delegate.RunE = fcb.run(&runSignature{n, inCtx, inOpts, inW, inPos, inArgs, outValue, outErr})
 	return cmd
 }
 
 type structCommandBuilder struct {
 	reflection
-	parent *reflection
-	md     *internal.Metadata
+	parent        *reflection
+	md            *internal.Metadata
+	methods       map[string]*internal.CommandOptions
+	tagPreference []string
+	trace         *tracer
+	fields        map[*pflag.Flag]reflect.Value
+	args          map[*cobra.Command]*internal.ArgsBounds
 }
 
 func validateNoArgs(cmd *cobra.Command, args []string) error {
@@ -282,44 +893,73 @@ func validateNoArgs(cmd *cobra.Command, args []string) error {
 	}
 	var b strings.Builder
 	fmt.Fprintf(&b, "%v", err)
-	if suggestions := cmd.SuggestionsFor(args[0]); len(suggestions) > 0 {
+	if suggestions := suggestionsFor(cmd, args[0]); len(suggestions) > 0 {
 		b.WriteString("\n\nDid you mean this?\n")
 		for _, s := range suggestions {
 			fmt.Fprintf(&b, "\t%v\n", s)
 		}
 	}
 	fmt.Fprintf(&b, "\nRun '%v --help' for usage.", cmd.CommandPath())
-	return errors.New(b.String())
+	return ErrUsage(errors.New(b.String()))
 }
 
 func (scb *structCommandBuilder) build() *command {
 	var (
-		cmd  = newCommand(scb.t().Name(), scb.md, nil)
+		cmd  = newCommand(scb.t().Name(), scb.md, nil, nil)
 		opts = &options{
 			scb.reflection,
 			scb.parent,
 			cmd.delegate.PersistentFlags(),
+			cmd.delegate.Flags(),
 			scb.md,
+			scb.tagPreference,
+			scb.trace,
+			nil,
+			scb.fields,
 		}
 	)
 	opts.declare()
+	if len(opts.positionals) > 0 {
+		ergo.Panicf("positional fields on struct command: %v", scb.t())
+	}
 	for i := 0; i < scb.ptr.v().NumMethod(); i++ {
 		var (
-			m   = scb.ptr.t().Method(i)
-			v   = scb.ptr.v().Method(i)
+			m     = scb.ptr.t().Method(i)
+			v     = scb.ptr.v().Method(i)
+			mopts internal.CommandOptions
+		)
+		if o, ok := scb.methods[m.Name]; ok {
+			// Copy, as building the command may modify them (see ArgNames).
+			mopts = *o
+		}
+		var (
 			fcb = &funcCommandBuilder{
 				m.Name,
 				reflection{ov: &v},
 				scb.md.Child(m.Name),
+				&mopts,
+				scb.tagPreference,
+				scb.trace,
+				scb.fields,
+				scb.args,
 			}
 		)
-		// TODO: maybe provide an option to default to a subcommand.
+		if scb.trace != nil {
+			scb.trace.traceCommand(fmt.Sprintf("method (%v).%v", scb.ptr.t(), m.Name), m.Name, fcb.md)
+		}
 		cmd.addCommand(fcb.build())
 	}
 	// This should ideally be as simple as setting cobra.NoArgs, but for
 	// whatever reason, Cobra doesn't really honor that for subcommands
 	// (see spf13/cobra#706, spf13/cobra#981) -- so, we do it ourselves.
 	cmd.delegate.RunE = validateNoArgs
+	if cmd.delegate.Annotations == nil {
+		cmd.delegate.Annotations = map[string]string{}
+	}
+	cmd.delegate.Annotations[groupAnnotation] = ""
+	// Cobra validates (legacy) args for the root command by itself otherwise,
+	// which wouldn't suggest commands by their aliases.
+	cmd.delegate.Args = cobra.ArbitraryArgs
 	// We only make this command "runnable" to validate NoArgs, so hack the
 	// usage template and pretend it's not really runnable.
 	// Note: Cobra subcommands will inherit any custom attributes set on the
@@ -327,7 +967,7 @@ func (scb *structCommandBuilder) build() *command {
 	// to the parent command and not any subcommands.
 	defaultHelpFunc := cmd.delegate.HelpFunc()
 	cmd.delegate.SetHelpFunc(func(c *cobra.Command, _ []string) {
-		if c == &cmd.delegate {
+		if c == cmd.delegate {
 			t := cmd.delegate.UsageTemplate()
 			t = strings.ReplaceAll(t, "{{if .Runnable}}", "{{if false}}")
 			c.SetUsageTemplate(t)
@@ -0,0 +1,142 @@
+package climate
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+type compiledPlan struct {
+	cmd     *command
+	opts    *internal.RunOptions
+	mu      sync.Mutex
+	restore func()
+}
+
+// Compile builds the given plan (i.e., reflects on it, decodes the metadata etc.)
+// once, to be run many times with different args without rebuilding it every
+// time (like in a REPL, for example). The modifiers are the same as the ones
+// accepted by Run.
+//
+//	cp, err := climate.Compile(climate.Struct[repl](), climate.WithMetadata(md))
+//	...
+//	for line := range lines {
+//		cp.Run(ctx, strings.Fields(line))
+//	}
+//
+// All the flags (and so, the opts struct fields they're bound to) are reset to
+// their default values before each run. Other state held by the opts structs
+// (like unexported fields the funcs / methods set themselves) is not reset.
+func Compile(p internal.Plan, mods ...func(*internal.RunOptions)) (*compiledPlan, error) {
+	opts := runOptions(mods)
+	cmd, err := build(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledPlan{cmd: cmd, opts: opts, restore: snapshot(cmd.delegate, opts.Fields)}, nil
+}
+
+func (cp *compiledPlan) run(ctx context.Context, args []string) (int, error) {
+	// Runs are serialized, as they share (and mutate) the same commands.
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.restore()
+	return execute(ctx, cp.cmd, cp.opts, args)
+}
+
+// Run executes the compiled plan with the given args (see the package level
+// Run) and returns the exit code.
+func (cp *compiledPlan) Run(ctx context.Context, args []string) int {
+	code, _ := cp.run(ctx, args)
+	return code
+}
+
+// Execute is similar to Run, except that it returns everything written to
+// stdout and stderr along with the exit code and error, like the package level
+// Execute (and with the same caveats).
+func (cp *compiledPlan) Execute(ctx context.Context, args []string) (stdout, stderr string, code int, err error) {
+	return capture(func() (int, error) {
+		return cp.run(ctx, args)
+	})
+}
+
+// snapshot snapshots the state of the given (built) command tree that running
+// it mutates, returning a func that restores it.
+func snapshot(root *cobra.Command, fields map[*pflag.Flag]reflect.Value) func() {
+	type commandState struct {
+		hidden, silenceUsage, silenceErrors bool // see unhide and runtimeError
+	}
+	var (
+		commands = map[*cobra.Command]commandState{}
+		flags    = map[*pflag.Flag]func(){}
+	)
+	visitCommands(root, func(c *cobra.Command) {
+		commands[c] = commandState{c.Hidden, c.SilenceUsage, c.SilenceErrors}
+	})
+	visitFlags(root, func(_ *cobra.Command, f *pflag.Flag) {
+		var (
+			hidden = f.Hidden // see unhide
+			value  = snapshotFlag(f, fields[f])
+		)
+		flags[f] = func() {
+			value()
+			f.Hidden = hidden
+		}
+	})
+	return func() {
+		visitCommands(root, func(c *cobra.Command) {
+			// Cobra only passes the context down to the subcommands that don't
+			// already have one (i.e., from a previous run).
+			c.SetContext(nil) //nolint:staticcheck // nil unsets the context
+			if s, ok := commands[c]; ok {
+				c.Hidden, c.SilenceUsage, c.SilenceErrors = s.hidden, s.silenceUsage, s.silenceErrors
+			}
+		})
+		visitFlags(root, func(_ *cobra.Command, f *pflag.Flag) {
+			if restore, ok := flags[f]; ok {
+				restore()
+			} else if f.Changed {
+				// Flags Cobra adds on the first run (like --help) aren't in
+				// the snapshot, but are simple enough to reset by their defaults.
+				assert.Nil(f.Value.Set(f.DefValue))
+			}
+			f.Changed = false
+		})
+	}
+}
+
+// snapshotFlag snapshots the value of the given flag, returning a func that
+// restores it. Both the field the flag is bound to (see flagValue) and the
+// pflag.Value itself (if it's a pointer) are restored, as pflag's slice / map
+// values track whether they were set before to decide between replacing and
+// appending to the value.
+func snapshotFlag(f *pflag.Flag, field reflect.Value) func() {
+	if !field.IsValid() {
+		// Not bound to a field (like --timeout), see flagValue.
+		return func() {
+			if f.Changed {
+				assert.Nil(f.Value.Set(f.DefValue))
+			}
+		}
+	}
+	savedField := reflect.New(field.Type()).Elem()
+	savedField.Set(field)
+	value := reflect.ValueOf(f.Value)
+	if value.Kind() != reflect.Pointer {
+		return func() {
+			field.Set(savedField)
+		}
+	}
+	savedValue := reflect.New(value.Type().Elem()).Elem()
+	savedValue.Set(value.Elem())
+	return func() {
+		value.Elem().Set(savedValue)
+		field.Set(savedField)
+	}
+}
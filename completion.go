@@ -0,0 +1,164 @@
+package climate
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/avamsi/ergo"
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithCompletion returns a modifier that makes Run complete the given flag (of
+// any command that has it) with the values returned by the given func (which
+// is called with the partial value being completed, i.e., "js" for both
+// --flag js<tab> and --flag=js<tab>, as Cobra strips the "--flag=" and the
+// shells add it back). Returning an error means there are no completions (and
+// no file completions either), see SetCompletionDirective otherwise.
+func WithCompletion(flag string, complete func(ctx context.Context, toComplete string) ([]string, error)) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		if opts.Completions == nil {
+			opts.Completions = map[string]func(context.Context, string) ([]string, error){}
+		}
+		opts.Completions[internal.NormalizeToKebabCase(flag)] = complete
+	}
+}
+
+func registerCompletions(cmd *cobra.Command, completions map[string]func(context.Context, string) ([]string, error)) {
+	registered := map[string]bool{}
+	visitFlags(cmd, func(c *cobra.Command, f *pflag.Flag) {
+		fn, ok := completions[f.Name]
+		if !ok {
+			return
+		}
+		complete := func(ctx context.Context, _ []string, toComplete string) ([]string, error) {
+			return fn(ctx, toComplete)
+		}
+		assert.Nil(c.RegisterFlagCompletionFunc(f.Name, cobraCompletion(complete)))
+		registered[f.Name] = true
+	})
+	for name := range completions {
+		if !registered[name] {
+			ergo.Panicf("no flag for completion: %v", name)
+		}
+	}
+}
+
+// WithArgCompletion returns a modifier that makes the command complete its
+// positional args with the values returned by the given func (which is called
+// with the args already given and the partial arg being completed, so it can
+// complete each arg differently). Like with WithCompletion, returning an error
+// means there are no completions.
+func WithArgCompletion(complete func(ctx context.Context, args []string, toComplete string) ([]string, error)) func(*internal.CommandOptions) {
+	return func(opts *internal.CommandOptions) {
+		opts.ArgCompletion = complete
+	}
+}
+
+type completionDirectiveKey struct{}
+
+// SetCompletionDirective sets the directive Cobra passes on to the shells along
+// with the completions, from within a completion func (see WithCompletion and
+// WithArgCompletion, it must be called with the context the func is called with
+// or one derived from it). This controls how the shells treat the completions,
+// like not adding a space after a "key=" prefix (for compound values):
+//
+//	climate.WithCompletion("label", func(ctx context.Context, toComplete string) ([]string, error) {
+//		key, _, ok := strings.Cut(toComplete, "=")
+//		if !ok {
+//			climate.SetCompletionDirective(ctx, cobra.ShellCompDirectiveNoSpace|cobra.ShellCompDirectiveNoFileComp)
+//			return []string{"env=", "team="}, nil
+//		}
+//		return labelValues(key), nil
+//	})
+//
+// The directive defaults to cobra.ShellCompDirectiveNoFileComp (i.e., no file
+// completions), which this replaces (so it should be included as needed).
+// Returning an error still means cobra.ShellCompDirectiveError, regardless.
+func SetCompletionDirective(ctx context.Context, directive cobra.ShellCompDirective) {
+	ptr, ok := ctx.Value(completionDirectiveKey{}).(*cobra.ShellCompDirective)
+	assert.Truef(ok, "climate.SetCompletionDirective with a context not passed to a completion func by Run")
+	*ptr = directive
+}
+
+func cobraCompletion(fn func(context.Context, []string, string) ([]string, error)) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		ctx := c.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		directive := cobra.ShellCompDirectiveNoFileComp
+		ctx = context.WithValue(ctx, completionDirectiveKey{}, &directive)
+		var completions []string
+		err := callWithExit(func() (err error) {
+			completions, err = fn(withExit(ctx), args, toComplete)
+			return err
+		})
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return completions, directive
+	}
+}
+
+// WithCompletionCommand returns a modifier that makes Run add a "completion"
+// command (that prints the completion script for the given shell) even for
+// single commands (i.e., Func plans) -- Cobra already adds one to trees.
+//
+// Note: for single commands, this means a first arg of "completion" runs the
+// completion command (instead of being passed along as an arg).
+func WithCompletionCommand() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.CompletionCommand = true
+	}
+}
+
+func completionCommand(root *cobra.Command) *cobra.Command {
+	name := root.Name()
+	cmd := &cobra.Command{
+		Use:   "completion",
+		Short: "Generate the autocompletion script for the specified shell",
+		Long: fmt.Sprintf(`Generate the autocompletion script for %v for the specified shell.
+See each sub-command's help for details on how to use the generated script.`, name),
+		Args: cobra.NoArgs,
+		// Note: the completion scripts call back into the CLI (__complete), so
+		// they do respect hidden commands and flags.
+	}
+	gens := []struct {
+		shell string
+		gen   func(io.Writer) error
+	}{
+		{"bash", func(w io.Writer) error { return root.GenBashCompletionV2(w, true) }},
+		{"zsh", root.GenZshCompletion},
+		{"fish", func(w io.Writer) error { return root.GenFishCompletion(w, true) }},
+		{"powershell", root.GenPowerShellCompletionWithDesc},
+	}
+	for _, g := range gens {
+		cmd.AddCommand(&cobra.Command{
+			Use:               g.shell,
+			Short:             fmt.Sprintf("Generate the autocompletion script for %v", g.shell),
+			Args:              cobra.NoArgs,
+			ValidArgsFunction: cobra.NoFileCompletions,
+			RunE: func(c *cobra.Command, _ []string) error {
+				return g.gen(c.OutOrStdout())
+			},
+		})
+	}
+	return cmd
+}
+
+func addCompletionCommand(root *cobra.Command) {
+	if root.HasSubCommands() {
+		return // Cobra adds its own default completion command to trees.
+	}
+	// Cobra (legacy) validates args of root commands with subcommands by itself
+	// otherwise, which would just error out for any args.
+	if root.Args == nil {
+		root.Args = cobra.ArbitraryArgs
+	}
+	root.AddCommand(completionCommand(root))
+}
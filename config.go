@@ -0,0 +1,143 @@
+package climate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithConfigFile returns a modifier that makes Run declare a (persistent)
+// --config flag on the root command (defaulting to the given path) and set the
+// flags that aren't set otherwise from the config file at that path, keyed by
+// the flag names. The given format must be one of "json" or "yaml" (or empty,
+// in which case it's inferred from the extension of the path).
+//
+//	# app.yaml
+//	dry-run: true
+//	ports: [80, 443]
+//	labels: {env: prod}
+//
+// The precedence is flag > environment variable (see WithEnvPrefix) > config
+// file > defaults provider (see WithDefaults) > default. The config file at the
+// default path is optional (i.e., it's not an error for it not to exist), unlike
+// one explicitly given via --config. Keys for flags of other commands are
+// ignored, but unknown keys are errors.
+func WithConfigFile(path, format string) func(*internal.RunOptions) {
+	assert.Truef(slices.Contains([]string{"", "json", "yaml"}, format),
+		"not one of json, yaml: %v", format)
+	return func(opts *internal.RunOptions) {
+		opts.ConfigPath, opts.ConfigFormat = path, format
+	}
+}
+
+const configFlag = "config"
+
+func declareConfigFlag(cmd *cobra.Command, path string) {
+	cmd.PersistentFlags().String(configFlag, path, "path to the config file")
+	assert.Nil(cmd.MarkPersistentFlagFilename(configFlag, "json", "yaml", "yml"))
+}
+
+func decodeConfig(b []byte, path, format string) (map[string]any, error) {
+	if format == "" {
+		switch filepath.Ext(path) {
+		case ".json":
+			format = "json"
+		case ".yaml", ".yml":
+			format = "yaml"
+		default:
+			return nil, fmt.Errorf("unknown config format (not .json / .yaml): %v", path)
+		}
+	}
+	var config map[string]any
+	if format == "json" {
+		d := json.NewDecoder(bytes.NewReader(b))
+		// Decode numbers as is (rather than as float64s, which may not format
+		// back to the same string -- 1e+06 for 1000000, for example).
+		d.UseNumber()
+		return config, d.Decode(&config)
+	}
+	return config, yaml.Unmarshal(b, &config)
+}
+
+// configValues returns the value(s) to set the flag to, for the given config
+// value (i.e., each of the elements of a list and each of the key=value pairs
+// of a map, in order).
+func configValues(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		var values []string
+		for _, e := range v {
+			values = append(values, fmt.Sprint(e))
+		}
+		return values
+	case map[string]any:
+		var values []string
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			values = append(values, fmt.Sprintf("%v=%v", k, v[k]))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+func applyConfig(c *cobra.Command, format string) error {
+	var (
+		fset = c.Flags()
+		f    = fset.Lookup(configFlag)
+		path = f.Value.String()
+	)
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !f.Changed {
+			return nil
+		}
+		return runtimeError(c, err)
+	}
+	config, err := decodeConfig(b, path, format)
+	if err != nil {
+		return runtimeError(c, fmt.Errorf("%v: %w", path, err))
+	}
+	known := map[string]bool{}
+	visitFlags(c.Root(), func(_ *cobra.Command, f *pflag.Flag) {
+		known[f.Name] = true
+	})
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		name := internal.NormalizeToKebabCase(key)
+		f := fset.Lookup(name)
+		if f == nil {
+			if !known[name] {
+				errs = append(errs, fmt.Errorf("%v: unknown flag: --%v", path, name))
+			}
+			continue
+		}
+		if f.Changed || f.Name == configFlag {
+			continue
+		}
+		for _, v := range configValues(config[key]) {
+			if err := fset.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("%v: %w", path, err))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
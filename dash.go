@@ -0,0 +1,29 @@
+package climate
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+)
+
+type argsAfterDashKey struct{}
+
+// ArgsAfterDash returns the args that were passed after "--" (verbatim, even if
+// they look like flags) to the command being run with the given context, or nil
+// if there was no "--" at all (in which case, all args were just regular args).
+//
+// Note: the args after "--" are still included in the args param (as well as in
+// the positional args fields) -- this just tells them apart, so that wrappers
+// (myapp run -- ls -la, say) can hand them through as is.
+func ArgsAfterDash(ctx context.Context) []string {
+	args, _ := ctx.Value(argsAfterDashKey{}).([]string)
+	return args
+}
+
+func withArgsAfterDash(ctx context.Context, cmd *cobra.Command, args []string) context.Context {
+	i := cmd.ArgsLenAtDash()
+	if i < 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, argsAfterDashKey{}, append([]string{}, args[i:]...))
+}
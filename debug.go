@@ -0,0 +1,84 @@
+package climate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithDebug returns a modifier that makes Run trace the reflection decisions it
+// makes while building the commands (which fields became which flags, which
+// methods became which subcommands and which metadata was found) to stderr,
+// to debug flags not showing up as expected or stale metadata, say. Setting
+// the CLIMATE_DEBUG environment variable (to anything but "" or "0") does the
+// same without changing any code.
+func WithDebug() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Debug = true
+	}
+}
+
+const debugEnv = "CLIMATE_DEBUG"
+
+func debugEnabled(opts *internal.RunOptions) bool {
+	if opts.Debug {
+		return true
+	}
+	v := os.Getenv(debugEnv)
+	return v != "" && v != "0"
+}
+
+// tracer traces the reflection decisions (see WithDebug), a nil tracer traces
+// nothing at all. Callers check for nil before building the messages though
+// (and their args), so that there's no overhead when debugging is disabled.
+type tracer struct {
+	w io.Writer
+}
+
+func newTracer(opts *internal.RunOptions) *tracer {
+	if !opts.Debug {
+		return nil
+	}
+	if opts.Error != nil {
+		return &tracer{opts.Error}
+	}
+	return &tracer{os.Stderr}
+}
+
+func (tr *tracer) printf(format string, args ...any) {
+	if tr == nil {
+		return
+	}
+	fmt.Fprintf(tr.w, "climate: "+format+"\n", args...)
+}
+
+// traceCommand traces the symbol (func, method or struct) a command is built
+// from, with the name (per the metadata) of the command.
+func (tr *tracer) traceCommand(symbol, name string, md *internal.Metadata) {
+	if tr == nil {
+		return
+	}
+	name, _, _ = strings.Cut(md.Usage(name, nil, nil), " ")
+	tr.printf("%v -> command %v", symbol, name)
+}
+
+// traceMetadata traces all the metadata looked up (and whether it was found).
+func (tr *tracer) traceMetadata(md *internal.Metadata) {
+	if tr == nil {
+		return
+	}
+	if md == nil {
+		tr.printf("no metadata (see WithMetadata)")
+		return
+	}
+	md.VisitLookups(func(symbol string, found bool) {
+		if found {
+			tr.printf("metadata for %v: found", symbol)
+		} else {
+			tr.printf("metadata for %v: missing", symbol)
+		}
+	})
+}
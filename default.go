@@ -0,0 +1,75 @@
+package climate
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/avamsi/ergo"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultAnnotation is set on the parent, naming its default subcommand.
+	defaultAnnotation = "climate_annotation_default"
+	// isDefaultAnnotation is set on the subcommand declared as the default.
+	isDefaultAnnotation = "climate_annotation_is_default"
+)
+
+// markDefault records sub as the default subcommand of cmd, if sub is declared
+// as the default via the default directive.
+func markDefault(cmd, sub *cobra.Command) {
+	if _, ok := sub.Annotations[isDefaultAnnotation]; !ok {
+		return
+	}
+	if other, ok := cmd.Annotations[defaultAnnotation]; ok {
+		ergo.Panicf("more than one default (%v and %v): %v", other, sub.Name(), cmd.Name())
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[defaultAnnotation] = sub.Name()
+}
+
+// withDefault returns the given args with the default subcommand inserted, if
+// the args resolve to a command with a default subcommand (and don't otherwise
+// ask for help, completions or look like a typo of another subcommand).
+func withDefault(root *cobra.Command, args []string) ([]string, bool) {
+	if !root.HasSubCommands() {
+		return nil, false
+	}
+	if len(args) > 0 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd) {
+		return nil, false
+	}
+	// Cobra only adds these lazily (on execute), so add them now to make sure
+	// that Find can find them.
+	root.InitDefaultHelpCmd()
+	root.InitDefaultCompletionCmd()
+	c, rest, err := root.Find(args)
+	if err != nil {
+		return nil, false
+	}
+	name := c.Annotations[defaultAnnotation]
+	if name == "" {
+		return nil, false
+	}
+	for _, arg := range rest {
+		if arg == "--" {
+			break
+		}
+		if slices.Contains([]string{"-h", "--help", "--" + helpHidden, "--version"}, arg) {
+			return nil, false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			// Let Cobra suggest the matching commands if this looks like a typo.
+			if len(suggestionsFor(c, arg)) > 0 {
+				return nil, false
+			}
+			break
+		}
+	}
+	var path []string
+	for p := c; p.HasParent(); p = p.Parent() {
+		path = append([]string{p.Name()}, path...)
+	}
+	return slices.Concat(path, []string{name}, rest), true
+}
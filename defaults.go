@@ -0,0 +1,54 @@
+package climate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// DefaultsProvider provides the defaults for flags, by their (kebab-case)
+// names, from sources like a remote config service or a secrets manager.
+type DefaultsProvider interface {
+	// Default returns the value to set the flag to (and true), or false if
+	// there's no default for the flag.
+	Default(flag string) (string, bool)
+}
+
+// WithDefaults returns a modifier that makes Run set the flags (of the command
+// being run) that aren't set otherwise from the given provider.
+//
+// The precedence is flag > environment variable (see WithEnvPrefix) > config
+// file (see WithConfigFile) > defaults provider > default (tag). Multiple
+// providers are consulted in order, and the first one with a default wins.
+// The providers are only consulted for the flags of the command being run and
+// only when it's being run (and not for --help, for example).
+func WithDefaults(p DefaultsProvider) func(*internal.RunOptions) {
+	assert.Truef(p != nil, "nil defaults provider")
+	return func(opts *internal.RunOptions) {
+		opts.Defaults = append(opts.Defaults, p.Default)
+	}
+}
+
+func applyDefaults(fset *pflag.FlagSet, providers []func(string) (string, bool)) error {
+	var errs []error
+	fset.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		for _, p := range providers {
+			v, ok := p(f.Name)
+			if !ok {
+				continue
+			}
+			if err := fset.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("defaults: %w", err))
+			}
+			return
+		}
+	})
+	return errors.Join(errs...)
+}
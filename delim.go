@@ -0,0 +1,138 @@
+package climate
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// delimSliceValue is similar to pflag's own slice values, except that it splits
+// on the given delimiter (instead of parsing the value as CSV).
+type delimSliceValue[E any] struct {
+	p       *[]E
+	delim   string
+	changed bool
+}
+
+var _ pflag.Value = (*delimSliceValue[string])(nil)
+
+func splitDelim[E any](s, delim string) ([]E, error) {
+	var es []E
+	for _, s := range strings.Split(s, delim) {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		var e E
+		if err := setScalar(reflect.ValueOf(&e).Elem(), s); err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+func (dsv *delimSliceValue[E]) String() string {
+	ss := make([]string, len(*dsv.p))
+	for i, e := range *dsv.p {
+		ss[i] = fmt.Sprint(e)
+	}
+	return "[" + strings.Join(ss, dsv.delim) + "]"
+}
+
+func (dsv *delimSliceValue[E]) Set(s string) error {
+	es, err := splitDelim[E](s, dsv.delim)
+	if err != nil {
+		return err
+	}
+	// Just like pflag, the first Set replaces the default and the rest append.
+	if !dsv.changed {
+		*dsv.p = es
+		dsv.changed = true
+	} else {
+		*dsv.p = append(*dsv.p, es...)
+	}
+	return nil
+}
+
+func (dsv *delimSliceValue[E]) Type() string {
+	if t := reflect.TypeFor[E](); t.Kind() != reflect.String {
+		return t.String() + "Slice"
+	}
+	return "strings"
+}
+
+func delimSliceVarP[E any](fset *pflag.FlagSet, delim string) flagTypeVarP[[]E] {
+	return func(p *[]E, name, shorthand string, value []E, usage string) {
+		*p = value
+		fset.VarP(&delimSliceValue[E]{p: p, delim: delim}, name, shorthand, usage)
+	}
+}
+
+// delimMapValue is similar to pflag's own stringToString value, except that it
+// splits on the given delimiter (instead of parsing the value as CSV).
+type delimMapValue struct {
+	p       *map[string]string
+	delim   string
+	changed bool
+}
+
+var _ pflag.Value = (*delimMapValue)(nil)
+
+func splitDelimMap(s, delim string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, kv := range strings.Split(s, delim) {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be formatted as key=value", kv)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func (dmv *delimMapValue) String() string {
+	var kvs []string
+	for k, v := range *dmv.p {
+		kvs = append(kvs, k+"="+v)
+	}
+	slices.Sort(kvs)
+	return "[" + strings.Join(kvs, dmv.delim) + "]"
+}
+
+func (dmv *delimMapValue) Set(s string) error {
+	m, err := splitDelimMap(s, dmv.delim)
+	if err != nil {
+		return err
+	}
+	// Just like pflag, the first Set replaces the default and the rest merge.
+	if !dmv.changed {
+		*dmv.p = m
+		dmv.changed = true
+		return nil
+	}
+	if *dmv.p == nil {
+		*dmv.p = m
+		return nil
+	}
+	for k, v := range m {
+		(*dmv.p)[k] = v
+	}
+	return nil
+}
+
+func (dmv *delimMapValue) Type() string {
+	return "stringToString"
+}
+
+func delimMapVarP(fset *pflag.FlagSet, delim string) flagTypeVarP[map[string]string] {
+	return func(p *map[string]string, name, shorthand string, value map[string]string, usage string) {
+		*p = value
+		fset.VarP(&delimMapValue{p: p, delim: delim}, name, shorthand, usage)
+	}
+}
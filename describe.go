@@ -0,0 +1,141 @@
+package climate
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// describeVersion is the version of the DescribeJSON schema, to be bumped on
+// any backwards incompatible changes (new fields may be added without bumping).
+const describeVersion = 1
+
+type description struct {
+	Version int                 `json:"version"`
+	Command *commandDescription `json:"command"`
+}
+
+type commandDescription struct {
+	Name       string                `json:"name"`
+	Path       string                `json:"path"`
+	Usage      string                `json:"usage"`
+	Aliases    []string              `json:"aliases,omitempty"`
+	Short      string                `json:"short,omitempty"`
+	Long       string                `json:"long,omitempty"`
+	Example    string                `json:"example,omitempty"`
+	Hidden     bool                  `json:"hidden,omitempty"`
+	Deprecated string                `json:"deprecated,omitempty"`
+	Args       *argsDescription      `json:"args,omitempty"`
+	Flags      []*flagDescription    `json:"flags,omitempty"`
+	Commands   []*commandDescription `json:"commands,omitempty"`
+}
+
+type argsDescription struct {
+	// Names are the names of the args by position, with the last one naming
+	// the rest of the args (if any) as well.
+	Names []string `json:"names"`
+	Min   int      `json:"min"`
+	Max   int      `json:"max"` // -1 if there's no upper bound
+}
+
+type flagDescription struct {
+	Name       string   `json:"name"`
+	Shorthand  string   `json:"shorthand,omitempty"`
+	Type       string   `json:"type"`
+	Default    string   `json:"default,omitempty"`
+	Usage      string   `json:"usage,omitempty"`
+	Values     []string `json:"values,omitempty"`
+	Required   bool     `json:"required,omitempty"`
+	Persistent bool     `json:"persistent,omitempty"`
+	Hidden     bool     `json:"hidden,omitempty"`
+	Deprecated string   `json:"deprecated,omitempty"`
+	// flag is the flag being described, for the other generators built on top
+	// of the descriptions (see GenCarapaceSpec).
+	flag *pflag.Flag
+}
+
+func describeFlag(f *pflag.Flag, persistent bool) *flagDescription {
+	_, required := f.Annotations[cobra.BashCompOneRequiredFlag]
+	return &flagDescription{
+		Name:       f.Name,
+		Shorthand:  f.Shorthand,
+		Type:       f.Value.Type(),
+		Default:    f.DefValue,
+		Usage:      f.Usage,
+		Values:     f.Annotations[enumAnnotation],
+		Required:   required,
+		Persistent: persistent,
+		Hidden:     f.Hidden,
+		Deprecated: f.Deprecated,
+		flag:       f,
+	}
+}
+
+// namedBounds returns a copy of the given bounds of the args param with the
+// given name, with the names extended to name all of the args (see
+// argsDescription), i.e., with the param name added for the rest of the args.
+func namedBounds(bounds *internal.ArgsBounds, name string) *internal.ArgsBounds {
+	named := *bounds
+	named.Names = slices.Clone(bounds.Names)
+	if len(named.Names) == 0 || named.Max < 0 || named.Max > len(named.Names) {
+		named.Names = append(named.Names, name)
+	}
+	return &named
+}
+
+func namedPositionalsBounds(ps []positional) *internal.ArgsBounds {
+	bounds := positionalsBounds(ps)
+	for _, p := range ps {
+		bounds.Names = append(bounds.Names, internal.NormalizeToKebabCase(p.name))
+	}
+	return bounds
+}
+
+func describeCommand(cmd *cobra.Command, args map[*cobra.Command]*internal.ArgsBounds) *commandDescription {
+	d := &commandDescription{
+		Name:       cmd.Name(),
+		Path:       cmd.CommandPath(),
+		Usage:      cmd.UseLine(),
+		Aliases:    cmd.Aliases,
+		Short:      cmd.Short,
+		Long:       cmd.Long,
+		Example:    cmd.Example,
+		Hidden:     cmd.Hidden,
+		Deprecated: cmd.Deprecated,
+	}
+	if bounds, ok := args[cmd]; ok {
+		d.Args = &argsDescription{bounds.Names, bounds.Min, bounds.Max}
+	}
+	// Note: only the flags declared on the command itself are described (and
+	// not the inherited ones, which are described on the ancestors instead).
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == helpHidden {
+			return
+		}
+		persistent := cmd.PersistentFlags().Lookup(f.Name) != nil
+		d.Flags = append(d.Flags, describeFlag(f, persistent))
+	})
+	for _, sub := range cmd.Commands() {
+		d.Commands = append(d.Commands, describeCommand(sub, args))
+	}
+	return d
+}
+
+// DescribeJSON returns a (machine-readable) JSON description of the given plan,
+// i.e., its commands (recursively) with their usage, docs, args (names and
+// bounds) and flags (name, shorthand, type, default etc.), for tooling like
+// shell plugins or GUIs. The JSON is versioned (see the "version" field), with
+// new fields only added in a backwards compatible manner otherwise. The
+// modifiers are the same as the ones accepted by Run.
+func DescribeJSON(p internal.Plan, mods ...func(*internal.RunOptions)) ([]byte, error) {
+	opts := runOptions(mods)
+	cmd, err := build(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(&description{describeVersion, describeCommand(cmd.delegate, opts.Args)}, "", "  ")
+}
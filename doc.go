@@ -0,0 +1,162 @@
+package climate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithManSection returns a modifier that sets the section GenManTree generates
+// the man pages for (instead of the default section 1).
+func WithManSection(section string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.ManSection = section
+	}
+}
+
+// GenManTree generates a man page for the given plan and each of its
+// subcommands (recursively) in the given directory (myapp.1, myapp-sub.1 etc.).
+// The modifiers are the same as the ones accepted by Run (with WithMetadata in
+// particular, used for the descriptions and usage lines).
+func GenManTree(p internal.Plan, dir string, mods ...func(*internal.RunOptions)) error {
+	opts := runOptions(mods)
+	cmd, err := build(p, opts)
+	if err != nil {
+		return err
+	}
+	section := opts.ManSection
+	if section == "" {
+		section = "1"
+	}
+	manExitCodes(cmd.delegate)
+	return doc.GenManTree(cmd.delegate, &doc.GenManHeader{Section: section}, dir)
+}
+
+func markdownFilename(cmd *cobra.Command) string {
+	return strings.ReplaceAll(cmd.CommandPath(), " ", "_") + ".md"
+}
+
+func markdownFlags(b *bytes.Buffer, title string, fset *pflag.FlagSet) {
+	if !fset.HasAvailableFlags() {
+		return
+	}
+	fmt.Fprintf(b, "### %v\n\n", title)
+	ungrouped, sections, grouped := flagSections(fset)
+	if ungrouped.HasAvailableFlags() {
+		markdownFlagsTable(b, ungrouped)
+	}
+	for _, s := range sections {
+		if grouped[s].HasAvailableFlags() {
+			fmt.Fprintf(b, "#### %v\n\n", s)
+			markdownFlagsTable(b, grouped[s])
+		}
+	}
+}
+
+// markdownEscape escapes the given text for (a cell of) a Markdown table.
+var markdownEscape = strings.NewReplacer("|", `\|`, "\n", " ").Replace
+
+func markdownFlagsTable(b *bytes.Buffer, fset *pflag.FlagSet) {
+	b.WriteString("| Flag | Short | Type | Default | Description |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	fset.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		var (
+			short, value string
+			qtype, usage = unquoteUsage(f)
+		)
+		if f.Shorthand != "" {
+			short = fmt.Sprintf("`-%v`", f.Shorthand)
+		}
+		if v, ok := defaultText(f); ok {
+			value = fmt.Sprintf("`%v`", v)
+		}
+		fmt.Fprintf(b, "| `--%v` | %v | %v | %v | %v |\n",
+			f.Name, short, qtype, markdownEscape(value), markdownEscape(usage))
+	})
+	b.WriteString("\n")
+}
+
+func genMarkdown(cmd *cobra.Command) []byte {
+	cmd.InitDefaultHelpFlag()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "## %v\n\n", cmd.CommandPath())
+	if cmd.Short != "" {
+		fmt.Fprintf(&b, "%v\n\n", cmd.Short)
+	}
+	b.WriteString("### Synopsis\n\n")
+	if cmd.Long != "" {
+		fmt.Fprintf(&b, "%v\n\n", cmd.Long)
+	}
+	// Struct commands are only "runnable" to validate args (see validateNoArgs).
+	if cmd.HasAvailableSubCommands() {
+		fmt.Fprintf(&b, "```\n%v [command]\n```\n\n", cmd.CommandPath())
+	} else if cmd.Runnable() {
+		fmt.Fprintf(&b, "```\n%v\n```\n\n", cmd.UseLine())
+	}
+	if cmd.Example != "" {
+		fmt.Fprintf(&b, "### Examples\n\n```\n%v\n```\n\n", cmd.Example)
+	}
+	markdownFlags(&b, "Flags", cmd.NonInheritedFlags())
+	markdownFlags(&b, "Global Flags", cmd.InheritedFlags())
+	markdownExitCodes(&b, cmd)
+	var links []string
+	link := func(c *cobra.Command) {
+		l := fmt.Sprintf("* [%v](%v)", c.CommandPath(), markdownFilename(c))
+		if c.Short != "" {
+			l += " - " + c.Short
+		}
+		links = append(links, l)
+	}
+	if parent := cmd.Parent(); parent != nil {
+		link(parent)
+	}
+	for _, sub := range cmd.Commands() {
+		if sub.IsAvailableCommand() && !sub.IsAdditionalHelpTopicCommand() {
+			link(sub)
+		}
+	}
+	if len(links) > 0 {
+		fmt.Fprintf(&b, "### See Also\n\n%v\n", strings.Join(links, "\n"))
+	}
+	return b.Bytes()
+}
+
+// genDocTree generates the doc (via gen) for the given command and each of its
+// (available) subcommands recursively, in the given directory (as filename).
+func genDocTree(cmd *cobra.Command, dir string, filename func(*cobra.Command) string, gen func(*cobra.Command) []byte) error {
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+		if err := genDocTree(sub, dir, filename, gen); err != nil {
+			return err
+		}
+	}
+	// #nosec G306 -- G306 expects 0o600 or less but 0o644 is fine here as the
+	// docs are not really sensitive (and are expected to be published).
+	return os.WriteFile(filepath.Join(dir, filename(cmd)), gen(cmd), 0o644)
+}
+
+// GenMarkdownTree generates a Markdown doc for the given plan and each of its
+// subcommands (recursively) in the given directory (myapp.md, myapp_sub.md
+// etc.), with relative links between parent and child commands. The output is
+// deterministic, so regenerating the docs only changes what actually changed.
+// The modifiers are the same as the ones accepted by Run.
+func GenMarkdownTree(p internal.Plan, dir string, mods ...func(*internal.RunOptions)) error {
+	cmd, err := build(p, runOptions(mods))
+	if err != nil {
+		return err
+	}
+	return genDocTree(cmd.delegate, dir, markdownFilename, genMarkdown)
+}
@@ -0,0 +1,37 @@
+package climate
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithDryRunFlag returns a modifier that makes Run declare a (persistent)
+// --dry-run flag, for the commands that mutate state to branch on uniformly via
+// DryRun (climate itself doesn't enforce anything -- it just standardizes the
+// flag, so that the commands don't each have to declare and thread it).
+func WithDryRunFlag() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.DryRunFlag = true
+	}
+}
+
+const dryRunFlag = "dry-run"
+
+func declareDryRunFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool(dryRunFlag, false, "show what would be done, without doing it")
+}
+
+// DryRun returns whether --dry-run (see WithDryRunFlag) is set for the command
+// being run with the given context (false if there's no such flag).
+//
+//	if climate.DryRun(ctx) {
+//		fmt.Println("would delete", path)
+//		return nil
+//	}
+func DryRun(ctx context.Context) bool {
+	v, _ := Flag[bool](ctx, dryRunFlag)
+	return v
+}
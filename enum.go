@@ -0,0 +1,116 @@
+package climate
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// enum may be implemented by string types to declare their allowed values.
+type enum interface {
+	Values() []string
+}
+
+var enumType = reflect.TypeOf((*enum)(nil)).Elem()
+
+func enumValues(t reflect.Type) []string {
+	if reflect.PointerTo(t).Implements(enumType) {
+		return reflect.New(t).Interface().(enum).Values()
+	}
+	return nil
+}
+
+type enumValue struct {
+	p      *string
+	values []string
+}
+
+var _ pflag.Value = (*enumValue)(nil)
+
+func (ev *enumValue) String() string {
+	return *ev.p
+}
+
+func (ev *enumValue) Set(s string) error {
+	if !slices.Contains(ev.values, s) {
+		return fmt.Errorf("must be one of %v", strings.Join(ev.values, ", "))
+	}
+	*ev.p = s
+	return nil
+}
+
+func (ev *enumValue) Type() string {
+	return "string"
+}
+
+const enumAnnotation = "climate_annotation_enum"
+
+func enumVarP(fset *pflag.FlagSet, values []string) flagTypeVarP[string] {
+	return func(p *string, name, shorthand, value, usage string) {
+		if value != "" {
+			assert.Truef(slices.Contains(values, value),
+				"default %v not one of %v: %v", value, values, name)
+		}
+		*p = value
+		fset.VarP(&enumValue{p, values}, name, shorthand, usage)
+		assert.Nil(fset.SetAnnotation(name, enumAnnotation, values))
+	}
+}
+
+// enumDescriptionsAnnotation holds the descriptions of the enum values (in the
+// same order as enumAnnotation), to show alongside them in completions.
+const enumDescriptionsAnnotation = "climate_annotation_enum_descriptions"
+
+// alignDescriptions returns the descriptions of the given values, in order.
+func alignDescriptions(values []string, descs map[string]string) []string {
+	aligned := make([]string, len(values))
+	for i, v := range values {
+		aligned[i] = descs[v]
+	}
+	return aligned
+}
+
+func setEnumDescriptions(fset *pflag.FlagSet, name string, values []string, descs map[string]string) {
+	aligned := alignDescriptions(values, descs)
+	assert.Nil(fset.SetAnnotation(name, enumDescriptionsAnnotation, aligned))
+}
+
+// completeEnum returns the values (with their descriptions, if any) that start
+// with toComplete, for both enum flags and positionals.
+func completeEnum(values, descs []string, toComplete string) []string {
+	var completions []string
+	for i, v := range values {
+		if !strings.HasPrefix(v, toComplete) {
+			continue
+		}
+		// Cobra shows the descriptions (after a tab) in the shells that support
+		// them (and drops them in the others).
+		if i < len(descs) && descs[i] != "" {
+			v += "\t" + descs[i]
+		}
+		completions = append(completions, v)
+	}
+	return completions
+}
+
+func registerEnumCompletions(cmd *cobra.Command) {
+	visitFlags(cmd, func(c *cobra.Command, f *pflag.Flag) {
+		values, ok := f.Annotations[enumAnnotation]
+		if !ok {
+			return
+		}
+		if _, ok := c.GetFlagCompletionFunc(f.Name); ok {
+			return // already registered (via WithCompletion)
+		}
+		descs := f.Annotations[enumDescriptionsAnnotation]
+		complete := func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completeEnum(values, descs, toComplete), cobra.ShellCompDirectiveNoFileComp
+		}
+		assert.Nil(c.RegisterFlagCompletionFunc(f.Name, complete))
+	})
+}
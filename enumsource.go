@@ -0,0 +1,126 @@
+package climate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/avamsi/ergo"
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithEnumSource returns a modifier that makes Run complete and validate the
+// given (string or []string) flag (of any command that has it) against the
+// values returned by the given func at runtime, for the "enums" that are only
+// known then (the available regions, say), while the field itself stays typed.
+// The values are fetched on tab (to complete) and after the flags are parsed
+// (to validate, only if the flag is set, like WithValidator). Failing validation
+// is a usage error, while failing to fetch the values is a runtime error (and
+// means there are no completions). Unlike WithCompletion, the func isn't given
+// the partial value being completed, and returns an error (rather than just the
+// values) so that Run can tell "no values" apart from "couldn't fetch them".
+// It can't be combined with WithCompletion for the same flag.
+func WithEnumSource(flag string, values func(ctx context.Context) ([]string, error)) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		if opts.EnumSources == nil {
+			opts.EnumSources = map[string]func(context.Context) ([]string, error){}
+		}
+		opts.EnumSources[internal.NormalizeToKebabCase(flag)] = values
+	}
+}
+
+var (
+	stringType      = reflect.TypeFor[string]()
+	stringSliceType = reflect.TypeFor[[]string]()
+)
+
+// flagStrings returns the value(s) of the string (or []string) flag.
+func flagStrings(fields map[*pflag.Flag]reflect.Value, f *pflag.Flag) ([]string, bool) {
+	if v, ok := convert(flagValue(fields, f), stringType); ok {
+		return []string{v.String()}, true
+	}
+	if v, ok := convert(flagValue(fields, f), stringSliceType); ok {
+		return v.Interface().([]string), true
+	}
+	return nil, false
+}
+
+func registerEnumSources(cmd *cobra.Command, fields map[*pflag.Flag]reflect.Value, sources map[string]func(context.Context) ([]string, error)) {
+	registered := map[string]bool{}
+	visitFlags(cmd, func(c *cobra.Command, f *pflag.Flag) {
+		source, ok := sources[f.Name]
+		if !ok {
+			return
+		}
+		if _, ok := f.Annotations[enumAnnotation]; ok {
+			ergo.Panicf("both enum values and source: --%v", f.Name)
+		}
+		if _, ok := c.GetFlagCompletionFunc(f.Name); ok {
+			ergo.Panicf("both WithEnumSource and WithCompletion for: --%v", f.Name)
+		}
+		if _, ok := flagStrings(fields, f); !ok {
+			ergo.Panicf("enum source for non string | []string: --%v", f.Name)
+		}
+		complete := func(ctx context.Context, _ []string, toComplete string) ([]string, error) {
+			values, err := source(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return completeEnum(values, nil, toComplete), nil
+		}
+		assert.Nil(c.RegisterFlagCompletionFunc(f.Name, cobraCompletion(complete)))
+		registered[f.Name] = true
+	})
+	for name := range sources {
+		if !registered[name] {
+			ergo.Panicf("no flag for enum source: %v", name)
+		}
+	}
+}
+
+func applyEnumSources(c *cobra.Command, fields map[*pflag.Flag]reflect.Value, sources map[string]func(context.Context) ([]string, error)) error {
+	var errs, serrs []error
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		source, ok := sources[f.Name]
+		if !ok || !f.Changed {
+			return
+		}
+		var values []string
+		err := callWithExit(func() (err error) {
+			values, err = source(withExit(c.Context()))
+			return err
+		})
+		if err != nil {
+			// Keep the exitErrors (see Exit) as is, even wrapped, to not prefix
+			// the bare ones (which have nothing to print).
+			if eerr := new(exitError); !errors.As(err, &eerr) {
+				err = fmt.Errorf("--%v: %w", f.Name, err)
+			}
+			serrs = append(serrs, err)
+			return
+		}
+		got, _ := flagStrings(fields, f)
+		for _, v := range got {
+			if !slices.Contains(values, v) {
+				errs = append(errs, fmt.Errorf("invalid value %q for --%v: must be one of %v",
+					v, f.Name, strings.Join(values, ", ")))
+				break
+			}
+		}
+	})
+	if len(serrs) > 0 {
+		// Failing to fetch the values is not the user's fault.
+		return runtimeError(c, errors.Join(serrs...))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return ErrUsage(errors.Join(errs...))
+}
@@ -0,0 +1,52 @@
+package climate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const envAnnotation = "climate_annotation_env"
+
+func envVar(f *pflag.Flag) (string, bool) {
+	if vs := f.Annotations[envAnnotation]; len(vs) == 1 {
+		return vs[0], true
+	}
+	return "", false
+}
+
+func bindEnvPrefix(cmd *cobra.Command, prefix string) {
+	visitFlags(cmd, func(_ *cobra.Command, f *pflag.Flag) {
+		if _, ok := envVar(f); ok {
+			return
+		}
+		env := prefix + "_" + strings.ReplaceAll(f.Name, "-", "_")
+		if f.Annotations == nil {
+			f.Annotations = map[string][]string{}
+		}
+		f.Annotations[envAnnotation] = []string{strings.ToUpper(env)}
+	})
+}
+
+// applyEnv sets the flags that weren't explicitly set (on the command line)
+// from their bound environment variables (if any), so that the precedence is
+// flag > environment variable > default.
+func applyEnv(fset *pflag.FlagSet) error {
+	var errs []error
+	fset.VisitAll(func(f *pflag.Flag) {
+		env, ok := envVar(f)
+		if !ok || f.Changed {
+			return
+		}
+		if v, ok := os.LookupEnv(env); ok {
+			if err := fset.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("$%v: %w", env, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
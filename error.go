@@ -1,25 +1,51 @@
 package climate
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 
-type usageError struct {
+	"github.com/avamsi/climate/internal"
+)
+
+// UsageError is an error in how the CLI was invoked (as opposed to a
+// RuntimeError), see ErrUsage.
+type UsageError struct {
 	error
 }
 
-// ErrUsage returns the given error wrapped in a usageError or nil otherwise.
-// usageError is used to indicate there's something wrong with the user input
-// and that the usage information should be printed along with the error.
-func ErrUsage(err error) *usageError {
+// ErrUsage returns the given error wrapped in a UsageError or nil otherwise.
+// UsageError is used to indicate there's something wrong with the user input
+// and that the usage information should be printed along with the error (Run
+// also returns a dedicated exit code of 2 for these, as it does for any of the
+// errors Cobra runs into parsing the flags and args, which RunE returns as
+// UsageErrors too).
+func ErrUsage(err error) *UsageError {
 	if err != nil {
-		return &usageError{err}
+		return &UsageError{err}
 	}
 	return nil
 }
 
-func (uerr *usageError) Unwrap() error {
+func (uerr *UsageError) Unwrap() error {
 	return uerr.error
 }
 
+// RuntimeError is an error the func / method being run (or the hooks etc.) ran
+// into, as opposed to a UsageError (which RunE returns for everything else).
+type RuntimeError struct {
+	err error
+}
+
+func (rerr *RuntimeError) Error() string {
+	return rerr.err.Error()
+}
+
+func (rerr *RuntimeError) Unwrap() error {
+	return rerr.err
+}
+
 type exitError struct {
 	code int
 	errs []error
@@ -27,17 +53,129 @@ type exitError struct {
 
 // ErrExit returns an exitError with the given exit code and errors.
 // exitError is used to indicate that the CLI should exit with the given exit
-// code (as returned by Run and respected by RunAndExit).
+// code (as returned by Run and respected by RunAndExit). The errors (if any)
+// are printed just like any other error, so
+//
+//	return climate.ErrExit(3, errors.New("permission denied"))
+//
+// prints "Error: permission denied" and exits with 3, while ErrExit(3) exits
+// with 3 without printing anything. exitErrors may also be joined with other
+// errors (via errors.Join), in which case the (first) exit code is used and only
+// the other errors are printed, so batch-style commands can report all failures:
+//
+//	return errors.Join(climate.ErrExit(3), err1, err2)
+//
+// Wrapped bare exitErrors print just the wrapping message, i.e.,
+// fmt.Errorf("batch: %w", ErrExit(4)) prints "Error: batch".
 func ErrExit(code int, errs ...error) *exitError {
 	return &exitError{code, errs}
 }
 
 func (eerr *exitError) Error() string {
-	// We panic here if errs is empty, but this is somewhat intentional as we
-	// should only use the error for exit code purposes in that case.
+	if len(eerr.errs) == 0 {
+		// The error is only used for exit code purposes in this case.
+		return ""
+	}
 	return errors.Join(eerr.errs...).Error()
 }
 
 func (eerr *exitError) Unwrap() []error {
 	return eerr.errs
 }
+
+// prunedError is err but with the message pruned of the bare exitErrors (i.e.,
+// those without any errors to print) in it (see message).
+type prunedError struct {
+	msg string
+	err error
+}
+
+func (perr *prunedError) Error() string {
+	return perr.msg
+}
+
+func (perr *prunedError) Unwrap() error {
+	return perr.err
+}
+
+// message returns the message of err without the (empty) messages of the bare
+// exitErrors joined into it (via errors.Join) and whether there were any such.
+func message(err error) (string, bool) {
+	switch err := err.(type) {
+	case *exitError:
+		if len(err.errs) == 0 {
+			return "", true
+		}
+	case interface{ Unwrap() []error }:
+		var (
+			msgs   []string
+			pruned bool
+		)
+		for _, e := range err.Unwrap() {
+			msg, p := message(e)
+			if msg != "" {
+				msgs = append(msgs, msg)
+			}
+			pruned = pruned || p
+		}
+		if pruned {
+			return strings.Join(msgs, "\n"), true
+		}
+	case interface {
+		error
+		Unwrap() error
+	}:
+		// Wrapped bare exitErrors still have the wrapping message to print, just
+		// without the dangling separator (but we can't do much about the wrapped
+		// joins, as we can't rebuild the wrapping message).
+		if msg, p := message(err.Unwrap()); p && msg == "" {
+			return strings.TrimSuffix(err.Error(), ": "), true
+		}
+	}
+	return err.Error(), false
+}
+
+// WithErrorFormatter returns a modifier that formats the errors Run prints to
+// stderr (usage and runtime errors alike) with the given func, instead of the
+// default "Error: <err>" (to match the conventions of the surrounding toolset,
+// like "myapp: <err>", or to colorize them, say). Errors with nothing to print
+// (like ErrExit(3), see ErrExit) are still not printed.
+//
+// Note: the formatted errors are printed after the usage information (for the
+// usage errors), so that they're not scrolled out of sight by it.
+func WithErrorFormatter(format func(error) string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.FormatError = format
+	}
+}
+
+// WithErrorPrefix returns a modifier that makes Run print the errors with the
+// given prefix (as in "<prefix> <err>") instead of the default "Error:". It's
+// shorthand for WithErrorFormatter (and so replaces any formatter given before).
+func WithErrorPrefix(prefix string) func(*internal.RunOptions) {
+	return WithErrorFormatter(func(err error) string {
+		return prefix + " " + err.Error()
+	})
+}
+
+// WithReturnError returns a modifier that makes Run (and RunE) not print the
+// errors (or the usage information along with the usage errors) at all, for
+// embedding the CLI (in a TUI or a server, say), where the caller presents the
+// error returned by RunE itself:
+//
+//	code, err := climate.RunE(ctx, p, args, climate.WithReturnError())
+//	if uerr := new(climate.UsageError); errors.As(err, &uerr) {
+//		...
+//	}
+func WithReturnError() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.ReturnError = true
+	}
+}
+
+func printError(w io.Writer, err error, format func(error) string) {
+	if err.Error() == "" { // see runtimeError
+		return
+	}
+	fmt.Fprintln(w, format(err))
+}
@@ -0,0 +1,63 @@
+package climate
+
+import (
+	"context"
+
+	"github.com/avamsi/ergo/assert"
+)
+
+type exitKey struct{}
+
+// exitPanic is what Exit panics with, to unwind the stack up to the func /
+// method being run (see callWithExit).
+type exitPanic struct {
+	code int
+}
+
+// Exit makes the func / method being run (with the given context, or one
+// derived from it) return immediately, with Run then returning the given exit
+// code (without printing anything, like ErrExit(code)). This saves threading an
+// error all the way up from deep in the call stack:
+//
+//	if !confirmed {
+//		climate.Exit(ctx, 3)
+//	}
+//
+// Exit works the same way from the pre-run and post-run hooks (see WithPreRun
+// and WithPostRun) and the enum sources (see WithEnumSource), while from the
+// completion funcs (see WithCompletion), it just means no completions.
+//
+// Unlike os.Exit, Exit unwinds the stack by panicking (and Run recovering where
+// it calls the funcs above), so the deferred calls still run as usual. This also
+// means that it must be called from the same goroutine as the func / method
+// (and not from goroutines it starts, which would crash the program instead)
+// and that recover calls in between may intercept it (and should re-panic
+// values they don't recognize). Returning ErrExit(code) is the alternative that
+// works everywhere.
+func Exit(ctx context.Context, code int) {
+	_, ok := ctx.Value(exitKey{}).(bool)
+	assert.Truef(ok, "climate.Exit with a context not passed by Run")
+	panic(exitPanic{code})
+}
+
+func withExit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, exitKey{}, true)
+}
+
+// callWithExit calls fn (which is expected to call Exit with a context derived
+// from withExit, if at all), recovering from the panics of Exit (and only Exit)
+// into the corresponding exitError.
+func callWithExit(fn func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		ep, ok := r.(exitPanic)
+		if !ok {
+			panic(r)
+		}
+		err = ErrExit(ep.code)
+	}()
+	return fn()
+}
@@ -0,0 +1,125 @@
+package climate
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithExitCodes returns a modifier that documents what the given exit codes
+// mean, in an "Exit Codes:" section of --help (of all the commands, as exit
+// codes are usually program-wide) and in the docs generated by GenManTree,
+// GenMarkdownTree and GenRSTTree. This is purely documentation -- Run doesn't
+// enforce them in any way (see ErrExit and Exit for actually exiting with them):
+//
+//	climate.WithExitCodes(map[int]string{2: "not found", 3: "denied"})
+//
+// Exit codes from repeated modifiers are merged, with later ones overriding the
+// earlier ones (for the same code).
+func WithExitCodes(codes map[int]string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		if opts.ExitCodes == nil {
+			opts.ExitCodes = map[int]string{}
+		}
+		maps.Copy(opts.ExitCodes, codes)
+	}
+}
+
+// exitCodesAnnotation is set on the root command (with WithExitCodes), holding
+// the documented exit codes as (sorted) "<code>\t<meaning>" lines.
+const exitCodesAnnotation = "climate_annotation_exit_codes"
+
+func setExitCodes(cmd *cobra.Command, codes map[int]string) {
+	var b strings.Builder
+	for _, code := range slices.Sorted(maps.Keys(codes)) {
+		fmt.Fprintf(&b, "%d\t%v\n", code, codes[code])
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[exitCodesAnnotation] = b.String()
+}
+
+type exitCodeDoc struct {
+	code, meaning string
+}
+
+// exitCodeDocs returns the exit codes documented (via WithExitCodes) for the
+// program the given command is part of, if any.
+func exitCodeDocs(cmd *cobra.Command) []exitCodeDoc {
+	var docs []exitCodeDoc
+	for _, line := range strings.Split(cmd.Root().Annotations[exitCodesAnnotation], "\n") {
+		if code, meaning, ok := strings.Cut(line, "\t"); ok {
+			docs = append(docs, exitCodeDoc{code, meaning})
+		}
+	}
+	return docs
+}
+
+// exitCodesHelp returns the "Exit Codes:" help section for the given command
+// (aligned as a table, like the flags and positionals), if any.
+func exitCodesHelp(cmd *cobra.Command) string {
+	docs := exitCodeDocs(cmd)
+	width := 0
+	for _, d := range docs {
+		width = max(width, len(d.code))
+	}
+	var b strings.Builder
+	for _, d := range docs {
+		line := fmt.Sprintf("  %-*v  %v", width, d.code, d.meaning)
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
+
+// manExitCodes appends an "EXIT STATUS" section to the descriptions of the given
+// command and all of its subcommands (as Cobra's man page generation doesn't
+// otherwise allow for custom sections).
+func manExitCodes(cmd *cobra.Command) {
+	docs := exitCodeDocs(cmd)
+	if len(docs) == 0 {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("\n\n# EXIT STATUS\n")
+	for _, d := range docs {
+		fmt.Fprintf(&b, "**%v**\n\t%v\n\n", d.code, d.meaning)
+	}
+	section := strings.TrimSuffix(b.String(), "\n")
+	visitCommands(cmd, func(c *cobra.Command) {
+		long := c.Long
+		if long == "" {
+			long = c.Short
+		}
+		c.Long = long + section
+	})
+}
+
+func markdownExitCodes(b *bytes.Buffer, cmd *cobra.Command) {
+	docs := exitCodeDocs(cmd)
+	if len(docs) == 0 {
+		return
+	}
+	b.WriteString("### Exit Codes\n\n| Code | Meaning |\n| --- | --- |\n")
+	for _, d := range docs {
+		fmt.Fprintf(b, "| `%v` | %v |\n", d.code, markdownEscape(d.meaning))
+	}
+	b.WriteString("\n")
+}
+
+func rstExitCodes(b *bytes.Buffer, cmd *cobra.Command) {
+	docs := exitCodeDocs(cmd)
+	if len(docs) == 0 {
+		return
+	}
+	rstHeading(b, "Exit Codes", '-')
+	for _, d := range docs {
+		fmt.Fprintf(b, "``%v``\n   %v\n\n", d.code, d.meaning)
+	}
+}
@@ -0,0 +1,124 @@
+package climate
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type flagSetKey struct{}
+
+type flagSet struct {
+	fset   *pflag.FlagSet
+	fields map[*pflag.Flag]reflect.Value // see flagValue
+}
+
+// Flag returns the (parsed) value of the flag with the given name, declared on
+// the command being run with the given context (or inherited from any of its
+// ancestors), and whether there's such a flag (of a type convertible to T).
+// This saves threading the persistent flags through all the subcommands that
+// are interested in them (or declaring them again).
+//
+//	if path, ok := climate.Flag[string](ctx, "config"); ok {
+//		...
+//	}
+//
+// Integer (and float) flags may be retrieved as any of the integer (and float)
+// types respectively, slices and maps element by element (so that []int works
+// for an int slice flag, for example).
+func Flag[T any](ctx context.Context, name string) (T, bool) {
+	var zero T
+	fs, ok := ctx.Value(flagSetKey{}).(flagSet)
+	if !ok {
+		return zero, false
+	}
+	f := fs.fset.Lookup(name)
+	if f == nil {
+		return zero, false
+	}
+	v, ok := convert(flagValue(fs.fields, f), reflect.TypeFor[T]())
+	if !ok {
+		return zero, false
+	}
+	return v.Interface().(T), true
+}
+
+func withFlagSet(ctx context.Context, fset *pflag.FlagSet, fields map[*pflag.Flag]reflect.Value) context.Context {
+	return context.WithValue(ctx, flagSetKey{}, flagSet{fset, fields})
+}
+
+// flagValue returns the value the given flag sets, i.e., the field it's bound
+// to (see options.declareFields), if any. The flags not bound to any field (like
+// --help, --config or --timeout) are pflag's own string, bool and duration flags
+// (or act like them), whose values are parsed back from their String instead.
+func flagValue(fields map[*pflag.Flag]reflect.Value, f *pflag.Flag) reflect.Value {
+	if v, ok := fields[f]; ok {
+		return v
+	}
+	s := f.Value.String()
+	switch f.Value.Type() {
+	case "string":
+		return reflect.ValueOf(s)
+	case "bool":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return reflect.ValueOf(b)
+		}
+	case "duration":
+		if d, err := time.ParseDuration(s); err == nil {
+			return reflect.ValueOf(d)
+		}
+	}
+	return reflect.Value{}
+}
+
+func kindClass(k reflect.Kind) reflect.Kind {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int64
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflect.Uint64
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return k
+}
+
+// convert converts v to the given type, if they're of the same kind (class, see
+// kindClass) -- element by element for slices and maps.
+func convert(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	switch {
+	case !v.IsValid(): // see flagValue
+		return reflect.Value{}, false
+	case v.Type().AssignableTo(t):
+		return v, true
+	case kindClass(v.Kind()) != kindClass(t.Kind()):
+		return reflect.Value{}, false
+	case t.Kind() == reflect.Slice:
+		s := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := range v.Len() {
+			e, ok := convert(v.Index(i), t.Elem())
+			if !ok {
+				return reflect.Value{}, false
+			}
+			s.Index(i).Set(e)
+		}
+		return s, true
+	case t.Kind() == reflect.Map:
+		m := reflect.MakeMapWithSize(t, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			k, ok1 := convert(iter.Key(), t.Key())
+			e, ok2 := convert(iter.Value(), t.Elem())
+			if !ok1 || !ok2 {
+				return reflect.Value{}, false
+			}
+			m.SetMapIndex(k, e)
+		}
+		return m, true
+	case v.CanConvert(t):
+		return v.Convert(t), true
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,128 @@
+package climate
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithMutuallyExclusive returns a modifier that marks the given flags as
+// mutually exclusive (i.e., at most one of them may be set), for all commands
+// that have all of the given flags.
+func WithMutuallyExclusive(flags ...string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.FlagGroups = append(opts.FlagGroups, internal.FlagGroup{
+			Kind:  internal.MutuallyExclusive,
+			Flags: flags,
+		})
+	}
+}
+
+// WithRequiredTogether returns a modifier that marks the given flags as
+// required together (i.e., either all or none of them may be set), for all
+// commands that have all of the given flags.
+func WithRequiredTogether(flags ...string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.FlagGroups = append(opts.FlagGroups, internal.FlagGroup{
+			Kind:  internal.RequiredTogether,
+			Flags: flags,
+		})
+	}
+}
+
+// WithOneRequired returns a modifier that marks the given flags as one required
+// (i.e., at least one of them must be set), for all commands that have all of
+// the given flags. Combined with WithMutuallyExclusive (for the same flags), it
+// makes exactly one of them required (to pick an input source, say).
+func WithOneRequired(flags ...string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.FlagGroups = append(opts.FlagGroups, internal.FlagGroup{
+			Kind:  internal.OneRequired,
+			Flags: flags,
+		})
+	}
+}
+
+var groupAnnotations = map[internal.FlagGroupKind]string{
+	internal.MutuallyExclusive: "climate_annotation_exclusive",
+	internal.RequiredTogether:  "climate_annotation_together",
+	internal.OneRequired:       "climate_annotation_one_required",
+}
+
+func markFlagGroup(c *cobra.Command, g internal.FlagGroup) {
+	switch g.Kind {
+	case internal.MutuallyExclusive:
+		c.MarkFlagsMutuallyExclusive(g.Flags...)
+	case internal.RequiredTogether:
+		c.MarkFlagsRequiredTogether(g.Flags...)
+	case internal.OneRequired:
+		c.MarkFlagsOneRequired(g.Flags...)
+	}
+}
+
+// markFlagGroups marks both the flag groups declared via struct tags (which are
+// scoped to the struct) and the ones declared via modifiers (which apply to all
+// commands that have all of the flags in the group).
+func markFlagGroups(cmd *cobra.Command, groups []internal.FlagGroup) {
+	visitCommands(cmd, func(c *cobra.Command) {
+		for kind, annotation := range groupAnnotations {
+			for _, fset := range []*pflag.FlagSet{c.PersistentFlags(), c.LocalNonPersistentFlags()} {
+				var (
+					names []string
+					flags = map[string][]string{}
+				)
+				fset.VisitAll(func(f *pflag.Flag) {
+					for _, name := range f.Annotations[annotation] {
+						if _, ok := flags[name]; !ok {
+							names = append(names, name)
+						}
+						flags[name] = append(flags[name], f.Name)
+					}
+				})
+				for _, name := range names {
+					markFlagGroup(c, internal.FlagGroup{Kind: kind, Flags: flags[name]})
+				}
+			}
+		}
+	})
+	for _, g := range groups {
+		marked := map[*pflag.Flag]bool{}
+		visitCommands(cmd, func(c *cobra.Command) {
+			var (
+				fs    []*pflag.Flag
+				added bool
+			)
+			for _, name := range g.Flags {
+				f := c.Flag(name)
+				if f == nil {
+					return
+				}
+				fs = append(fs, f)
+				added = added || !marked[f]
+			}
+			if !added {
+				return
+			}
+			markFlagGroup(c, g)
+			for _, f := range fs {
+				marked[f] = true
+			}
+		})
+	}
+}
+
+func (ts tags) flagGroups(kind internal.FlagGroupKind) []string {
+	key := map[internal.FlagGroupKind]string{
+		internal.MutuallyExclusive: "exclusive",
+		internal.RequiredTogether:  "together",
+		internal.OneRequired:       "onerequired",
+	}[kind]
+	v, ok := ts.m[key]
+	if !ok {
+		return nil
+	}
+	return strings.Split(v, "|")
+}
@@ -0,0 +1,101 @@
+package climate
+
+import (
+	"github.com/avamsi/ergo"
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithoutHelpCommand returns a modifier that makes Run not add Cobra's help
+// subcommand (help [command]), for minimal CLIs or ones that need the name for
+// a subcommand of their own. --help is still available (see WithHelpFlag).
+func WithoutHelpCommand() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.NoHelpCommand = true
+	}
+}
+
+// WithHelpFlag returns a modifier that makes Run use the given name and
+// shorthand (which may be empty, for none) for the help flag, instead of Cobra's
+// --help and -h (which may then be used for, say, --host). --help continues to
+// work (as a hidden alias) when the name is something else.
+func WithHelpFlag(name, shorthand string) func(*internal.RunOptions) {
+	assert.Truef(name != "", "empty help flag name")
+	assert.Truef(len(shorthand) <= 1, "not a shorthand: %v", shorthand)
+	return func(opts *internal.RunOptions) {
+		opts.HelpFlag = &internal.HelpFlag{Name: name, Shorthand: shorthand}
+	}
+}
+
+// noHelpCommand is the name of the (hidden, no-op) command that replaces Cobra's
+// help subcommand, as Cobra adds one unless there's one already set.
+const noHelpCommand = "__no_help"
+
+func disableHelpCommand(cmd *cobra.Command) {
+	cmd.SetHelpCommand(&cobra.Command{Use: noHelpCommand, Hidden: true})
+}
+
+const cobraHelpFlag = "help"
+
+// declareHelpFlags declares the help flag (with the given name and shorthand) on
+// all the commands, before Cobra gets the chance to declare its own.
+func declareHelpFlags(cmd *cobra.Command, hf *internal.HelpFlag) {
+	// Note: Cobra adds its help (and completion) subcommands only on execution,
+	// so we do it early here to declare the help flag on them too (which would
+	// otherwise get -h).
+	cmd.InitDefaultHelpCmd()
+	cmd.InitDefaultCompletionCmd()
+	visitCommands(cmd, func(c *cobra.Command) {
+		// LocalFlags merges the persistent flags into Flags (which Cobra does
+		// before declaring its help flag too), so that the help flag is listed
+		// after them (just like Cobra's).
+		c.LocalFlags()
+		if c.Flags().Lookup(hf.Name) != nil {
+			ergo.Panicf("help flag --%v already declared: %v", hf.Name, c.CommandPath())
+		}
+		c.Flags().BoolP(hf.Name, hf.Shorthand, false, "help for "+c.Name())
+		if hf.Name != cobraHelpFlag {
+			// Cobra only knows about --help, declare it too (hidden, without
+			// the shorthand) so that Cobra doesn't declare it with -h.
+			c.Flags().Bool(cobraHelpFlag, false, "")
+			assert.Nil(c.Flags().MarkHidden(cobraHelpFlag))
+		}
+	})
+}
+
+// WithGroupExitCode returns a modifier that makes the struct commands (which
+// only group their subcommands) exit with the given code when invoked without
+// a subcommand (and without a default one, see Struct), printing their help to
+// stderr instead. By default, they print their help to stdout and exit with 0.
+func WithGroupExitCode(code int) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.GroupExitCode = code
+	}
+}
+
+// groupAnnotation is set on the struct commands, which are only "runnable" to
+// validate args and print their help (see validateNoArgs).
+const groupAnnotation = "climate_annotation_group"
+
+func setGroupExitCode(cmd *cobra.Command, code int) {
+	visitCommands(cmd, func(c *cobra.Command) {
+		if _, ok := c.Annotations[groupAnnotation]; !ok {
+			return
+		}
+		c.RunE = func(c *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return validateNoArgs(c, args)
+			}
+			out := c.OutOrStdout()
+			c.SetOut(c.ErrOrStderr())
+			err := c.Help()
+			c.SetOut(out)
+			if err != nil {
+				return runtimeError(c, err)
+			}
+			return runtimeError(c, ErrExit(code))
+		}
+	})
+}
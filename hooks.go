@@ -0,0 +1,80 @@
+package climate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithPreRun returns a modifier that makes Run call the given hook before the
+// func / method of any command being run (after the flags are parsed and
+// applied, so Flag works with the context it's called with). The context it
+// returns is what's passed on to the func / method (and the later hooks), so it
+// may be used to set up things like database connections:
+//
+//	climate.WithPreRun(func(ctx context.Context) (context.Context, error) {
+//		db, err := sql.Open("sqlite", assert.Ok(climate.Flag[string](ctx, "db")))
+//		return context.WithValue(ctx, dbKey{}, db), err
+//	})
+//
+// Returning an error aborts the run (without calling the func / method or any
+// post-run hooks) and Run returns it, as if the func / method returned it.
+// Multiple pre-run hooks are called in order. Hooks apply to Func plans the
+// same way, wrapping the single command (even if its func doesn't take a
+// context).
+func WithPreRun(hook func(ctx context.Context) (context.Context, error)) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.PreRuns = append(opts.PreRuns, hook)
+	}
+}
+
+// WithPostRun returns a modifier that makes Run call the given hook after the
+// func / method of any command being run, with the error it returned (if any).
+// The hook is called even if the func / method fails (but not if a pre-run hook
+// fails), so it may be used to tear down what pre-run hooks set up. Errors
+// returned by the hook are joined with the error of the func / method.
+// Multiple post-run hooks are called in reverse order (like defers).
+func WithPostRun(hook func(ctx context.Context, runErr error) error) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.PostRuns = append(opts.PostRuns, hook)
+	}
+}
+
+func applyPreRuns(c *cobra.Command, fields map[*pflag.Flag]reflect.Value, hooks []func(context.Context) (context.Context, error)) error {
+	for _, hook := range hooks {
+		var ctx context.Context
+		err := callWithExit(func() (err error) {
+			ctx, err = hook(withExit(withFlagSet(c.Context(), c.Flags(), fields)))
+			return err
+		})
+		if err != nil {
+			return runtimeError(c, err)
+		}
+		c.SetContext(ctx)
+	}
+	return nil
+}
+
+// wrapPostRuns wraps the RunE of cmd and all of its subcommands to call the
+// given hooks after (Cobra's own PersistentPostRunE is not called on errors).
+func wrapPostRuns(cmd *cobra.Command, hooks []func(context.Context, error) error) {
+	wrapRunE(cmd, func(runE runFunc) runFunc {
+		return func(c *cobra.Command, args []string) error {
+			err := runE(c, args)
+			for i := len(hooks) - 1; i >= 0; i-- {
+				perr := callWithExit(func() error {
+					return hooks[i](withExit(c.Context()), err)
+				})
+				if perr != nil {
+					err = runtimeError(c, errors.Join(err, perr))
+				}
+			}
+			return err
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package climate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithInteractive returns a modifier that makes Run prompt for the values of
+// the required flags that are missing (instead of erroring out), but only if
+// stdin is a terminal (so that scripts etc. continue to get the usual error) or
+// if the input is given explicitly via WithInput.
+//
+// The flag usage (i.e., the field doc) is used as the question -- bool flags
+// are asked as yes / no and enum flags are asked to pick one of the values.
+func WithInteractive() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Interactive = true
+	}
+}
+
+func isRequired(f *pflag.Flag) bool {
+	v, ok := f.Annotations[cobra.BashCompOneRequiredFlag]
+	return ok && len(v) == 1 && v[0] == "true"
+}
+
+func question(f *pflag.Flag) string {
+	if f.Usage != "" {
+		return f.Usage
+	}
+	return "--" + f.Name
+}
+
+// promptRequired prompts (on out) for the values of the required flags that are
+// not already set, reading the answers from in. Invalid answers are re-prompted
+// and if in runs out, the rest of the flags are left alone (so that Cobra errors
+// out as usual).
+func promptRequired(fset *pflag.FlagSet, in *bufio.Reader, out io.Writer) error {
+	var errs []error
+	fset.VisitAll(func(f *pflag.Flag) {
+		if !isRequired(f) || f.Changed || len(errs) > 0 {
+			return
+		}
+		for {
+			var (
+				values, isEnum = f.Annotations[enumAnnotation]
+				isBool         = (f.Value.Type() == "bool")
+			)
+			switch {
+			case isBool:
+				fmt.Fprintf(out, "%v [y/n]: ", question(f))
+			case isEnum:
+				fmt.Fprintf(out, "%v\n", question(f))
+				for i, v := range values {
+					fmt.Fprintf(out, "  %v) %v\n", i+1, v)
+				}
+				fmt.Fprintf(out, "[1-%v]: ", len(values))
+			default:
+				fmt.Fprintf(out, "%v: ", question(f))
+			}
+			line, err := in.ReadString('\n')
+			if err != nil && line == "" {
+				if !errors.Is(err, io.EOF) {
+					errs = append(errs, err)
+				}
+				fmt.Fprintln(out)
+				return
+			}
+			answer := strings.TrimSpace(line)
+			switch {
+			case isBool:
+				switch strings.ToLower(answer) {
+				case "y", "yes":
+					answer = "true"
+				case "n", "no":
+					answer = "false"
+				}
+			case isEnum:
+				if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(values) {
+					answer = values[i-1]
+				} else if !slices.Contains(values, answer) {
+					fmt.Fprintf(out, "must be one of %v\n", strings.Join(values, ", "))
+					continue
+				}
+			}
+			if answer == "" {
+				continue
+			}
+			if err := fset.Set(f.Name, answer); err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			return
+		}
+	})
+	return errors.Join(errs...)
+}
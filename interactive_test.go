@@ -0,0 +1,94 @@
+package climate
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func TestPromptRequired(t *testing.T) {
+	var (
+		fset   = pflag.NewFlagSet("test", pflag.ContinueOnError)
+		name   string
+		format string
+		force  bool
+		count  int64
+	)
+	fset.SortFlags = false
+	fset.StringVar(&name, "name", "", "name to use")
+	enumVarP(fset, []string{"json", "yaml"})(&format, "format", "", "", "")
+	fset.BoolVar(&force, "force", false, "")
+	fset.Int64Var(&count, "count", 0, "")
+	for _, f := range []string{"name", "format", "force"} {
+		assert.Nil(cobra.MarkFlagRequired(fset, f))
+	}
+	var (
+		in  = bufio.NewReader(strings.NewReader("\nclimate\nxml\n2\nmaybe\ny\n"))
+		out strings.Builder
+	)
+	if err := promptRequired(fset, in, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := []any{name, format, force, count}, []any{"climate", "yaml", true, int64(0)}; !cmp.Equal(got, want) {
+		t.Errorf("promptRequired(...) = %v, want %v", got, want)
+	}
+	want := `name to use: name to use: --format
+  1) json
+  2) yaml
+[1-2]: must be one of json, yaml
+--format
+  1) json
+  2) yaml
+[1-2]: --force [y/n]: invalid argument "maybe" for "--force" flag: strconv.ParseBool: parsing "maybe": invalid syntax
+--force [y/n]: `
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("promptRequired(...) diff(-want +got):\n%v", diff)
+	}
+}
+
+func TestPromptRequiredEOF(t *testing.T) {
+	var (
+		fset = pflag.NewFlagSet("test", pflag.ContinueOnError)
+		name string
+	)
+	fset.StringVar(&name, "name", "", "")
+	assert.Nil(cobra.MarkFlagRequired(fset, "name"))
+	var out strings.Builder
+	if err := promptRequired(fset, bufio.NewReader(strings.NewReader("")), &out); err != nil {
+		t.Fatal(err)
+	}
+	if fset.Lookup("name").Changed {
+		t.Errorf("promptRequired(...) set --name on EOF")
+	}
+}
+
+func TestWithInteractiveTerminal(t *testing.T) {
+	if null := assert.Ok(os.Open(os.DevNull)); isTerminal(null) {
+		t.Errorf("isTerminal(%v) = true, want false", os.DevNull)
+	}
+	r, w, err := os.Pipe()
+	assert.Nil(err)
+	defer func(stdin *os.File, isTerm func(any) bool) {
+		os.Stdin, isTerminal = stdin, isTerm
+	}(os.Stdin, isTerminal)
+	os.Stdin, isTerminal = r, func(rw any) bool { return rw == os.Stdin }
+	assert.Ok(w.WriteString("climate\n"))
+	assert.Nil(w.Close())
+	var name string
+	p := Func(func(opts *struct {
+		Name string `cli:"required"`
+	}) {
+		name = opts.Name
+	})
+	stdout, stderr, code, err := Execute(context.Background(), p, nil, WithInteractive())
+	if stdout != "" || stderr != "--name: " || code != 0 || err != nil || name != "climate" {
+		t.Errorf("Execute(...) = %q, %q, %v, %v (name: %q)", stdout, stderr, code, err, name)
+	}
+}
@@ -3,8 +3,13 @@ package internal
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"go/ast"
+	"maps"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 	"unicode"
 
@@ -20,13 +25,29 @@ type RawMetadata struct {
 	Directives map[string]string
 	Comment    string
 	Params     []string
-	Children   map[string]*RawMetadata
+	// Value is the value of (string) constants, which are recorded as children
+	// of their types (see Metadata.Constants).
+	Value    string
+	Children map[string]*RawMetadata
+	// Encoded is the (gob) encoded children that are yet to be decoded (see
+	// Encode), which are never in Children at the same time.
+	Encoded map[string][]byte
 }
 
-func DecodeAsRawMetadata(b []byte) *RawMetadata {
+func decodeRaw(b []byte) (*RawMetadata, error) {
 	var rmd RawMetadata
-	assert.Nil(gob.NewDecoder(bytes.NewReader(b)).Decode(&rmd))
-	return &rmd
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&rmd); err != nil {
+		return nil, err
+	}
+	return &rmd, nil
+}
+
+// DecodeAsRawMetadata decodes the given (encoded) metadata, all of it (i.e.,
+// including the encoded children, see Encode).
+func DecodeAsRawMetadata(b []byte) *RawMetadata {
+	rmd := assert.Ok(decodeRaw(b))
+	rmd.expandAll()
+	return rmd
 }
 
 const directivePrefix = "//cli:"
@@ -55,6 +76,7 @@ func (rmd *RawMetadata) SetComment(comment *ast.CommentGroup) {
 }
 
 func (rmd *RawMetadata) Child(name string) *RawMetadata {
+	rmd.expand(name)
 	if rmd.Children == nil {
 		rmd.Children = map[string]*RawMetadata{}
 	}
@@ -66,22 +88,226 @@ func (rmd *RawMetadata) Child(name string) *RawMetadata {
 	return child
 }
 
-func (rmd *RawMetadata) Encode() []byte {
+// lookup is Child, except that it returns nil (instead of creating the child)
+// if there's no such child.
+func (rmd *RawMetadata) lookup(name string) *RawMetadata {
+	if rmd == nil || !rmd.hasChild(name) {
+		return nil
+	}
+	return rmd.Child(name)
+}
+
+// has reports whether there's a descendant of rmd with the given path.
+func (rmd *RawMetadata) has(pkgPath string, names []string) bool {
+	rmd = rmd.lookup(pkgPath)
+	for _, name := range names {
+		rmd = rmd.lookup(name)
+	}
+	return rmd != nil
+}
+
+func (rmd *RawMetadata) hasChild(name string) bool {
+	_, ok1 := rmd.Children[name]
+	_, ok2 := rmd.Encoded[name]
+	return ok1 || ok2
+}
+
+// expand decodes the encoded child with the given name, if any. The encoded
+// children are produced by Encode itself (and the metadata as a whole is
+// already decoded fine by then), so failing to decode them is a bug.
+func (rmd *RawMetadata) expand(name string) {
+	b, ok := rmd.Encoded[name]
+	if !ok {
+		return
+	}
+	delete(rmd.Encoded, name)
+	if rmd.Children == nil {
+		rmd.Children = map[string]*RawMetadata{}
+	}
+	rmd.Children[name] = assert.Ok(decodeRaw(b))
+}
+
+func (rmd *RawMetadata) expandAll() {
+	for name := range rmd.Encoded {
+		rmd.expand(name)
+	}
+	rmd.Encoded = nil
+	for _, child := range rmd.Children {
+		child.expandAll()
+	}
+}
+
+func encode(rmd *RawMetadata) []byte {
 	var b bytes.Buffer
 	assert.Nil(gob.NewEncoder(&b).Encode(rmd))
 	return b.Bytes()
 }
 
+// Encode encodes the metadata, with the symbols (i.e., the children of the
+// packages) encoded separately, so that they're only decoded when (and if)
+// they're looked up -- most runs only look up a handful of symbols (the ones
+// for the commands being run), even for CLIs with hundreds of commands.
+func (rmd *RawMetadata) Encode() []byte {
+	root := *rmd
+	root.Children = make(map[string]*RawMetadata, len(rmd.Children))
+	for name, pkg := range rmd.Children {
+		lazy := *pkg
+		lazy.Children = nil
+		lazy.Encoded = maps.Clone(pkg.Encoded)
+		for sym, child := range pkg.Children {
+			if lazy.Encoded == nil {
+				lazy.Encoded = map[string][]byte{}
+			}
+			lazy.Encoded[sym] = encode(child)
+		}
+		root.Children[name] = &lazy
+	}
+	return encode(&root)
+}
+
 type Metadata struct {
 	root     *Metadata
 	raw      *RawMetadata
 	children map[string]*Metadata
+	// path is the (fully qualified) path of this metadata from the root and
+	// known is whether it was actually decoded (or just created on lookup).
+	path  []string
+	known bool
+	// all is all the metadata looked up so far (only tracked on the root).
+	all []*Metadata
+}
+
+// merge merges other into rmd, with other taking precedence on conflicts (i.e.,
+// its non-empty Doc, Comment and Params replace those of rmd, its Directives
+// replace those of rmd with the same name and its Children are merged as per
+// the same rules, recursively). Encoded children are only decoded on conflicts.
+func (rmd *RawMetadata) merge(other *RawMetadata) error {
+	if other.Doc != "" {
+		rmd.Doc = other.Doc
+	}
+	if other.Comment != "" {
+		rmd.Comment = other.Comment
+	}
+	if other.Params != nil {
+		rmd.Params = other.Params
+	}
+	if other.Value != "" {
+		rmd.Value = other.Value
+	}
+	for k, v := range other.Directives {
+		if rmd.Directives == nil {
+			rmd.Directives = map[string]string{}
+		}
+		rmd.Directives[k] = v
+	}
+	for name, b := range other.Encoded {
+		if !rmd.hasChild(name) {
+			if rmd.Encoded == nil {
+				rmd.Encoded = map[string][]byte{}
+			}
+			rmd.Encoded[name] = b
+			continue
+		}
+		child, err := decodeRaw(b)
+		if err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		if err := rmd.Child(name).merge(child); err != nil {
+			return err
+		}
+	}
+	for name, child := range other.Children {
+		if err := rmd.Child(name).merge(child); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func DecodeAsMetadata(b []byte) *Metadata {
-	md := &Metadata{raw: DecodeAsRawMetadata(b)}
+// DecodeAsMetadata decodes and merges the given (encoded) metadata, with later
+// ones taking precedence over earlier ones on conflicts (see merge). Unlike
+// DecodeAsRawMetadata, it returns an error (instead of panicking) for malformed
+// metadata, as it's called at run time (rather than at generation time).
+func DecodeAsMetadata(bs ...[]byte) (*Metadata, error) {
+	var merged RawMetadata
+	for i, b := range bs {
+		rmd, err := decodeRaw(b)
+		if err == nil {
+			err = merged.merge(rmd)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed metadata #%v: %w", i+1, err)
+		}
+	}
+	md := &Metadata{raw: &merged, known: true}
 	md.root = md
-	return md
+	return md, nil
+}
+
+type symbolSplit struct {
+	pkgPath string
+	names   []string
+}
+
+// splitSymbol returns the possible splits of the given symbol (see SplitSymbol)
+// in the order of precedence. The names are split from the right, as the
+// package path may have dots too (like gopkg.in/yaml.v3), and are at most two
+// (a type and its method, field or constant), with the two names preferred
+// only if the last one is exported (as the methods and fields are).
+func splitSymbol(symbol string) []symbolSplit {
+	var (
+		i      = strings.LastIndex(symbol, "/") + 1
+		parts  = strings.Split(symbol[i:], ".")
+		splits []symbolSplit
+	)
+	for n := 1; n <= min(2, len(parts)-1); n++ {
+		elems, names := parts[:len(parts)-n], parts[len(parts)-n:]
+		if slices.Contains(elems, "") || slices.Contains(names, "") {
+			continue
+		}
+		split := symbolSplit{symbol[:i] + strings.Join(elems, "."), names}
+		if n == 2 && ast.IsExported(names[1]) {
+			splits = slices.Insert(splits, 0, split)
+		} else {
+			splits = append(splits, split)
+		}
+	}
+	return splits
+}
+
+// SplitSymbol splits the given fully qualified symbol (like
+// example.com/app.root.Deploy) into its package path and the names leading up
+// to it from there (root and Deploy, for example). Symbols like
+// example.com/my.app.root are ambiguous (the package could be example.com/my
+// or example.com/my.app) and are split as the latter, see Metadata.Override.
+func SplitSymbol(symbol string) (string, []string, bool) {
+	splits := splitSymbol(symbol)
+	if len(splits) == 0 {
+		return "", nil, false
+	}
+	return splits[0].pkgPath, splits[0].names, true
+}
+
+// Override replaces the doc of the given (fully qualified, see SplitSymbol)
+// symbol with the given one, also dropping its comment and short directive (so
+// that the short description is derived from the new doc as well). Ambiguous
+// symbols are resolved against the metadata first, falling back to SplitSymbol.
+func (md *Metadata) Override(symbol, doc string) {
+	splits := splitSymbol(symbol)
+	assert.Truef(len(splits) > 0, "not a fully qualified symbol: %v", symbol)
+	split := splits[0]
+	for _, s := range splits {
+		if md.root.raw.has(s.pkgPath, s.names) {
+			split = s
+			break
+		}
+	}
+	rmd := md.root.raw.Child(split.pkgPath)
+	for _, name := range split.names {
+		rmd = rmd.Child(name)
+	}
+	rmd.Doc, rmd.Comment = doc, ""
+	delete(rmd.Directives, "short")
 }
 
 func (md *Metadata) Lookup(pkgPath, name string) *Metadata {
@@ -95,6 +321,45 @@ func (md *Metadata) LookupType(t reflect.Type) *Metadata {
 	return md.Lookup(t.PkgPath(), t.Name())
 }
 
+// Constants returns the short descriptions (see Short) of the documented string
+// constants of the given type, by their values. Unlike LookupType, this isn't
+// tracked for Verify, as the type itself need not have any metadata at all.
+func (md *Metadata) Constants(t reflect.Type) map[string]string {
+	if md == nil {
+		return nil
+	}
+	raw := md.root.raw.lookup(t.PkgPath()).lookup(t.Name())
+	if raw == nil {
+		return nil
+	}
+	descs := map[string]string{}
+	for _, child := range raw.Children {
+		if child.Value == "" {
+			continue
+		}
+		if desc := (&Metadata{raw: child}).Short(); desc != "" {
+			descs[child.Value] = desc
+		}
+	}
+	return descs
+}
+
+func (md *Metadata) Directive(name string) (string, bool) {
+	if md == nil {
+		return "", false
+	}
+	v, ok := md.raw.Directives[name]
+	return v, ok
+}
+
+// ParamName returns the (kebab case) name of the i-th param of the func, if any.
+func (md *Metadata) ParamName(i int) (string, bool) {
+	if md == nil || i >= len(md.raw.Params) {
+		return "", false
+	}
+	return NormalizeToKebabCase(md.raw.Params[i]), true
+}
+
 func (md *Metadata) Aliases() []string {
 	if md == nil {
 		return nil
@@ -111,13 +376,48 @@ func (md *Metadata) Aliases() []string {
 	return aliases
 }
 
+// examplesRegexp matches the "Examples:" (or "Example:") line that starts the
+// examples section of a doc (which runs till the end of the doc).
+var examplesRegexp = regexp.MustCompile(`(?m)^Examples?:$`)
+
+// Long returns the doc, sans the examples section (see Example), if any.
 func (md *Metadata) Long() string {
 	if md == nil {
 		return ""
 	}
+	if loc := examplesRegexp.FindStringIndex(md.raw.Doc); loc != nil {
+		return strings.TrimSpace(md.raw.Doc[:loc[0]])
+	}
 	return md.raw.Doc
 }
 
+// Example returns the examples section of the doc, i.e., everything after an
+// "Examples:" (or "Example:") line, with the (gofmt-ed) code blocks indented by
+// two spaces instead of a tab (by Cobra's convention), so that
+//
+//	// Examples:
+//	//
+//	//	greet --name=me
+//	//	greet --name=me --time=morning
+//
+// in the doc comment shows up under "Examples:" in --help as is.
+func (md *Metadata) Example() string {
+	if md == nil {
+		return ""
+	}
+	loc := examplesRegexp.FindStringIndex(md.raw.Doc)
+	if loc == nil {
+		return ""
+	}
+	lines := strings.Split(strings.Trim(md.raw.Doc[loc[1]:], "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + strings.TrimPrefix(line, "\t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (md *Metadata) Short() string {
 	if md == nil {
 		return ""
@@ -151,14 +451,19 @@ func (md *Metadata) Short() string {
 	return string(rs)
 }
 
-func (md *Metadata) Usage(name string, args []ParamType) string {
+func (md *Metadata) Usage(name string, args []ParamType, bounds *ArgsBounds) string {
 	if md == nil {
+		if bounds != nil && bounds.Names != nil {
+			// The args are named explicitly, so we don't need the metadata
+			// to know what to call them (the rest go by "args").
+			return strings.ToLower(name) + boundedUsage("args", bounds)
+		}
 		return strings.ToLower(name)
 	}
 	if usage, ok := md.raw.Directives["usage"]; ok {
 		return usage
 	}
-	return strings.ToLower(name) + ParamsUsage(md.raw.Params, args)
+	return strings.ToLower(name) + ParamsUsage(md.raw.Params, args, bounds)
 }
 
 func (md *Metadata) Child(name string) *Metadata {
@@ -170,8 +475,74 @@ func (md *Metadata) Child(name string) *Metadata {
 	}
 	child, ok := md.children[name]
 	if !ok {
-		child = &Metadata{root: md.root, raw: md.raw.Child(name)}
+		known := md.raw.hasChild(name)
+		child = &Metadata{
+			root:  md.root,
+			raw:   md.raw.Child(name),
+			path:  append(slices.Clip(md.path), name),
+			known: known,
+		}
 		md.children[name] = child
+		md.root.all = append(md.root.all, child)
 	}
 	return child
 }
+
+// Verify returns an error listing the mismatches between the metadata and what
+// was looked up so far (i.e., the commands and flags of the built plan), if
+// any. All the (package level) symbols looked up must be in the metadata, and
+// the children of these symbols (methods and fields) must all be looked up.
+func (md *Metadata) Verify() error {
+	if md == nil {
+		return errors.New("no metadata")
+	}
+	var errs []string
+	for _, m := range md.root.all {
+		if len(m.path) < 2 { // skip the packages themselves
+			continue
+		}
+		if !m.known {
+			// Only report the topmost missing metadata (and not all of its
+			// children, which are obviously missing as well).
+			if parent := m.path[:len(m.path)-1]; len(parent) == 1 || md.root.lookupKnown(parent) {
+				errs = append(errs, "missing metadata for "+strings.Join(m.path, "."))
+			}
+			continue
+		}
+		// Note: only the packages have encoded children (see Encode), which are
+		// skipped above.
+		for name := range m.raw.Children {
+			if _, ok := m.children[name]; !ok {
+				errs = append(errs, "metadata for nonexistent "+strings.Join(append(slices.Clip(m.path), name), "."))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	slices.Sort(errs)
+	return fmt.Errorf("stale metadata:\n\t%v", strings.Join(errs, "\n\t"))
+}
+
+// VisitLookups calls fn with each of the (fully qualified) symbols looked up so
+// far (but not the packages themselves), in order, and whether there's metadata
+// for it.
+func (md *Metadata) VisitLookups(fn func(symbol string, found bool)) {
+	for _, m := range md.root.all {
+		if len(m.path) < 2 { // skip the packages themselves
+			continue
+		}
+		fn(strings.Join(m.path, "."), m.known)
+	}
+}
+
+func (md *Metadata) lookupKnown(path []string) bool {
+	for _, name := range path {
+		child, ok := md.children[name]
+		if !ok || !child.known {
+			return false
+		}
+		md = child
+	}
+	return true
+}
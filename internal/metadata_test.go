@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeAsMetadata(t *testing.T) {
+	var a, b RawMetadata
+	a.Child("pkg").Child("f").Doc = "f from a"
+	a.Child("pkg").Child("f").Directives = map[string]string{"short": "a", "aliases": "x"}
+	a.Child("pkg").Child("g").Doc = "g from a"
+	b.Child("pkg").Child("f").Doc = "f from b"
+	b.Child("pkg").Child("f").Directives = map[string]string{"short": "b"}
+	b.Child("other").Child("h").Params = []string{"args"}
+	md, err := DecodeAsMetadata(a.Encode(), b.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the conflicting symbols are decoded by now (see merge).
+	if got, want := slices.Sorted(maps.Keys(md.raw.Child("pkg").Encoded)), []string{"g"}; !slices.Equal(got, want) {
+		t.Errorf("DecodeAsMetadata(a, b): encoded %v, want %v", got, want)
+	}
+	md.raw.expandAll()
+	var want RawMetadata
+	want.Child("pkg").Child("f").Doc = "f from b"
+	want.Child("pkg").Child("f").Directives = map[string]string{"short": "b", "aliases": "x"}
+	want.Child("pkg").Child("g").Doc = "g from a"
+	want.Child("other").Child("h").Params = []string{"args"}
+	if diff := cmp.Diff(&want, md.raw); diff != "" {
+		t.Errorf("DecodeAsMetadata(a, b) diff(-want +got):\n%v", diff)
+	}
+}
+
+func TestLazyMetadata(t *testing.T) {
+	var rmd RawMetadata
+	rmd.Child("pkg").Child("f").Doc = "f"
+	rmd.Child("pkg").Child("g").Child("Method").Doc = "g.Method"
+	md, err := DecodeAsMetadata(rmd.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := md.Lookup("pkg", "g").Child("Method").Long(); got != "g.Method" {
+		t.Errorf("Lookup(pkg, g).Child(Method).Long() = %q, want %q", got, "g.Method")
+	}
+	if _, ok := md.raw.Child("pkg").Encoded["f"]; !ok {
+		t.Errorf("Lookup(pkg, g) decoded f as well")
+	}
+}
+
+func TestDecodeAsMetadataMalformed(t *testing.T) {
+	var rmd RawMetadata
+	if _, err := DecodeAsMetadata(rmd.Encode(), []byte("garbage")); err == nil {
+		t.Errorf("DecodeAsMetadata(..., garbage) = nil error, want malformed metadata #2")
+	}
+}
+
+func TestExample(t *testing.T) {
+	var rmd RawMetadata
+	rmd.Child("pkg").Child("f").Doc = "Greet someone.\n\nMore details.\n\nExamples:\n\n\tgreet --name=me\n\n\tgreet --name=me \\\n\t  --time=morning"
+	md, err := DecodeAsMetadata(rmd.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := md.Lookup("pkg", "f")
+	if got, want := f.Long(), "Greet someone.\n\nMore details."; got != want {
+		t.Errorf("Long() = %q, want %q", got, want)
+	}
+	if got, want := f.Example(), "  greet --name=me\n\n  greet --name=me \\\n    --time=morning"; got != want {
+		t.Errorf("Example() = %q, want %q", got, want)
+	}
+	if got := f.Short(); got != "Greet someone" {
+		t.Errorf("Short() = %q, want %q", got, "Greet someone")
+	}
+}
+
+func TestSplitSymbol(t *testing.T) {
+	tests := []struct {
+		in      string
+		pkgPath string
+		names   []string
+		ok      bool
+	}{
+		{in: "main.root", pkgPath: "main", names: []string{"root"}, ok: true},
+		{in: "example.com/app.root.Deploy", pkgPath: "example.com/app", names: []string{"root", "Deploy"}, ok: true},
+		{in: "example.com/my.app.root", pkgPath: "example.com/my.app", names: []string{"root"}, ok: true},
+		{in: "gopkg.in/yaml.v3.root.Deploy", pkgPath: "gopkg.in/yaml.v3", names: []string{"root", "Deploy"}, ok: true},
+		{in: "gopkg.in/yaml.v3.root", pkgPath: "gopkg.in/yaml.v3", names: []string{"root"}, ok: true},
+		{in: "example.com/app"},
+		{in: "main."},
+		{in: ".root"},
+	}
+	for _, test := range tests {
+		pkgPath, names, ok := SplitSymbol(test.in)
+		if pkgPath != test.pkgPath || !slices.Equal(names, test.names) || ok != test.ok {
+			t.Errorf("SplitSymbol(%v) = %v, %v, %v, want %v, %v, %v",
+				test.in, pkgPath, names, ok, test.pkgPath, test.names, test.ok)
+		}
+	}
+}
+
+func TestOverrideAmbiguousSymbol(t *testing.T) {
+	var rmd RawMetadata
+	rmd.Child("gopkg.in/yaml.v3").Child("Root").Doc = "Root"
+	md, err := DecodeAsMetadata(rmd.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SplitSymbol alone would split this as gopkg.in/yaml's v3.Root.
+	md.Override("gopkg.in/yaml.v3.Root", "Root overridden.")
+	if got, want := md.Lookup("gopkg.in/yaml.v3", "Root").Long(), "Root overridden."; got != want {
+		t.Errorf("Lookup(gopkg.in/yaml.v3, Root).Long() = %q, want %q", got, want)
+	}
+}
@@ -21,11 +21,12 @@ func ParamTypes(f reflect.Type) []ParamType {
 	for i := 0; i < f.NumIn(); i++ {
 		switch f.In(i).Kind() {
 		case reflect.Interface:
-			// Only context.Context for now, which counts as NoParam for CLI.
+			// Only context.Context and io.Writer for now, which count as
+			// NoParam for CLI.
 			types = append(types, NoParam)
 		case reflect.String:
 			types = append(types, RequiredParam)
-		case reflect.Pointer:
+		case reflect.Pointer, reflect.Struct: // *T or T for opts
 			types = append(types, OptionalParam)
 		case reflect.Array:
 			types = append(types, FixedLengthParam)
@@ -36,10 +37,45 @@ func ParamTypes(f reflect.Type) []ParamType {
 	return types
 }
 
-func ParamsUsage(names []string, types []ParamType) string {
+// ArgsBounds constrains the number of (arbitrary length) positional args.
+type ArgsBounds struct {
+	Min, Max int // Max < 0 implies there's no upper bound
+	// Names are the (purely cosmetic) names of the args, by position, to refer
+	// to them by in the usage and errors (the rest go by the param name).
+	Names []string
+}
+
+func boundedUsage(name string, bounds *ArgsBounds) string {
+	argName := func(i int) string {
+		if i < len(bounds.Names) {
+			return bounds.Names[i]
+		}
+		return name
+	}
+	var usage strings.Builder
+	for i := 0; i < bounds.Min; i++ {
+		usage.WriteString(fmt.Sprintf(" <%v>", argName(i)))
+	}
+	if bounds.Max < 0 {
+		for i := bounds.Min; i < len(bounds.Names); i++ {
+			usage.WriteString(fmt.Sprintf(" [%v]", bounds.Names[i]))
+		}
+		usage.WriteString(fmt.Sprintf(" [%v...]", name))
+	}
+	for i := bounds.Min; i < bounds.Max; i++ {
+		usage.WriteString(fmt.Sprintf(" [%v]", argName(i)))
+	}
+	return usage.String()
+}
+
+func ParamsUsage(names []string, types []ParamType, bounds *ArgsBounds) string {
 	var usage strings.Builder
 	for i, name := range names {
 		name = NormalizeToKebabCase(name)
+		if types[i] == ArbitraryLengthParam && bounds != nil {
+			usage.WriteString(boundedUsage(name, bounds))
+			continue
+		}
 		switch types[i] {
 		case RequiredParam:
 			usage.WriteString(fmt.Sprintf(" <%v>", name))
@@ -1,11 +1,112 @@
 package internal
 
-import "context"
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
 
 type Plan interface {
-	Execute(context.Context, *Metadata) error
+	Build(*Metadata, *RunOptions) *cobra.Command
 }
 
 type RunOptions struct {
-	Metadata *[]byte
+	Metadata     [][]byte
+	MetadataFS   fs.FS
+	MetadataPath string
+	// MetadataOverrides are the docs to override the metadata with, by the
+	// fully qualified symbols.
+	MetadataOverrides map[string]string
+	// StrictMetadata is whether to verify the metadata against the plan.
+	StrictMetadata bool
+	Debug          bool
+	TagPreference  []string
+	Name           string
+	EnvPrefix      string
+	ManSection     string
+	CobraHooks     []func(*cobra.Command)
+	FlagGroups     []FlagGroup
+	Signals        []os.Signal
+	Color          *bool
+
+	Completions       map[string]func(context.Context, string) ([]string, error)
+	CompletionCommand bool
+	Validators        map[string][]Validator
+	EnumSources       map[string]func(context.Context) ([]string, error)
+	Requires          map[string][]string
+
+	SuggestionsDistance int
+	DisableSuggestions  bool
+	CaseInsensitive     bool
+
+	ArgsTransforms    []func([]string) []string
+	ArgsFileExpansion bool
+	PluginPrefix      string
+
+	Input         io.Reader
+	Output, Error io.Writer
+	Interactive   bool
+	TimeoutFlag   string
+	Slog          bool
+	Recover       bool
+	Timing        bool
+	DryRunFlag    bool
+	FormatError   func(error) string
+	ReturnError   bool
+
+	PreRuns  []func(context.Context) (context.Context, error)
+	PostRuns []func(context.Context, error) error
+
+	ConfigPath, ConfigFormat string
+	Defaults                 []func(string) (string, bool)
+
+	Version, VersionText string
+
+	HelpTemplate, UsageTemplate string
+	CompactHelp                 bool
+	NoHelpCommand               bool
+	HelpFlag                    *HelpFlag
+	GroupExitCode               int
+	ExitCodes                   map[int]string
+
+	// Fields is the fields the flags are bound to (as declared while building
+	// the plan), for reading the flag values as their fields' types.
+	Fields map[*pflag.Flag]reflect.Value
+	// Args is the (fully named, see DescribeJSON) bounds of the args of the
+	// commands that take any, as built from the plan.
+	Args map[*cobra.Command]*ArgsBounds
+}
+
+type HelpFlag struct {
+	Name, Shorthand string
+}
+
+// Validator validates the values (of Type) of a flag.
+type Validator struct {
+	Type     reflect.Type
+	Validate func(reflect.Value) error
+}
+
+type CommandOptions struct {
+	Args          *ArgsBounds
+	ArgNames      []string
+	ArgCompletion func(context.Context, []string, string) ([]string, error)
+}
+
+type FlagGroupKind int
+
+const (
+	MutuallyExclusive FlagGroupKind = iota
+	RequiredTogether
+	OneRequired
+)
+
+type FlagGroup struct {
+	Kind  FlagGroupKind
+	Flags []string
 }
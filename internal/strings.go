@@ -22,6 +22,8 @@ var (
 // decomposing and then dropping all non-ASCII runes (and so is lossy).
 // It supports camelCase, PascalCase, snake_case, and SCREAMING_SNAKE_CASE --
 // anything else (including digits mixed in) working is a happy accident.
+// Acronyms are kept together, with a trailing acronym split off only from a
+// following capitalized word (so, URL is url and HTTPSProxy is https-proxy).
 func NormalizeToKebabCase(s string) string {
 	// Decompose and remove all non-spacing marks.
 	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)))
@@ -0,0 +1,50 @@
+package climate
+
+import (
+	"strconv"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/pflag"
+)
+
+const negatableAnnotation = "climate_annotation_negatable"
+
+// negatedValue is the pflag.Value for the --no-X counterpart of a negatable
+// bool flag --X, which sets the same bool (to the negated value).
+type negatedValue struct {
+	p *bool
+	f *pflag.Flag // the flag being negated
+}
+
+var _ pflag.Value = negatedValue{}
+
+func (nv negatedValue) String() string {
+	return strconv.FormatBool(!*nv.p)
+}
+
+func (nv negatedValue) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*nv.p = !v
+	// Mark the negated flag as changed too, so that the environment variables
+	// etc. (see applyEnv) don't override --no-X.
+	nv.f.Changed = true
+	return nil
+}
+
+func (nv negatedValue) Type() string {
+	return "bool"
+}
+
+// declareNegation declares the (hidden) --no-X counterpart of the bool flag --X
+// with the given name, which is shown as --[no-]X in the help instead (see
+// flagUsages). If both are passed, the last one wins (as they set the same p).
+func declareNegation(fset *pflag.FlagSet, name string, p *bool) {
+	f := fset.Lookup(name)
+	nf := fset.VarPF(negatedValue{p, f}, "no-"+name, "", "negate --"+name)
+	nf.NoOptDefVal = "true"
+	nf.Hidden = true
+	assert.Nil(fset.SetAnnotation(name, negatableAnnotation, nil))
+}
@@ -0,0 +1,74 @@
+package climate
+
+import (
+	"reflect"
+
+	"github.com/avamsi/ergo"
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/pflag"
+)
+
+// typeIsOptional returns whether t is a pointer to a (non-nestable) flag type,
+// i.e., a field that's left nil unless the flag is set (see optionalValue).
+func typeIsOptional(t reflect.Type) bool {
+	if t.Kind() != reflect.Pointer {
+		return false
+	}
+	e := t.Elem()
+	if _, ok := flagTypes[e]; ok {
+		return true
+	}
+	return typeIsScalar(e) || e == timeType || typeIsTextUnmarshaler(e)
+}
+
+// optionalValue is the pflag.Value for the pointer fields (*T), wrapping the
+// pflag.Value for T (which sets a scratch T) and only pointing the field to the
+// scratch T once the flag is actually set, so that "not provided" (nil) can be
+// told apart from zero (for PATCH-style commands, say).
+type optionalValue struct {
+	pflag.Value
+	field   reflect.Value // the *T field itself
+	scratch reflect.Value // the *T the wrapped Value sets
+}
+
+var _ pflag.Value = (*optionalValue)(nil)
+
+func (ov *optionalValue) String() string {
+	if ov.field.IsNil() {
+		return ""
+	}
+	return ov.Value.String()
+}
+
+func (ov *optionalValue) Set(s string) error {
+	if err := ov.Value.Set(s); err != nil {
+		return err
+	}
+	ov.field.Set(ov.scratch)
+	return nil
+}
+
+// declareOptional declares the flag for the pointer field (see typeIsOptional)
+// just like it'd be declared for T (with all the tags applied), except that the
+// flag sets the field via optionalValue.
+func (opt *option) declareOptional() {
+	if _, ok := opt.defaultValue(); ok {
+		// The field would just be nil unless set, so the default is moot.
+		ergo.Panicf("default on pointer: %v", opt.name)
+	}
+	assert.Truef(!opt.negatable(), "negatable on pointer: %v", opt.name)
+	assert.Truef(!opt.stdin(), "stdin on pointer: %v", opt.name)
+	var (
+		field   = reflect.NewAt(opt.t, opt.p).Elem()
+		scratch = reflect.New(opt.t.Elem())
+		elem    = *opt
+	)
+	// Declare the flag for T on a throwaway flag set first, to then move it
+	// over (along with its annotations etc.) with the value wrapped.
+	elem.fset = pflag.NewFlagSet("", pflag.ContinueOnError)
+	elem.t, elem.p = opt.t.Elem(), scratch.UnsafePointer()
+	assert.Truef(elem.declare(), "not declared: %v", opt.name)
+	f := elem.fset.Lookup(opt.name)
+	f.Value = &optionalValue{f.Value, field, scratch}
+	opt.fset.AddFlag(f)
+}
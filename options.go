@@ -1,8 +1,11 @@
 package climate
 
 import (
+	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/avamsi/ergo"
@@ -42,11 +45,135 @@ func (ts tags) defaultValue() (string, bool) {
 	return v, ok
 }
 
+func (ts tags) env() (string, bool) {
+	v, ok := ts.m["env"]
+	return v, ok
+}
+
+// enum returns the allowed values (separated by "|" as "," is already used to
+// separate the subfield tags themselves) declared via the enum tag, if any.
+func (ts tags) enum() []string {
+	v, ok := ts.m["enum"]
+	if !ok {
+		return nil
+	}
+	return strings.Split(v, "|")
+}
+
+func (ts tags) hidden() bool {
+	_, ok := ts.m["hidden"]
+	return ok
+}
+
+func (ts tags) deprecated() (string, bool) {
+	v, ok := ts.m["deprecated"]
+	return v, ok
+}
+
+func (ts tags) arg() bool {
+	_, ok := ts.m["arg"]
+	return ok
+}
+
+// delim returns the delimiter declared via the delim tag (if any) to be used
+// to split slice and map flag values (instead of parsing them as CSV).
+func (ts tags) delim() (string, bool) {
+	v, ok := ts.m["delim"]
+	return v, ok && v != ""
+}
+
+func (ts tags) count() bool {
+	_, ok := ts.m["count"]
+	return ok
+}
+
+func (ts tags) local() bool {
+	_, ok := ts.m["local"]
+	return ok
+}
+
+// complete returns the kind (file or dir) and extensions (separated by "|" just
+// like enum) of the completions declared via the complete tag, if any.
+func (ts tags) complete() (string, []string, bool) {
+	v, ok := ts.m["complete"]
+	if !ok {
+		return "", nil, false
+	}
+	kind, exts, _ := strings.Cut(v, ":")
+	if exts == "" {
+		return kind, nil, true
+	}
+	return kind, strings.Split(exts, "|"), true
+}
+
+// layout returns the time.Time layout declared via the layout tag (RFC 3339 by
+// default), which is used to parse (and print) time.Time flag values.
+func (ts tags) layout() string {
+	if v, ok := ts.m["layout"]; ok && v != "" {
+		return v
+	}
+	return time.RFC3339
+}
+
+// flagName returns the flag name declared via the name tag, if any (which is
+// used as is, instead of being derived from the field name).
+func (ts tags) flagName() (string, bool) {
+	v, ok := ts.m["name"]
+	return v, ok
+}
+
+// prefix returns the prefix declared via the prefix tag (if any) for the flags
+// of a nested struct field (which may be empty, to not prefix them at all).
+func (ts tags) prefix() (string, bool) {
+	v, ok := ts.m["prefix"]
+	return v, ok
+}
+
+// negatable returns whether the (bool) flag is declared negatable via the
+// negatable tag, i.e., also settable to false via --no-X (see declareNegation).
+func (ts tags) negatable() bool {
+	_, ok := ts.m["negatable"]
+	return ok
+}
+
+// explicit returns whether the (bool) flag is declared to require an explicit
+// value via the explicit tag, i.e., --X=true or --X=false (but not bare --X).
+func (ts tags) explicit() bool {
+	_, ok := ts.m["explicit"]
+	return ok
+}
+
+// stdin returns whether the (string, []byte or io.Reader) field is declared to
+// be populated from a file or stdin via the stdin tag (see applyStdin).
+func (ts tags) stdin() bool {
+	_, ok := ts.m["stdin"]
+	return ok
+}
+
+// section returns the section declared via the section tag (if any), to group
+// the flag under in help and docs (see flagSections).
+func (ts tags) section() (string, bool) {
+	v, ok := ts.m["section"]
+	return v, ok && v != ""
+}
+
 func (ts tags) required() bool {
 	_, ok := ts.m["required"]
 	return ok
 }
 
+// preferredName returns the name given by the first of the preferred tags (like
+// `yaml:"name,omitempty"`) with one (i.e., ignoring "-" and empty names).
+func preferredName(st reflect.StructTag, preference []string) (string, bool) {
+	for _, key := range preference {
+		name, _, _ := strings.Cut(st.Get(key), ",")
+		if name != "" && name != "-" {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 type option struct {
 	fset *pflag.FlagSet
 	t    reflect.Type
@@ -54,36 +181,184 @@ type option struct {
 	name string
 	tags
 	usage string
+	// descriptions is the descriptions of the values of an enum type, if any
+	// (see internal.Metadata.Constants).
+	descriptions map[string]string
+}
+
+func (opt *option) short() string {
+	v, ok := opt.shorthand()
+	if ok && v == "" {
+		v = strings.ToLower(opt.name[:1])
+	}
+	return v
 }
 
 const nonZeroDefault = "climate_annotation_non_zero_default"
 
+// stringerDefault holds the default value of the flag as rendered by its (field)
+// type's String method, to show in help instead of the flag's own rendering.
+const stringerDefault = "climate_annotation_stringer_default"
+
+// defaultText returns the default value of the flag to show in help (if any),
+// preferring the Stringer rendering (see setStringerDefault).
+func defaultText(f *pflag.Flag) (string, bool) {
+	if vs := f.Annotations[stringerDefault]; len(vs) == 1 {
+		return vs[0], true
+	}
+	if _, ok := f.Annotations[nonZeroDefault]; ok {
+		return f.DefValue, true
+	}
+	return "", false
+}
+
+// setStringerDefault records the String() of the default value of the field if
+// its type implements fmt.Stringer, so that the likes of file modes show up in
+// help as such (0644, rather than 420) -- but only if the flag accepts it back
+// (i.e., setting the flag to it results in the same value), so that help never
+// shows a default that can't be passed (like the names of "enum" ints, which
+// are shown as numbers still). Like other defaults, zero values aren't shown
+// (see nonZeroDefault). This is only done for the types declared as flags by
+// their kind, as the special types (time.Duration, TextUnmarshalers etc.) are
+// already rendered by their flags as they should be.
+func (opt *option) setStringerDefault() {
+	if _, ok := opt.defaultValue(); !ok {
+		return
+	}
+	_, registered := flagTypes[opt.t]
+	if registered || opt.t == durationType || opt.t == timeType || opt.t == byteSizeType ||
+		typeIsTextUnmarshaler(opt.t) || !typeIsScalar(opt.t) {
+		return
+	}
+	field := reflect.NewAt(opt.t, opt.p)
+	s, ok := field.Interface().(fmt.Stringer)
+	if !ok {
+		return
+	}
+	var (
+		v     = s.String()
+		f     = opt.fset.Lookup(opt.name)
+		saved = reflect.New(opt.t).Elem()
+	)
+	saved.Set(field.Elem())
+	accepted := f.Value.Set(v) == nil && field.Elem().Equal(saved)
+	field.Elem().Set(saved)
+	if accepted && v != f.DefValue {
+		assert.Nil(opt.fset.SetAnnotation(opt.name, stringerDefault, []string{v}))
+	}
+}
+
+// registerStringerCompletions registers completions (of the default value) for
+// the flags with Stringer defaults (see setStringerDefault), as the default is
+// otherwise not obvious when completing the value (it's not the numeric one).
+func registerStringerCompletions(cmd *cobra.Command) {
+	visitFlags(cmd, func(c *cobra.Command, f *pflag.Flag) {
+		vs := f.Annotations[stringerDefault]
+		if len(vs) != 1 {
+			return
+		}
+		if _, ok := c.GetFlagCompletionFunc(f.Name); ok {
+			return // already registered (via WithCompletion)
+		}
+		complete := func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completeEnum(vs, []string{"default"}, toComplete), cobra.ShellCompDirectiveNoFileComp
+		}
+		assert.Nil(c.RegisterFlagCompletionFunc(f.Name, complete))
+	})
+}
+
 func declareOption[T any](flagVarP flagTypeVarP[T], opt *option, typer typeParser[T]) {
 	var (
 		p     = (*T)(opt.p)
 		value T
 	)
 	if v, ok := opt.defaultValue(); ok {
+		// A required flag can never fall back to its default value.
+		if opt.required() {
+			ergo.Panicf("both required and default: %v", opt.name)
+		}
 		value = typer(v)
 		defer func() {
 			assert.Nil(opt.fset.SetAnnotation(opt.name, nonZeroDefault, nil))
 		}()
 	}
 	assert.Truef(utf8string.NewString(opt.name).IsASCII(), "not ASCII: %v", opt.name)
-	var shorthand string
-	if v, ok := opt.shorthand(); ok {
-		if v == "" {
-			v = strings.ToLower(opt.name[:1])
+	flagVarP(p, opt.name, opt.short(), value, opt.usage)
+	if opt.hidden() {
+		assert.Nil(opt.fset.MarkHidden(opt.name))
+	}
+	if v, ok := opt.deprecated(); ok {
+		// Note: this also hides the flag from help (but it still works).
+		assert.Nil(opt.fset.MarkDeprecated(opt.name, v))
+	}
+	if v, ok := opt.env(); ok {
+		assert.Nil(opt.fset.SetAnnotation(opt.name, envAnnotation, []string{v}))
+	}
+	if v, ok := opt.section(); ok {
+		assert.Nil(opt.fset.SetAnnotation(opt.name, sectionAnnotation, []string{v}))
+	}
+	for kind, annotation := range groupAnnotations {
+		if groups := opt.flagGroups(kind); groups != nil {
+			assert.Nil(opt.fset.SetAnnotation(opt.name, annotation, groups))
+		}
+	}
+	if names := opt.requires(); names != nil {
+		assert.Nil(opt.fset.SetAnnotation(opt.name, requiresAnnotation, names))
+	}
+	if kind, exts, ok := opt.complete(); ok {
+		if t := opt.t; t.Kind() != reflect.String && (t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.String) {
+			ergo.Panicf("complete on non string | []string: %v", opt.name)
+		}
+		switch kind {
+		case "file":
+			assert.Nil(cobra.MarkFlagFilename(opt.fset, opt.name, exts...))
+		case "dir":
+			assert.Truef(exts == nil, "complete=dir with extensions: %v", opt.name)
+			assert.Nil(cobra.MarkFlagDirname(opt.fset, opt.name))
+		default:
+			ergo.Panicf("not complete=file | complete=dir: %v", opt.name)
 		}
-		shorthand = v
 	}
-	flagVarP(p, opt.name, shorthand, value, opt.usage)
 	if opt.required() {
 		assert.Nil(cobra.MarkFlagRequired(opt.fset, opt.name))
 	}
 }
 
 func (opt *option) declare() bool {
+	if typeIsOptional(opt.t) {
+		opt.declareOptional()
+		return true
+	}
+	assert.Truef(!opt.negatable() || opt.t.Kind() == reflect.Bool, "negatable on non bool: %v", opt.name)
+	assert.Truef(!opt.explicit() || opt.t.Kind() == reflect.Bool, "explicit on non bool: %v", opt.name)
+	if opt.stdin() {
+		target := reflect.NewAt(opt.t, opt.p).Elem()
+		declareOption(stdinVarP(opt.fset, opt.t, target), opt, parseString)
+		return true
+	}
+	if newValue, ok := flagTypes[opt.t]; ok {
+		declareOption(valueVarP(opt.fset, newValue, opt.p), opt, parseString)
+		return true
+	}
+	switch opt.t {
+	case durationType:
+		declareOption(opt.fset.DurationVarP, opt, parseDuration)
+		return true
+	case timeType:
+		layout := opt.layout()
+		declareOption(timeVarP(opt.fset, layout), opt, timeParser(layout))
+		return true
+	case byteSizeType:
+		declareOption(byteSizeVarP(opt.fset), opt, parseByteSize)
+		return true
+	}
+	// Note: this needs to happen after the special types above (time.Time is a
+	// TextUnmarshaler too, for example) but before the kinds below (so that the
+	// likes of net.IP, which is a []byte, work as expected).
+	if typeIsTextUnmarshaler(opt.t) {
+		declareOption(valueVarP(opt.fset, newTextValue(opt.t), opt.p), opt, parseString)
+		return true
+	}
 	switch k := opt.t.Kind(); k {
 	case reflect.Bool:
 		declareOption(
@@ -91,7 +366,20 @@ func (opt *option) declare() bool {
 			opt,
 			parseBool,
 		)
+		if opt.explicit() {
+			// pflag lets bare --X mean --X=true via NoOptDefVal, so unset it.
+			opt.fset.Lookup(opt.name).NoOptDefVal = ""
+		}
+		if opt.negatable() {
+			declareNegation(opt.fset, opt.name, (*bool)(opt.p))
+		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if opt.count() {
+			assert.Truef(k == reflect.Int, "count on non int: %v", opt.name)
+			declareOption(countVarP(opt.fset), opt, parseInt)
+			assert.Nil(opt.fset.SetAnnotation(opt.name, repeatable, nil))
+			break
+		}
 		declareOption(
 			opt.fset.Int64VarP,
 			opt,
@@ -110,6 +398,21 @@ func (opt *option) declare() bool {
 			parseFloat64,
 		)
 	case reflect.String:
+		values := opt.enum()
+		if values == nil {
+			values = enumValues(opt.t)
+		}
+		if values != nil {
+			declareOption(
+				enumVarP(opt.fset, values),
+				opt,
+				parseString,
+			)
+			if opt.descriptions != nil {
+				setEnumDescriptions(opt.fset, opt.name, values, opt.descriptions)
+			}
+			break
+		}
 		declareOption(
 			opt.fset.StringVarP,
 			opt,
@@ -118,55 +421,115 @@ func (opt *option) declare() bool {
 	case reflect.Slice:
 		switch e := opt.t.Elem(); e.Kind() {
 		case reflect.Bool:
-			declareOption(
-				opt.fset.BoolSliceVarP,
-				opt,
-				sliceParser(parseBool),
-			)
+			declareSlice(opt.fset.BoolSliceVarP, opt, parseBool)
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			declareOption(
-				opt.fset.Int64SliceVarP,
-				opt,
-				sliceParser(parseInt64),
-			)
+			declareSlice(opt.fset.Int64SliceVarP, opt, parseInt64)
 		case reflect.Float32, reflect.Float64:
-			declareOption(
-				opt.fset.Float64SliceVarP,
-				opt,
-				sliceParser(parseFloat64),
-			)
+			declareSlice(opt.fset.Float64SliceVarP, opt, parseFloat64)
 		case reflect.String:
-			declareOption(
-				opt.fset.StringSliceVarP,
-				opt,
-				sliceParser(parseString),
-			)
+			declareSlice(opt.fset.StringSliceVarP, opt, parseString)
 		default:
 			ergo.Panicf("not []bool | []Signed | []Float | []string: %v", e)
 		}
+	case reflect.Map:
+		if k, e := opt.t.Key(), opt.t.Elem(); k.Kind() != reflect.String || e.Kind() != reflect.String {
+			ergo.Panicf("not map[string]string: %v", opt.t)
+		}
+		if delim, ok := opt.delim(); ok {
+			declareOption(delimMapVarP(opt.fset, delim), opt, delimMapParser(delim))
+		} else {
+			declareOption(opt.fset.StringToStringVarP, opt, mapParser)
+		}
+		assert.Nil(opt.fset.SetAnnotation(opt.name, repeatable, nil))
 	default:
 		if typeIsStructPointer(opt.t) {
 			return false
 		}
-		ergo.Panicf("not bool | Integer | Float | string | []T: %v", opt.t)
+		ergo.Panicf("not bool | Integer | Float | string | []T | map[string]string: %v", opt.t)
 	}
 	return true
 }
 
+const repeatable = "climate_annotation_repeatable"
+
+func countVarP(fset *pflag.FlagSet) flagTypeVarP[int] {
+	return func(p *int, name, shorthand string, value int, usage string) {
+		fset.CountVarP(p, name, shorthand, usage)
+		// CountVarP always starts from 0, so (re)set the default ourselves (each
+		// occurrence of the flag then increments from there).
+		*p = value
+		fset.Lookup(name).DefValue = strconv.Itoa(value)
+	}
+}
+
+func declareSlice[E any](flagVarP flagTypeVarP[[]E], opt *option, typer typeParser[E]) {
+	if delim, ok := opt.delim(); ok {
+		declareOption(delimSliceVarP[E](opt.fset, delim), opt, delimSliceParser[E](delim))
+	} else {
+		declareOption(flagVarP, opt, sliceParser(typer))
+	}
+	assert.Nil(opt.fset.SetAnnotation(opt.name, repeatable, nil))
+}
+
+// typeIsNestable returns whether fields of the given type are nested structs
+// (to be flattened, see declareFields) rather than flags of their own.
+func typeIsNestable(t reflect.Type) bool {
+	if _, ok := flagTypes[t]; ok {
+		return false
+	}
+	return t.Kind() == reflect.Struct && t != timeType && !typeIsTextUnmarshaler(t)
+}
+
 type options struct {
 	reflection
 	parent *reflection
 	fset   *pflag.FlagSet
-	md     *internal.Metadata
+	// lfset is where fields tagged with local are declared (if different from
+	// fset, which is the case for struct commands that declare persistent flags).
+	lfset *pflag.FlagSet
+	md    *internal.Metadata
+	// tagPreference is the struct tags (in order) to derive the flag names
+	// from (see WithTagPreference).
+	tagPreference []string
+	trace         *tracer
+	positionals   []positional
+	// fields is where the fields the flags are bound to are recorded (see
+	// flagValue).
+	fields map[*pflag.Flag]reflect.Value
 }
 
 func (opts *options) declare() {
+	opts.declareFields(*opts.v(), opts.md, nesting{}, map[string]string{})
+}
+
+// nesting is the context (accumulated so far) a nested struct field is declared
+// in, i.e., the prefix for its flags, the path of the fields leading up to it,
+// whether it's (transitively) tagged with local and the section (if any) its
+// flags go under by default.
+type nesting struct {
+	prefix, path string
+	local        bool
+	section      string
+}
+
+// declareFields declares the fields of the given struct value as flags (or as
+// positional args), recursing into the nested struct fields (see prefix).
+func (opts *options) declareFields(sv reflect.Value, smd *internal.Metadata, n nesting, shorthands map[string]string) {
 	parentSet := (opts.parent == nil)
-	for i := 0; i < opts.t().NumField(); i++ {
+	for i := 0; i < sv.NumField(); i++ {
 		var (
-			f  = opts.t().Field(i)
-			md = opts.md.Child(f.Name)
+			f    = sv.Type().Field(i)
+			md   = smd.Child(f.Name)
+			path = n.path + f.Name
 		)
+		// Note: this needs to happen after looking up the metadata, so that the
+		// metadata of the skipped fields is not reported as stale.
+		if f.Tag.Get("cli") == "-" {
+			if opts.trace != nil {
+				opts.trace.printf("field %v.%v -> skipped (cli:\"-\")", opts.t(), path)
+			}
+			continue
+		}
 		// Long() returns the "Doc" part of the field and Short() returns the
 		// "Comment" part. Other Metadata is neither collected, nor used.
 		usage := md.Long()
@@ -174,7 +537,7 @@ func (opts *options) declare() {
 			usage = md.Short()
 		}
 		var (
-			v   = opts.v().Field(i)
+			v   = sv.Field(i)
 			opt = option{
 				fset:  opts.fset,
 				t:     f.Type,
@@ -184,19 +547,84 @@ func (opts *options) declare() {
 				usage: usage,
 			}
 		)
-		if !opt.declare() {
-			if opts.parent == nil {
-				ergo.Panicf("not bool | Integer | Float | string | []T: %v", f.Type)
+		if enumValues(f.Type) != nil {
+			opt.descriptions = smd.Constants(f.Type)
+		}
+		if name, ok := opt.flagName(); ok {
+			assert.Truef(name != "", "empty name: %v", f.Name)
+			opt.name = name
+		} else if name, ok := preferredName(f.Tag, opts.tagPreference); ok {
+			opt.name = name
+		}
+		if typeIsNestable(f.Type) {
+			prefix, ok := opt.prefix()
+			if !ok && !f.Anonymous {
+				prefix = opt.name
+			}
+			if n.prefix != "" && prefix != "" {
+				prefix = n.prefix + "-" + prefix
+			} else if prefix == "" {
+				prefix = n.prefix
+			}
+			// Note: the docs of the nested fields come from the nested struct
+			// type (the doc of the nested struct field itself is not used).
+			section, ok := opt.section()
+			if !ok {
+				section = n.section
 			}
-			if f.Type != opts.parent.ptr.t() {
-				ergo.Panicf(
-					"not bool | Integer | Float | string | []T | %v: %v",
-					opts.parent.t(), f.Type)
+			nested := nesting{prefix, path + ".", n.local || opt.local(), section}
+			if opts.trace != nil {
+				opts.trace.printf("field %v.%v -> nested (prefix %q)", opts.t(), path, prefix)
 			}
-			if parentSet {
-				ergo.Panicf("more than one parent: %v", f.Type)
+			opts.declareFields(v, smd.LookupType(f.Type), nested, shorthands)
+			continue
+		}
+		if n.prefix != "" {
+			// Derive the shorthand (if any) from the unprefixed name.
+			if short := opt.short(); short != "" {
+				opt.m["short"] = short
+			}
+			opt.name = n.prefix + "-" + opt.name
+		}
+		if _, ok := opt.section(); !ok && n.section != "" {
+			opt.m["section"] = n.section
+		}
+		if opt.arg() {
+			opts.positionals = append(opts.positionals, newPositional(opt.name, usage, v, smd))
+			if opts.trace != nil {
+				opts.trace.printf("field %v.%v -> positional <%v>", opts.t(), path, internal.NormalizeToKebabCase(opt.name))
 			}
-			v.Set(*opts.parent.ptr.v())
+			continue
+		}
+		if (n.local || opt.local()) && opts.lfset != nil {
+			opt.fset = opts.lfset
+		}
+		if short := opt.short(); short != "" {
+			if other, ok := shorthands[short]; ok {
+				ergo.Panicf("same shorthand -%v for both %v and %v: %v",
+					short, other, path, opts.t())
+			}
+			shorthands[short] = path
+		}
+		if opt.declare() {
+			opts.fields[opt.fset.Lookup(opt.name)] = v
+			opt.setStringerDefault()
+			if opts.trace != nil {
+				opts.trace.printf("field %v.%v -> flag --%v", opts.t(), path, internal.NormalizeToKebabCase(opt.name))
+			}
+			continue
+		}
+		if opts.parent == nil {
+			ergo.Panicf("not bool | Integer | Float | string | []T | map[string]string: %v", f.Type)
+		}
+		if f.Type != opts.parent.ptr.t() {
+			ergo.Panicf(
+				"not bool | Integer | Float | string | []T | map[string]string | %v: %v",
+				opts.parent.t(), f.Type)
+		}
+		if parentSet {
+			ergo.Panicf("more than one parent: %v", f.Type)
 		}
+		v.Set(*opts.parent.ptr.v())
 	}
 }
@@ -0,0 +1,51 @@
+package climate
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/avamsi/ergo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// outputFlag is the flag declared on commands whose func / method returns a
+// value, to choose how the value is printed (see printOutput).
+const outputFlag = "output"
+
+func declareOutputFlag(fset *pflag.FlagSet, t reflect.Type) {
+	if fset.Lookup(outputFlag) != nil {
+		ergo.Panicf("--%v already declared for func returning a value: %v", outputFlag, t)
+	}
+	var format string
+	enumVarP(fset, []string{"text", "json", "yaml"})(
+		&format, outputFlag, "", "text", "format of the output")
+}
+
+// printOutput prints the value returned by the func / method of cmd to its
+// output, as per --output: with fmt.Println (so Stringers print as such) for
+// text and marshalled (indented by two spaces) otherwise.
+func printOutput(cmd *cobra.Command, v reflect.Value) error {
+	var (
+		w      = cmd.OutOrStdout()
+		format = cmd.Flags().Lookup(outputFlag).Value.String()
+	)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v.Interface())
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v.Interface()); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		_, err := fmt.Fprintln(w, v.Interface())
+		return err
+	}
+}
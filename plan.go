@@ -1,18 +1,23 @@
 package climate
 
 import (
-	"context"
 	"runtime"
+	"slices"
 	"strings"
 
+	"github.com/avamsi/ergo"
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+
 	"github.com/avamsi/climate/internal"
 )
 
 type funcPlan struct {
 	reflection
+	opts internal.CommandOptions
 }
 
-func (fp *funcPlan) Execute(ctx context.Context, md *internal.Metadata) error {
+func (fp *funcPlan) Build(md *internal.Metadata, opts *internal.RunOptions) *cobra.Command {
 	var (
 		name = runtime.FuncForPC(fp.v().Pointer()).Name()
 		dot  = strings.LastIndex(name, ".")
@@ -22,30 +27,73 @@ func (fp *funcPlan) Execute(ctx context.Context, md *internal.Metadata) error {
 		name,
 		fp.reflection,
 		md.Lookup(pkgPath, name),
+		&fp.opts,
+		opts.TagPreference,
+		newTracer(opts),
+		opts.Fields,
+		opts.Args,
+	}
+	if fcb.trace != nil {
+		fcb.trace.traceCommand("func "+pkgPath+"."+name, name, fcb.md)
 	}
-	cmd := fcb.build()
-	return cmd.run(ctx)
+	return fcb.build().delegate
 }
 
 type structPlan struct {
 	reflection
 	subcommands []*structPlan
+	// owner is the plan this plan is a subcommand of (if any), as each plan may
+	// only be added to a single parent (see Tree).
+	owner *structPlan
+	// methods is the command options of the methods (by name), see Method.
+	methods map[string]*internal.CommandOptions
 }
 
-func (sp *structPlan) buildRecursive(parent *reflection, md *internal.Metadata) *command {
+func (sp *structPlan) addSubcommand(sub *structPlan) {
+	assert.Truef(sub != sp, "plan added to itself: %v", sp.t())
+	switch sub.owner {
+	case nil:
+	case sp:
+		ergo.Panicf("plan added more than once: %v", sub.t())
+	default:
+		ergo.Panicf("plan added to more than one parent: %v (%v and %v)",
+			sub.t(), sub.owner.t(), sp.t())
+	}
+	sub.owner = sp
+	sp.subcommands = append(sp.subcommands, sub)
+}
+
+// buildRecursive builds the command for the plan and (recursively) all of its
+// subcommands, with path being the plans leading up to it (to detect cycles).
+func (sp *structPlan) buildRecursive(parent *reflection, path []*structPlan, md *internal.Metadata, opts *internal.RunOptions, trace *tracer) *command {
+	if slices.Contains(path, sp) {
+		var names []string
+		for _, p := range append(path, sp) {
+			names = append(names, p.t().String())
+		}
+		ergo.Panicf("cycle in plans: %v", strings.Join(names, " -> "))
+	}
+	path = append(path, sp)
 	scb := &structCommandBuilder{
 		sp.reflection,
 		parent,
 		md.LookupType(sp.t()),
+		sp.methods,
+		opts.TagPreference,
+		trace,
+		opts.Fields,
+		opts.Args,
+	}
+	if trace != nil {
+		trace.traceCommand("struct "+sp.t().String(), sp.t().Name(), scb.md)
 	}
 	cmd := scb.build()
 	for _, sub := range sp.subcommands {
-		cmd.addCommand(sub.buildRecursive(&sp.reflection, md))
+		cmd.addCommand(sub.buildRecursive(&sp.reflection, path, md, opts, trace))
 	}
 	return cmd
 }
 
-func (sp *structPlan) Execute(ctx context.Context, m *internal.Metadata) error {
-	root := sp.buildRecursive(nil, m) // no parent
-	return root.run(ctx)
+func (sp *structPlan) Build(md *internal.Metadata, opts *internal.RunOptions) *cobra.Command {
+	return sp.buildRecursive(nil, nil, md, opts, newTracer(opts)).delegate // no parent
 }
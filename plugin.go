@@ -0,0 +1,150 @@
+package climate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithPluginPrefix returns a modifier that makes Run dispatch unknown top-level
+// subcommands to the executables with the given prefix on PATH, like git and
+// kubectl do -- with WithPluginPrefix("myapp-"), "myapp foo --bar" runs
+// "myapp-foo --bar" (if foo is not a subcommand of myapp already, as they take
+// precedence), with the same stdin, stdout and stderr (see WithInput etc.), and
+// Run returns its exit code. The plugins found on PATH are also listed in the
+// root's --help. This only applies to trees (i.e., Struct plans), as the args
+// to single commands are never subcommands.
+//
+// Only the first arg is considered, so "myapp --verbose foo" is not dispatched
+// (as it's unknown what --verbose expects) and is treated as usual instead --
+// the flags for the plugin go after its name, "myapp foo --verbose".
+//
+// The signals caught by Run (see WithSignals) are forwarded to the plugin, which
+// is killed only if it doesn't exit within 10 seconds of the signal.
+func WithPluginPrefix(prefix string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.PluginPrefix = prefix
+	}
+}
+
+// pluginPrefixAnnotation is set on the root command (with WithPluginPrefix),
+// holding the plugin prefix (for listing the plugins in its --help).
+const pluginPrefixAnnotation = "climate_annotation_plugin_prefix"
+
+// isBuiltin returns whether name is the name (or an alias) of a subcommand of
+// root, including the ones Cobra adds by itself (help, completion etc.).
+func isBuiltin(root *cobra.Command, name string) bool {
+	if name == cobra.ShellCompRequestCmd || name == cobra.ShellCompNoDescRequestCmd {
+		return true
+	}
+	// Cobra only adds these lazily (on execute), so add them now to make sure
+	// that Find can find them.
+	root.InitDefaultHelpCmd()
+	root.InitDefaultCompletionCmd()
+	c, _, err := root.Find([]string{name})
+	return err == nil && c != root
+}
+
+// findPlugin returns the path to the plugin the given args resolve to, if any.
+func findPlugin(root *cobra.Command, prefix string, args []string) (string, bool) {
+	if !root.HasSubCommands() || len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", false
+	}
+	if isBuiltin(root, args[0]) {
+		return "", false
+	}
+	path, err := exec.LookPath(prefix + args[0])
+	return path, err == nil
+}
+
+// pluginWaitDelay is how long a plugin is given to exit after being signalled
+// (see WithPluginPrefix), before it's killed.
+const pluginWaitDelay = 10 * time.Second
+
+// runPlugin runs the plugin at the given path with the given args, returning
+// its exit code (and a RuntimeError wrapping the *exec.ExitError, if it fails).
+// The signal returned by signalled (if any) is forwarded to the plugin when ctx
+// is done.
+func runPlugin(ctx context.Context, path string, args []string, signalled func() os.Signal, opts *internal.RunOptions) (int, error) {
+	var (
+		stdin          io.Reader = os.Stdin
+		stdout, stderr io.Writer = os.Stdout, os.Stderr
+	)
+	if opts.Input != nil {
+		stdin = opts.Input
+	}
+	if opts.Output != nil {
+		stdout = opts.Output
+	}
+	if opts.Error != nil {
+		stderr = opts.Error
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	cmd.Cancel = func() error {
+		if sig := signalled(); sig != nil {
+			return cmd.Process.Signal(sig)
+		}
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = pluginWaitDelay
+	if err := cmd.Run(); err != nil {
+		err = &RuntimeError{err}
+		// The plugin already reported its own errors (if it ran at all).
+		if eerr := new(exec.ExitError); !errors.As(err, &eerr) {
+			printRunError(opts, err)
+		}
+		return exitCode(err), err
+	}
+	return 0, nil
+}
+
+// plugins returns the names of the plugins (with the given prefix) on PATH, in
+// order, excluding the ones shadowed by the subcommands of root.
+func plugins(root *cobra.Command, prefix string) []string {
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := strings.CutPrefix(e.Name(), prefix)
+			if !ok || name == "" || slices.Contains(names, name) {
+				continue
+			}
+			if _, err := exec.LookPath(filepath.Join(dir, e.Name())); err != nil {
+				continue // not an executable
+			}
+			if !isBuiltin(root, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// pluginsHelp returns the "Plugins:" help section for the given command, if it's
+// the root command of a CLI with plugins (see WithPluginPrefix).
+func pluginsHelp(cmd *cobra.Command) string {
+	prefix, ok := cmd.Annotations[pluginPrefixAnnotation]
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	for _, name := range plugins(cmd, prefix) {
+		fmt.Fprintf(&b, "  %v\n", name)
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package climate
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/avamsi/ergo"
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// positional is an opts struct field (tagged with "arg") that's populated from
+// a positional arg (or all the remaining positional args, if it's a slice).
+type positional struct {
+	name, usage string
+	v           reflect.Value
+	// values (and their descriptions) are the allowed values of an enum type
+	// (or of the elements of a slice of an enum type), if any.
+	values, descriptions []string
+}
+
+func newPositional(name, usage string, v reflect.Value, smd *internal.Metadata) positional {
+	t := v.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	p := positional{name: name, usage: usage, v: v}
+	if p.values = enumValues(t); p.values != nil {
+		p.descriptions = alignDescriptions(p.values, smd.Constants(t))
+	}
+	return p
+}
+
+func typeIsScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func validatePositionals(ps []positional) {
+	for i, p := range ps {
+		t := p.v.Type()
+		if typeIsScalar(t) {
+			continue
+		}
+		if t.Kind() == reflect.Slice && typeIsScalar(t.Elem()) {
+			if i == len(ps)-1 {
+				continue
+			}
+			ergo.Panicf("not the last positional: %v", p.name)
+		}
+		ergo.Panicf("not bool | Integer | Float | string | []T: %v", t)
+	}
+}
+
+func positionalsBounds(ps []positional) *internal.ArgsBounds {
+	n := len(ps)
+	if n > 0 && ps[n-1].v.Kind() == reflect.Slice {
+		return &internal.ArgsBounds{Min: n - 1, Max: -1}
+	}
+	return &internal.ArgsBounds{Min: n, Max: n}
+}
+
+func positionalsUsage(ps []positional) string {
+	var (
+		names = make([]string, len(ps))
+		types = make([]internal.ParamType, len(ps))
+	)
+	for i, p := range ps {
+		names[i] = p.name
+		types[i] = internal.RequiredParam
+		if p.v.Kind() == reflect.Slice {
+			types[i] = internal.ArbitraryLengthParam
+		}
+	}
+	return internal.ParamsUsage(names, types, nil)
+}
+
+// argsAnnotation is set on commands with documented positionals, holding their
+// (rendered) "Arguments:" help section.
+const argsAnnotation = "climate_annotation_args"
+
+// positionalsHelp returns the "Arguments:" help section for the positionals
+// (aligned as a table, like the flags), if any of them is documented at all.
+func positionalsHelp(ps []positional) string {
+	var (
+		documented bool
+		width      int
+	)
+	for _, p := range ps {
+		documented = documented || p.usage != ""
+		width = max(width, len(internal.NormalizeToKebabCase(p.name)))
+	}
+	if !documented {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range ps {
+		line := fmt.Sprintf("  %-*v  %v", width, internal.NormalizeToKebabCase(p.name), p.usage)
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// completePositionals returns a ValidArgsFunction that completes the values of
+// the enum positionals (by position) or nil, if there are no such positionals.
+func completePositionals(ps []positional) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	if !slices.ContainsFunc(ps, func(p positional) bool { return p.values != nil }) {
+		return nil
+	}
+	return func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		i := len(args)
+		if n := len(ps); i >= n && ps[n-1].v.Kind() == reflect.Slice {
+			i = n - 1
+		}
+		if i >= len(ps) || ps[i].values == nil {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return completeEnum(ps[i].values, ps[i].descriptions, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// setScalarPositional is setScalar, except that it also validates the values of
+// the enum positionals.
+func setScalarPositional(p positional, v reflect.Value, s string) error {
+	if p.values != nil && !slices.Contains(p.values, s) {
+		return fmt.Errorf("must be one of %v", strings.Join(p.values, ", "))
+	}
+	return setScalar(v, s)
+}
+
+// setPositionals sets the positionals from the given args (which are expected to
+// be already validated against positionalsBounds).
+func setPositionals(ps []positional, args []string) error {
+	for i, p := range ps {
+		if p.v.Kind() != reflect.Slice {
+			if err := setScalarPositional(p, p.v, args[i]); err != nil {
+				return fmt.Errorf("invalid argument %q for <%v>: %w",
+					args[i], internal.NormalizeToKebabCase(p.name), err)
+			}
+			continue
+		}
+		rest := args[i:]
+		s := reflect.MakeSlice(p.v.Type(), len(rest), len(rest))
+		for j, arg := range rest {
+			if err := setScalarPositional(p, s.Index(j), arg); err != nil {
+				return fmt.Errorf("invalid argument %q for <%v>: %w",
+					arg, internal.NormalizeToKebabCase(p.name), err)
+			}
+		}
+		p.v.Set(s)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package climate
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithRecover returns a modifier that makes Run recover from panics in the func
+// / method being run, failing with the panic as the error (and exit code 1,
+// like any other error) instead of crashing. The stack trace of the panic is
+// printed as well if the (hidden) --stack-trace flag is set.
+//
+// Note: panics while building the commands (i.e., programmer errors like
+// malformed struct tags) are not recovered from.
+func WithRecover() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Recover = true
+	}
+}
+
+const stackTraceFlag = "stack-trace"
+
+func declareStackTraceFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool(stackTraceFlag, false, "print the stack trace of panics")
+	assert.Nil(cmd.PersistentFlags().MarkHidden(stackTraceFlag))
+}
+
+// wrapRecover wraps the RunE of cmd and all of its subcommands to recover from
+// panics (see WithRecover).
+func wrapRecover(cmd *cobra.Command) {
+	wrapRunE(cmd, func(runE runFunc) runFunc {
+		return func(c *cobra.Command, args []string) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				if assert.Ok(c.Flags().GetBool(stackTraceFlag)) {
+					fmt.Fprintf(c.ErrOrStderr(), "panic: %v\n\n%s\n", r, debug.Stack())
+				}
+				err = runtimeError(c, fmt.Errorf("panic: %v", r))
+			}()
+			return runE(c, args)
+		}
+	})
+}
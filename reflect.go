@@ -2,6 +2,7 @@ package climate
 
 import (
 	"context"
+	"io"
 	"reflect"
 )
 
@@ -11,6 +12,8 @@ func typeIsContext(t reflect.Type) bool {
 	return t.Kind() == reflect.Interface && t.Implements(contextType)
 }
 
+var writerType = reflect.TypeOf((*io.Writer)(nil)).Elem()
+
 var errorType = reflect.TypeOf((*error)(nil)).Elem()
 
 func typeIsError(t reflect.Type) bool {
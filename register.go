@@ -0,0 +1,48 @@
+package climate
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/avamsi/ergo"
+	"github.com/spf13/pflag"
+)
+
+var flagTypes = map[reflect.Type]func(unsafe.Pointer) pflag.Value{}
+
+// RegisterFlagType registers the given constructor to be used to declare the
+// flags for fields of type T (taking precedence over all the built-in handling,
+// including for TextUnmarshaler types), as an escape hatch for exotic types or
+// to override the built-in handling (a bool that also accepts yes / no, say).
+//
+//	climate.RegisterFlagType(func(p *yesNo) pflag.Value { return &yesNoValue{p} })
+//
+// The constructor is called with a pointer to the field (whose current value is
+// the zero value or the default value, if any, is Set as usual). Note: the
+// registry is global and not synchronized, so RegisterFlagType must be called
+// before Run (from an init func, say) and not concurrently.
+func RegisterFlagType[T any](newValue func(*T) pflag.Value) {
+	t := reflect.TypeFor[T]()
+	if _, ok := flagTypes[t]; ok {
+		ergo.Panicf("more than one registration for flag type: %v", t)
+	}
+	flagTypes[t] = func(p unsafe.Pointer) pflag.Value {
+		return newValue((*T)(p))
+	}
+}
+
+// valueVarP returns a flagTypeVarP that declares the field pointed to by p as a
+// flag of the pflag.Value returned by the given constructor (which Sets the
+// default value, if any). Note: it's a flagTypeVarP[string] only to pass the
+// default value through as is, the *string itself is never used.
+func valueVarP(fset *pflag.FlagSet, newValue func(unsafe.Pointer) pflag.Value, p unsafe.Pointer) flagTypeVarP[string] {
+	return func(_ *string, name, shorthand, value, usage string) {
+		v := newValue(p)
+		if value != "" {
+			if err := v.Set(value); err != nil {
+				ergo.Panicf("invalid default %q (%v): %v", value, err, name)
+			}
+		}
+		fset.VarP(v, name, shorthand, usage)
+	}
+}
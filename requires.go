@@ -0,0 +1,102 @@
+package climate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/avamsi/ergo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithRequires returns a modifier that makes Run require the given flags to be
+// set whenever the given flag is set (for any command that has it), like --cert
+// requiring --tls. Unlike WithRequiredTogether, this is one-directional (--tls
+// may still be set without --cert). It's also possible to declare this via the
+// struct tags instead, as in `cli:"requires=tls"` (or requires=tls|ca, for more
+// than one flag).
+//
+// This is checked after the flags are parsed (and applied from the environment
+// variables, config file etc.), with the violations (all of them at once) being
+// usage errors.
+func WithRequires(flag string, required ...string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		if opts.Requires == nil {
+			opts.Requires = map[string][]string{}
+		}
+		name := internal.NormalizeToKebabCase(flag)
+		for _, r := range required {
+			opts.Requires[name] = append(opts.Requires[name], internal.NormalizeToKebabCase(r))
+		}
+	}
+}
+
+// requiresAnnotation is set on the flags that require other flags, holding the
+// names of the required flags.
+const requiresAnnotation = "climate_annotation_requires"
+
+func (ts tags) requires() []string {
+	v, ok := ts.m["requires"]
+	if !ok || v == "" {
+		return nil
+	}
+	var names []string
+	for _, name := range strings.Split(v, "|") {
+		names = append(names, internal.NormalizeToKebabCase(name))
+	}
+	return names
+}
+
+// markRequires annotates the flags with the flags they require via WithRequires
+// (alongside the ones declared via the struct tags), verifying that all of the
+// flags involved exist.
+func markRequires(cmd *cobra.Command, requires map[string][]string) {
+	checked := map[string]bool{}
+	visitFlags(cmd, func(c *cobra.Command, f *pflag.Flag) {
+		for _, r := range requires[f.Name] {
+			if !slices.Contains(f.Annotations[requiresAnnotation], r) {
+				if f.Annotations == nil {
+					f.Annotations = map[string][]string{}
+				}
+				f.Annotations[requiresAnnotation] = append(f.Annotations[requiresAnnotation], r)
+			}
+		}
+		for _, r := range f.Annotations[requiresAnnotation] {
+			if c.Flag(r) == nil {
+				ergo.Panicf("--%v requires unknown flag: %v", f.Name, r)
+			}
+		}
+		checked[f.Name] = true
+	})
+	for name := range requires {
+		if !checked[name] {
+			ergo.Panicf("no flag for requires: %v", name)
+		}
+	}
+}
+
+func applyRequires(fset *pflag.FlagSet) error {
+	var errs []error
+	fset.VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		var missing []string
+		for _, r := range f.Annotations[requiresAnnotation] {
+			if rf := fset.Lookup(r); rf != nil && !rf.Changed {
+				missing = append(missing, "--"+r)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("--%v requires %v", f.Name, strings.Join(missing, ", ")))
+		}
+	})
+	if len(errs) == 0 {
+		return nil
+	}
+	return ErrUsage(errors.Join(errs...))
+}
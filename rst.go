@@ -0,0 +1,143 @@
+package climate
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// rstName is the name of the reStructuredText doc for cmd, without the .rst
+// extension (which is how the :doc: role refers to it).
+func rstName(cmd *cobra.Command) string {
+	return strings.ReplaceAll(cmd.CommandPath(), " ", "_")
+}
+
+func rstFilename(cmd *cobra.Command) string {
+	return rstName(cmd) + ".rst"
+}
+
+func rstHeading(b *bytes.Buffer, title string, underline rune) {
+	fmt.Fprintf(b, "%v\n%v\n\n", title, strings.Repeat(string(underline), utf8.RuneCountInString(title)))
+}
+
+// rstIndent indents all the (non-empty) lines of s by the given indent, as the
+// directive bodies (and literal blocks) must be.
+func rstIndent(s, indent string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func rstCodeBlock(b *bytes.Buffer, code string) {
+	fmt.Fprintf(b, ".. code-block:: text\n\n%v\n\n", rstIndent(code, "   "))
+}
+
+func rstFlags(b *bytes.Buffer, title string, fset *pflag.FlagSet) {
+	if !fset.HasAvailableFlags() {
+		return
+	}
+	rstHeading(b, title, '-')
+	ungrouped, sections, grouped := flagSections(fset)
+	rstOptions(b, ungrouped)
+	for _, s := range sections {
+		if grouped[s].HasAvailableFlags() {
+			rstHeading(b, s, '~')
+			rstOptions(b, grouped[s])
+		}
+	}
+}
+
+// rstOptions renders the flags as Sphinx option directives (which, along with
+// the program directive, make them referable via the :option: role).
+func rstOptions(b *bytes.Buffer, fset *pflag.FlagSet) {
+	fset.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		qtype, usage := unquoteUsage(f)
+		if qtype != "" {
+			qtype = " <" + qtype + ">"
+		}
+		sig := fmt.Sprintf("--%v%v", f.Name, qtype)
+		if f.Shorthand != "" {
+			sig = fmt.Sprintf("-%v%v, %v", f.Shorthand, qtype, sig)
+		}
+		fmt.Fprintf(b, ".. option:: %v\n\n", sig)
+		if usage != "" {
+			fmt.Fprintf(b, "%v\n\n", rstIndent(usage, "   "))
+		}
+		if v, ok := defaultText(f); ok {
+			fmt.Fprintf(b, "   Default: ``%v``\n\n", v)
+		}
+	})
+}
+
+func genRST(cmd *cobra.Command) []byte {
+	cmd.InitDefaultHelpFlag()
+	var b bytes.Buffer
+	rstHeading(&b, cmd.CommandPath(), '=')
+	if cmd.Short != "" {
+		fmt.Fprintf(&b, "%v\n\n", cmd.Short)
+	}
+	fmt.Fprintf(&b, ".. program:: %v\n\n", cmd.CommandPath())
+	rstHeading(&b, "Synopsis", '-')
+	if cmd.Long != "" {
+		fmt.Fprintf(&b, "%v\n\n", cmd.Long)
+	}
+	// Struct commands are only "runnable" to validate args (see validateNoArgs).
+	if cmd.HasAvailableSubCommands() {
+		rstCodeBlock(&b, cmd.CommandPath()+" [command]")
+	} else if cmd.Runnable() {
+		rstCodeBlock(&b, cmd.UseLine())
+	}
+	if cmd.Example != "" {
+		rstHeading(&b, "Examples", '-')
+		rstCodeBlock(&b, cmd.Example)
+	}
+	rstFlags(&b, "Flags", cmd.NonInheritedFlags())
+	rstFlags(&b, "Global Flags", cmd.InheritedFlags())
+	rstExitCodes(&b, cmd)
+	var links []string
+	link := func(c *cobra.Command) {
+		l := fmt.Sprintf("* :doc:`%v <%v>`", c.CommandPath(), rstName(c))
+		if c.Short != "" {
+			l += " - " + c.Short
+		}
+		links = append(links, l)
+	}
+	if parent := cmd.Parent(); parent != nil {
+		link(parent)
+	}
+	for _, sub := range cmd.Commands() {
+		if sub.IsAvailableCommand() && !sub.IsAdditionalHelpTopicCommand() {
+			link(sub)
+		}
+	}
+	if len(links) > 0 {
+		rstHeading(&b, "See Also", '-')
+		fmt.Fprintf(&b, "%v\n", strings.Join(links, "\n"))
+	}
+	return b.Bytes()
+}
+
+// GenRSTTree is similar to GenMarkdownTree, except that it generates
+// reStructuredText docs (myapp.rst, myapp_sub.rst etc.) for Sphinx, with the
+// flags as option directives (under program directives) and :doc: references
+// between parent and child commands.
+func GenRSTTree(p internal.Plan, dir string, mods ...func(*internal.RunOptions)) error {
+	cmd, err := build(p, runOptions(mods))
+	if err != nil {
+		return err
+	}
+	return genDocTree(cmd.delegate, dir, rstFilename, genRST)
+}
@@ -0,0 +1,78 @@
+package climate
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithSignals returns a modifier that makes Run cancel the context (passed to
+// the func / method being run) on the first of the given signals and exit
+// immediately on the second.
+//
+// Run then returns the conventional 128 + signal number as the exit code (130
+// for os.Interrupt, for example) if the func / method returns an error caused by
+// the cancellation (i.e., one that wraps context.Canceled, like ctx.Err()), and
+// the usual exit code otherwise (for it may have already completed). Note that
+// funcs / methods that don't accept a ctx have no way to know about the first
+// signal and so, can only be interrupted by the second.
+func WithSignals(sigs ...os.Signal) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Signals = append(opts.Signals, sigs...)
+	}
+}
+
+func signalExitCode(sig os.Signal) int {
+	if sig, ok := sig.(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+	return 1
+}
+
+// notifyContext is similar to signal.NotifyContext, except that it also exits
+// on the second signal and returns a func to get the first signal (if any).
+func notifyContext(ctx context.Context, sigs []os.Signal) (context.Context, func() os.Signal, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if len(sigs) == 0 {
+		return ctx, func() os.Signal { return nil }, cancel
+	}
+	var (
+		ch     = make(chan os.Signal, 2)
+		caught = make(chan os.Signal, 1)
+	)
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig, ok := <-ch:
+			if !ok {
+				return
+			}
+			caught <- sig
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		// Note: we keep listening (even after ctx is done) until stop is called.
+		if sig, ok := <-ch; ok {
+			os.Exit(signalExitCode(sig))
+		}
+	}()
+	signalled := func() os.Signal {
+		select {
+		case sig := <-caught:
+			caught <- sig // put it back for subsequent calls
+			return sig
+		default:
+			return nil
+		}
+	}
+	stop := func() {
+		signal.Stop(ch)
+		close(ch)
+		cancel()
+	}
+	return ctx, signalled, stop
+}
@@ -0,0 +1,71 @@
+package climate
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithSlog returns a modifier that makes Run declare (persistent) --log-level
+// and --log-format flags on the root command and pass a *slog.Logger configured
+// accordingly (logging to stderr) to the func / method being run, via Logger.
+//
+//	func serve(ctx context.Context) {
+//		climate.Logger(ctx).Debug("listening", "addr", addr)
+//	}
+func WithSlog() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Slog = true
+	}
+}
+
+type loggerKey struct{}
+
+// Logger returns the logger configured by WithSlog for the command being run
+// with the given context, or slog.Default() if WithSlog wasn't used.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+const (
+	logLevelFlag  = "log-level"
+	logFormatFlag = "log-format"
+)
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+func declareSlogFlags(cmd *cobra.Command) {
+	var (
+		fset          = cmd.PersistentFlags()
+		level, format string
+	)
+	enumVarP(fset, []string{"debug", "info", "warn", "error"})(
+		&level, logLevelFlag, "", "info", "minimum level of the logs to print")
+	enumVarP(fset, []string{"text", "json"})(
+		&format, logFormatFlag, "", "text", "format of the logs")
+}
+
+func applySlog(c *cobra.Command) {
+	var (
+		level  = assert.Ok(c.Flags().GetString(logLevelFlag))
+		format = assert.Ok(c.Flags().GetString(logFormatFlag))
+		opts   = &slog.HandlerOptions{Level: logLevels[level]}
+	)
+	var h slog.Handler = slog.NewTextHandler(c.ErrOrStderr(), opts)
+	if format == "json" {
+		h = slog.NewJSONHandler(c.ErrOrStderr(), opts)
+	}
+	c.SetContext(context.WithValue(c.Context(), loggerKey{}, slog.New(h)))
+}
@@ -0,0 +1,128 @@
+package climate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/avamsi/ergo"
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var readerType = reflect.TypeFor[io.Reader]()
+
+// stdinValue is the value of a flag declared for a field tagged with "stdin",
+// which is the path of the file to populate the field from (see applyStdin).
+type stdinValue struct {
+	path   string
+	target reflect.Value
+}
+
+var _ pflag.Value = (*stdinValue)(nil)
+
+func (sv *stdinValue) String() string {
+	return sv.path
+}
+
+func (sv *stdinValue) Set(s string) error {
+	sv.path = s
+	return nil
+}
+
+func (sv *stdinValue) Type() string {
+	return "file"
+}
+
+const stdinAnnotation = "climate_annotation_stdin"
+
+func stdinVarP(fset *pflag.FlagSet, t reflect.Type, p reflect.Value) flagTypeVarP[string] {
+	switch {
+	case t.Kind() == reflect.String, t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8, t == readerType:
+	default:
+		ergo.Panicf("stdin on non string | []byte | io.Reader: %v", t)
+	}
+	return func(_ *string, name, shorthand, value, usage string) {
+		fset.VarP(&stdinValue{value, p}, name, shorthand, usage)
+		assert.Nil(fset.SetAnnotation(name, stdinAnnotation, nil))
+		assert.Nil(cobra.MarkFlagFilename(fset, name))
+	}
+}
+
+// applyStdin populates the fields tagged with "stdin" from the files given via
+// their flags, with "-" meaning stdin. A flag that's not given at all falls back
+// to stdin as well, but only if stdin is not a terminal (i.e., something's piped
+// to it) and no other flag reads from stdin already (the first such flag wins).
+// So --file is always an override and piped data is only used otherwise. Fields
+// not populated this way are reset to their zero values.
+func applyStdin(c *cobra.Command) error {
+	var (
+		in     = c.InOrStdin()
+		values []*stdinValue
+		names  []string
+		stdin  = -1
+	)
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		if _, ok := f.Annotations[stdinAnnotation]; ok {
+			values = append(values, f.Value.(*stdinValue))
+			names = append(names, f.Name)
+		}
+	})
+	for i, v := range values {
+		if v.path != "-" {
+			continue
+		}
+		if stdin != -1 {
+			return ErrUsage(fmt.Errorf("both --%v and --%v read from stdin", names[stdin], names[i]))
+		}
+		stdin = i
+	}
+	if piped := in != os.Stdin || !isTerminal(in); stdin == -1 && piped {
+		for i, v := range values {
+			if v.path == "" {
+				stdin = i
+				break
+			}
+		}
+	}
+	for i, v := range values {
+		var r io.Reader
+		switch {
+		case i == stdin:
+			r = in
+		case v.path != "" && v.path != "-":
+			f, err := os.Open(v.path)
+			if err != nil {
+				return runtimeError(c, fmt.Errorf("--%v: %w", names[i], err))
+			}
+			// Close the file as soon as the command is done (Run cancels the
+			// context when the command finishes).
+			context.AfterFunc(c.Context(), func() { f.Close() })
+			r = f
+		}
+		if err := setFromReader(v.target, r); err != nil {
+			return runtimeError(c, fmt.Errorf("--%v: %w", names[i], err))
+		}
+	}
+	return nil
+}
+
+func setFromReader(target reflect.Value, r io.Reader) error {
+	if r == nil {
+		target.SetZero()
+		return nil
+	}
+	if target.Type() == readerType {
+		target.Set(reflect.ValueOf(r))
+		return nil
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	target.Set(reflect.ValueOf(b).Convert(target.Type()))
+	return nil
+}
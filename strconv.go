@@ -2,9 +2,12 @@ package climate
 
 import (
 	"encoding/csv"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/avamsi/ergo"
 	"github.com/avamsi/ergo/assert"
 )
 
@@ -16,6 +19,10 @@ func parseInt64(s string) int64 {
 	return assert.Ok(strconv.ParseInt(s, 10, 64))
 }
 
+func parseInt(s string) int {
+	return assert.Ok(strconv.Atoi(s))
+}
+
 func parseUint64(s string) uint64 {
 	return assert.Ok(strconv.ParseUint(s, 10, 64))
 }
@@ -24,6 +31,20 @@ func parseFloat64(s string) float64 {
 	return assert.Ok(strconv.ParseFloat(s, 64))
 }
 
+func parseDuration(s string) time.Duration {
+	return assert.Ok(time.ParseDuration(s))
+}
+
+func parseByteSize(s string) ByteSize {
+	return assert.Ok(ParseByteSize(s))
+}
+
+func timeParser(layout string) typeParser[time.Time] {
+	return func(s string) time.Time {
+		return assert.Ok(parseTime(s, layout))
+	}
+}
+
 func parseString(s string) string {
 	return s
 }
@@ -44,3 +65,64 @@ func sliceParser[T any](typer typeParser[T]) typeParser[[]T] {
 		return ts
 	}
 }
+
+func mapParser(s string) map[string]string {
+	// Same as sliceParser, plumb through csv.Reader to account for quotes etc.
+	ss := assert.Ok(csv.NewReader(strings.NewReader(s)).Read())
+	m := make(map[string]string, len(ss))
+	for _, kv := range ss {
+		if kv := strings.TrimSpace(kv); kv != "" {
+			k, v, ok := strings.Cut(kv, "=")
+			assert.Truef(ok, "not key=value: %v", kv)
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func delimSliceParser[E any](delim string) typeParser[[]E] {
+	return func(s string) []E {
+		return assert.Ok(splitDelim[E](s, delim))
+	}
+}
+
+func delimMapParser(delim string) typeParser[map[string]string] {
+	return func(s string) map[string]string {
+		return assert.Ok(splitDelimMap(s, delim))
+	}
+}
+
+// setScalar parses s as per the kind of v and sets v to the parsed value.
+func setScalar(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		v.SetString(s)
+	default:
+		ergo.Panicf("not bool | Integer | Float | string: %v", v.Type())
+	}
+	return nil
+}
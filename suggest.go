@@ -0,0 +1,219 @@
+package climate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithSuggestions returns a modifier that makes Run suggest commands (and flags)
+// within the given edit distance of the mistyped ones (2 by default).
+func WithSuggestions(minDistance int) func(*internal.RunOptions) {
+	assert.Truef(minDistance > 0, "nonpositive suggestions distance: %v", minDistance)
+	return func(opts *internal.RunOptions) {
+		opts.SuggestionsDistance = minDistance
+	}
+}
+
+// WithoutSuggestions returns a modifier that makes Run not suggest commands (or
+// flags) on typos at all, for CLIs where they misfire (like ones with very
+// short command names).
+func WithoutSuggestions() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.DisableSuggestions = true
+	}
+}
+
+// WithCaseInsensitiveCommands returns a modifier that makes Run match the
+// subcommands (and their aliases) regardless of case, so that "myapp Deploy"
+// and "myapp DEPLOY" both run deploy (while the help still shows the canonical
+// names). This doesn't affect how the flags are parsed.
+func WithCaseInsensitiveCommands() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.CaseInsensitive = true
+	}
+}
+
+// normalizeCommandArgs returns args with the subcommand names (and aliases)
+// matched regardless of case replaced with the canonical names, skipping over
+// the flags (and their values) like Cobra does when finding the command to run.
+// This is instead of Cobra's EnableCaseInsensitive, which is global (and so not
+// safe to toggle while Run may be called concurrently).
+func normalizeCommandArgs(cmd *cobra.Command, args []string) []string {
+	args = slices.Clone(args)
+	// Cobra's help command and the (hidden) completion request ones are only
+	// added on execute (and find the command from the root), so skip over them
+	// (and the last arg of the completion requests, i.e., the one to complete).
+	rest := args
+	if len(rest) > 0 {
+		switch rest[0] {
+		case "help":
+			rest = rest[1:]
+		case cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			rest = rest[1:max(1, len(rest)-1)]
+		}
+	}
+	for i := 0; i < len(rest); i++ {
+		arg := rest[i]
+		switch {
+		case arg == "--":
+			return args
+		case strings.HasPrefix(arg, "--") && !strings.Contains(arg, "="):
+			if f := lookupFlag(cmd, arg[2:]); f != nil && f.NoOptDefVal == "" {
+				i++
+			}
+		case strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") && len(arg) == 2:
+			if f := lookupShorthand(cmd, arg[1:]); f != nil && f.NoOptDefVal == "" {
+				i++
+			}
+		case strings.HasPrefix(arg, "-"):
+		default:
+			sub := findCommandFold(cmd, arg)
+			if sub == nil {
+				return args
+			}
+			rest[i], cmd = sub.Name(), sub
+		}
+	}
+	return args
+}
+
+// lookupFlag returns the flag of cmd (including the inherited ones) with the
+// given name, or nil if there's no such flag.
+func lookupFlag(cmd *cobra.Command, name string) *pflag.Flag {
+	if f := cmd.Flags().Lookup(name); f != nil {
+		return f
+	}
+	return cmd.InheritedFlags().Lookup(name)
+}
+
+// lookupShorthand is like lookupFlag, but for the shorthands.
+func lookupShorthand(cmd *cobra.Command, shorthand string) *pflag.Flag {
+	if f := cmd.Flags().ShorthandLookup(shorthand); f != nil {
+		return f
+	}
+	return cmd.InheritedFlags().ShorthandLookup(shorthand)
+}
+
+// findCommandFold returns the subcommand of cmd whose name (or alias) matches
+// the given name regardless of case, or nil if there's no such subcommand.
+func findCommandFold(cmd *cobra.Command, name string) *cobra.Command {
+	for _, sub := range cmd.Commands() {
+		if strings.EqualFold(sub.Name(), name) ||
+			slices.ContainsFunc(sub.Aliases, func(alias string) bool { return strings.EqualFold(alias, name) }) {
+			return sub
+		}
+	}
+	return nil
+}
+
+func configureSuggestions(cmd *cobra.Command, distance int, disable bool) {
+	visitCommands(cmd, func(c *cobra.Command) {
+		if distance > 0 {
+			c.SuggestionsMinimumDistance = distance
+		}
+		c.DisableSuggestions = disable
+	})
+}
+
+// levenshtein returns the edit distance between the given strings.
+func levenshtein(a, b string) int {
+	var (
+		ra, rb = []rune(a), []rune(b)
+		prev   = make([]int, len(rb)+1)
+		curr   = make([]int, len(rb)+1)
+	)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// suggestionsFor is cobra.Command.SuggestionsFor, except that it also suggests
+// commands whose aliases are close to (or prefixed by) the typed name.
+func suggestionsFor(cmd *cobra.Command, typed string) []string {
+	if cmd.DisableSuggestions {
+		return nil
+	}
+	// Cobra only defaults this on execute (which may not have happened yet).
+	if cmd.SuggestionsMinimumDistance <= 0 {
+		cmd.SuggestionsMinimumDistance = 2
+	}
+	suggestions := cmd.SuggestionsFor(typed)
+	lower := strings.ToLower(typed)
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || slices.Contains(suggestions, sub.Name()) {
+			continue
+		}
+		for _, alias := range sub.Aliases {
+			if levenshtein(lower, strings.ToLower(alias)) <= cmd.SuggestionsMinimumDistance ||
+				strings.HasPrefix(strings.ToLower(alias), lower) {
+				suggestions = append(suggestions, sub.Name())
+				break
+			}
+		}
+	}
+	return suggestions
+}
+
+// flagSuggestionsFor is like suggestionsFor, but for the flags of the given
+// command (including the inherited ones), to suggest on unknown flags.
+func flagSuggestionsFor(cmd *cobra.Command, typed string) []string {
+	if cmd.DisableSuggestions {
+		return nil
+	}
+	var (
+		suggestions []string
+		distance    = cmd.SuggestionsMinimumDistance
+	)
+	if distance <= 0 {
+		distance = 2
+	}
+	typed = internal.NormalizeToKebabCase(typed)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Hidden || f.Deprecated != "" {
+			return
+		}
+		if levenshtein(typed, f.Name) <= distance || strings.HasPrefix(f.Name, typed) {
+			suggestions = append(suggestions, "--"+f.Name)
+		}
+	})
+	return suggestions
+}
+
+// suggestFlags is a Cobra FlagErrorFunc that suggests flags close to the typed
+// one on unknown flag errors (Cobra only suggests commands by itself).
+func suggestFlags(cmd *cobra.Command, err error) error {
+	typed, ok := strings.CutPrefix(err.Error(), "unknown flag: --")
+	if !ok {
+		return err
+	}
+	suggestions := flagSuggestionsFor(cmd, typed)
+	if len(suggestions) == 0 {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n\nDid you mean this?\n", err)
+	for _, s := range suggestions {
+		fmt.Fprintf(&b, "\t%v\n", s)
+	}
+	return errors.New(strings.TrimSuffix(b.String(), "\n"))
+}
@@ -0,0 +1,21 @@
+package climate
+
+import "testing"
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"delete", "delete", 0},
+		{"delet", "delete", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.want {
+			t.Errorf("levenshtein(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package climate
+
+import "github.com/avamsi/climate/internal"
+
+// WithHelpTemplate returns a modifier that makes Run use the given (Go) template
+// for --help, instead of Cobra's default. The template is set on the root and
+// is inherited by all the subcommands, and is executed with the Cobra command
+// as the data (so, the usual .Name, .Short, .Long, .UseLine etc. are available,
+// where .Short and .Long are derived from the doc comments via metadata).
+func WithHelpTemplate(tmpl string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.HelpTemplate = tmpl
+	}
+}
+
+// WithUsageTemplate is similar to WithHelpTemplate, except that it replaces the
+// usage template (which the default help template includes and which is also
+// printed on errors). Flag usages can be rendered as an aligned table (like the
+// default) with {{.LocalFlags | flagUsages}}, for example.
+func WithUsageTemplate(tmpl string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.UsageTemplate = tmpl
+	}
+}
+
+// WithCompactHelp returns a modifier that makes Run use a compact layout for
+// --help (and the usage printed on errors), for the CLIs embedded in larger
+// systems or with deeply nested trees: the usage line, the short description,
+// and the (local and inherited) flags, commands and arguments as tight lists,
+// without the long description, examples or blank lines between the sections.
+//
+//	Usage: remote add <name>
+//	Add a remote.
+//	Flags:
+//	  -h, --help     help for add
+//	  -v, --verbose
+//
+// WithHelpTemplate and WithUsageTemplate still take precedence (if given).
+func WithCompactHelp() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.CompactHelp = true
+	}
+}
+
+// compactUsageTemplate is the usage template for WithCompactHelp (and the help
+// template just prints the usage, see prepare).
+const compactUsageTemplate = `Usage: {{if .Runnable}}{{.UseLine}}{{else if .HasAvailableSubCommands}}{{.CommandPath}} [command]{{end}}{{with .Short}}
+{{.}}{{end}}{{if .HasAvailableSubCommands}}
+Commands:{{range .Commands}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{with index .Annotations "` + argsAnnotation + `"}}
+Arguments:
+{{.}}{{end}}{{if .HasAvailableFlags}}
+Flags:
+{{.Flags | flagUsages | trimTrailingWhitespaces}}{{end}}
+`
@@ -4,12 +4,10 @@ go 1.23
 
 toolchain go1.23.0
 
-require (
-	github.com/avamsi/climate v0.0.0-20241207050957-d1cbd1f6119d
-	github.com/avamsi/ergo v0.0.0-20241122172142-bf83205e7399
-)
+require github.com/avamsi/climate v0.0.0-20241207050957-d1cbd1f6119d
 
 require (
+	github.com/avamsi/ergo v0.0.0-20241122172142-bf83205e7399 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
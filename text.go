@@ -0,0 +1,57 @@
+package climate
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+func typeIsTextUnmarshaler(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// textValue is a pflag.Value for the types that implement TextUnmarshaler (and
+// optionally, TextMarshaler or fmt.Stringer to print the default values).
+type textValue struct {
+	p encoding.TextUnmarshaler
+}
+
+var _ pflag.Value = textValue{}
+
+func (tv textValue) String() string {
+	if m, ok := tv.p.(encoding.TextMarshaler); ok {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	if s, ok := tv.p.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(reflect.ValueOf(tv.p).Elem())
+}
+
+func (tv textValue) Set(s string) error {
+	return tv.p.UnmarshalText([]byte(s))
+}
+
+func (tv textValue) Type() string {
+	if name := reflect.TypeOf(tv.p).Elem().Name(); name != "" {
+		return internal.NormalizeToKebabCase(name)
+	}
+	return "value"
+}
+
+// newTextValue returns a constructor (see valueVarP) of textValues for fields of
+// the given type.
+func newTextValue(t reflect.Type) func(unsafe.Pointer) pflag.Value {
+	return func(p unsafe.Pointer) pflag.Value {
+		return textValue{reflect.NewAt(t, p).Interface().(encoding.TextUnmarshaler)}
+	}
+}
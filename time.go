@@ -0,0 +1,88 @@
+package climate
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+	byteSizeType = reflect.TypeFor[ByteSize]()
+)
+
+// parseTime parses s as per the given layout, except for "now" and "today"
+// (which are the current time and the start of the current day, respectively).
+func parseTime(s, layout string) (time.Time, error) {
+	switch now := time.Now(); s {
+	case "now":
+		return now, nil
+	case "today":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	}
+	return time.ParseInLocation(layout, s, time.Local)
+}
+
+type timeValue struct {
+	p      *time.Time
+	layout string
+}
+
+var _ pflag.Value = timeValue{}
+
+func (tv timeValue) String() string {
+	if tv.p.IsZero() {
+		return ""
+	}
+	return tv.p.Format(tv.layout)
+}
+
+func (tv timeValue) Set(s string) error {
+	t, err := parseTime(s, tv.layout)
+	if err != nil {
+		return err
+	}
+	*tv.p = t
+	return nil
+}
+
+func (tv timeValue) Type() string {
+	return "time"
+}
+
+const timeAnnotation = "climate_annotation_time"
+
+func timeVarP(fset *pflag.FlagSet, layout string) flagTypeVarP[time.Time] {
+	return func(p *time.Time, name, shorthand string, value time.Time, usage string) {
+		*p = value
+		fset.VarP(timeValue{p, layout}, name, shorthand, usage)
+		assert.Nil(fset.SetAnnotation(name, timeAnnotation, nil))
+	}
+}
+
+func registerTimeCompletions(cmd *cobra.Command) {
+	visitFlags(cmd, func(c *cobra.Command, f *pflag.Flag) {
+		if _, ok := f.Annotations[timeAnnotation]; !ok {
+			return
+		}
+		if _, ok := c.GetFlagCompletionFunc(f.Name); ok {
+			return // already registered (via WithCompletion)
+		}
+		complete := func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			var completions []string
+			for _, v := range []string{"now", "today"} {
+				if strings.HasPrefix(v, toComplete) {
+					completions = append(completions, v)
+				}
+			}
+			return completions, cobra.ShellCompDirectiveNoFileComp
+		}
+		assert.Nil(c.RegisterFlagCompletionFunc(f.Name, complete))
+	})
+}
@@ -0,0 +1,51 @@
+package climate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithTimeoutFlag returns a modifier that makes Run declare a (persistent)
+// duration flag with the given name on the root command, which (if nonzero)
+// sets a timeout on the context passed to the func / method being run.
+//
+// If the func / method returns an error after the timeout fires, Run returns
+// 124 as the exit code (by the same convention as timeout(1)).
+func WithTimeoutFlag(name string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.TimeoutFlag = name
+	}
+}
+
+const timeoutExitCode = 124
+
+func declareTimeoutFlag(cmd *cobra.Command, name string) {
+	cmd.PersistentFlags().Duration(name, 0, "timeout for the command (e.g. 30s, 5m), 0 for no timeout")
+}
+
+func applyTimeout(c *cobra.Command, name string) {
+	d := assert.Ok(c.Flags().GetDuration(name))
+	if d <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Context(), d)
+	// Release the timer as soon as the parent is done (Run cancels it when the
+	// command finishes).
+	context.AfterFunc(c.Context(), cancel)
+	c.SetContext(ctx)
+}
+
+// timedOut reports whether the given (executed) command failed after its own
+// timeout fired (as opposed to ctx, the context it was executed with, being
+// done because of its deadline, say).
+func timedOut(ctx context.Context, c *cobra.Command, err error) bool {
+	if err == nil || c == nil || c.Context() == nil || ctx.Err() != nil {
+		return false
+	}
+	return errors.Is(c.Context().Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,47 @@
+package climate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/avamsi/ergo/assert"
+	"github.com/spf13/cobra"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithTiming returns a modifier that makes Run declare a (persistent) --timing
+// flag, which when set, prints the wall-clock duration of the func / method
+// being run to stderr after it returns (noting whether it failed, if so).
+func WithTiming() func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Timing = true
+	}
+}
+
+const timingFlag = "timing"
+
+func declareTimingFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool(timingFlag, false, "print how long the command took")
+}
+
+// wrapTiming wraps the RunE of cmd and all of its subcommands to time them (see
+// WithTiming).
+func wrapTiming(cmd *cobra.Command) {
+	wrapRunE(cmd, func(runE runFunc) runFunc {
+		return func(c *cobra.Command, args []string) error {
+			if !assert.Ok(c.Flags().GetBool(timingFlag)) {
+				return runE(c, args)
+			}
+			start := time.Now()
+			err := runE(c, args)
+			d := time.Since(start).Round(time.Microsecond)
+			if err != nil {
+				fmt.Fprintf(c.ErrOrStderr(), "%v failed after %v\n", c.CommandPath(), d)
+			} else {
+				fmt.Fprintf(c.ErrOrStderr(), "%v took %v\n", c.CommandPath(), d)
+			}
+			return err
+		}
+	})
+}
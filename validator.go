@@ -0,0 +1,83 @@
+package climate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/avamsi/ergo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithValidator returns a modifier that makes Run validate the given flag (of
+// any command that has it) with the given func, after the flags are parsed (and
+// applied from the environment variables, config file etc.) but before the func
+// / method is run. Only flags that are actually set are validated (i.e., not
+// the default values). Failing validation is a usage error.
+//
+//	climate.WithValidator("port", func(port int) error {
+//		if port < 1 || port > 65535 {
+//			return errors.New("must be between 1 and 65535")
+//		}
+//		return nil
+//	})
+//
+// The flag is retrieved as T just like with Flag (so an int8 flag may be
+// validated as an int, for example). Multiple validators for the same flag are
+// run in order.
+func WithValidator[T any](flag string, validate func(v T) error) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		if opts.Validators == nil {
+			opts.Validators = map[string][]internal.Validator{}
+		}
+		name := internal.NormalizeToKebabCase(flag)
+		opts.Validators[name] = append(opts.Validators[name], internal.Validator{
+			Type: reflect.TypeFor[T](),
+			Validate: func(v reflect.Value) error {
+				return validate(v.Interface().(T))
+			},
+		})
+	}
+}
+
+// checkValidators verifies that all the validators are for existing flags (of
+// types convertible to the validated ones).
+func checkValidators(cmd *cobra.Command, fields map[*pflag.Flag]reflect.Value, validators map[string][]internal.Validator) {
+	checked := map[string]bool{}
+	visitFlags(cmd, func(_ *cobra.Command, f *pflag.Flag) {
+		for _, v := range validators[f.Name] {
+			if _, ok := convert(flagValue(fields, f), v.Type); !ok {
+				ergo.Panicf("cannot validate --%v as %v", f.Name, v.Type)
+			}
+		}
+		checked[f.Name] = true
+	})
+	for name := range validators {
+		if !checked[name] {
+			ergo.Panicf("no flag for validator: %v", name)
+		}
+	}
+}
+
+func applyValidators(fset *pflag.FlagSet, fields map[*pflag.Flag]reflect.Value, validators map[string][]internal.Validator) error {
+	var errs []error
+	fset.VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		for _, v := range validators[f.Name] {
+			value, _ := convert(flagValue(fields, f), v.Type)
+			if err := v.Validate(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q for --%v: %w", f.Value, f.Name, err))
+				break
+			}
+		}
+	})
+	if len(errs) == 0 {
+		return nil
+	}
+	return ErrUsage(errors.Join(errs...))
+}
@@ -0,0 +1,38 @@
+package climate
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/avamsi/ergo/assert"
+
+	"github.com/avamsi/climate/internal"
+)
+
+// WithVersion returns a modifier that sets the version to be printed by the
+// --version flag and the version subcommand (the latter is only added to root
+// commands with subcommands). Without it, Run falls back to the version (or
+// pseudo-version) of the main module, as reported by the build info.
+func WithVersion(version string) func(*internal.RunOptions) {
+	return func(opts *internal.RunOptions) {
+		opts.Version = version
+	}
+}
+
+// VersionInfo is the (richer) version information accepted by WithVersionInfo.
+type VersionInfo struct {
+	Version, Commit, Date string
+}
+
+// WithVersionInfo returns a modifier similar to WithVersion, except that the
+// --version flag and the version subcommand print the given info formatted as
+// per the given template ("{{.Version}} ({{.Commit}}, {{.Date}})", for example).
+func WithVersionInfo(info VersionInfo, tmpl string) func(*internal.RunOptions) {
+	var b strings.Builder
+	t := assert.Ok(template.New("version").Parse(tmpl))
+	assert.Nil(t.Execute(&b, info))
+	return func(opts *internal.RunOptions) {
+		opts.Version = info.Version
+		opts.VersionText = b.String()
+	}
+}